@@ -0,0 +1,85 @@
+package beam
+
+import (
+	"encoding/hex"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	//SBBS地址为十六进制的WalletID，由通道号和32字节公钥组成，通道号的前导0省略
+	SBBSAddressMinLength = 64
+	SBBSAddressMaxLength = 72
+)
+
+//AddressDecoder 地址解析器
+type AddressDecoder struct {
+	*openwallet.AddressDecoderV2Base
+	wm *WalletManager //钱包管理者
+}
+
+//NewAddressDecoder 地址解析器
+func NewAddressDecoder(wm *WalletManager) *AddressDecoder {
+	decoder := AddressDecoder{}
+	decoder.wm = wm
+	return &decoder
+}
+
+//AddressDecode 地址解析，返回WalletID
+func (decoder *AddressDecoder) AddressDecode(addr string, opts ...interface{}) ([]byte, error) {
+
+	err := CheckSBBSAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addr)%2 == 1 {
+		addr = "0" + addr
+	}
+
+	return hex.DecodeString(addr)
+}
+
+//AddressVerify 地址校验
+func (decoder *AddressDecoder) AddressVerify(address string, opts ...interface{}) bool {
+	return decoder.ValidateAddress(address) == nil
+}
+
+//ValidateAddress 校验地址格式，开启validateaddressbywallet时再由钱包validate_address确认
+func (decoder *AddressDecoder) ValidateAddress(address string) error {
+
+	err := CheckSBBSAddress(address)
+	if err != nil {
+		return err
+	}
+
+	if !decoder.wm.Config.validateaddressbywallet {
+		return nil
+	}
+
+	result, err := decoder.wm.walletClient.ValidateAddress(decoder.wm.context(), address)
+	if err != nil {
+		return OpenwalletError(err, openwallet.ErrAdressDecodeFailed)
+	}
+
+	if !result.IsValid {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "address %s is rejected by wallet", address)
+	}
+
+	return nil
+}
+
+//CheckSBBSAddress 本地检查SBBS地址的长度和字符
+func CheckSBBSAddress(address string) error {
+
+	if len(address) < SBBSAddressMinLength || len(address) > SBBSAddressMaxLength {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "address %s length is invalid", address)
+	}
+
+	for _, c := range address {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "address %s is not hex encoded", address)
+		}
+	}
+
+	return nil
+}
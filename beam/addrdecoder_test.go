@@ -0,0 +1,103 @@
+package beam
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestCheckSBBSAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{"21aff5eb4da2591321ac12bb280ac69ea39a33472166c600ec122cf3381b6c9e772", true},
+		{"29510B33FAC0CB20695FD3B836D835451E600C4224D8FB335DC1A68271DEB9B6B5B", true},
+		{testReceiver[:SBBSAddressMinLength], true},
+		{testReceiver[:SBBSAddressMinLength-1], false},
+		{testReceiver + "abcdef", false},
+		{"21aff5eb4da2591321ac12bb280ac69ea39a33472166c600ec122cf3381b6c9e77x", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		err := CheckSBBSAddress(test.address)
+		if (err == nil) != test.valid {
+			t.Errorf("CheckSBBSAddress(%s) = %v, want valid %v", test.address, err, test.valid)
+		}
+		if err != nil && openwallet.ConvertError(err).Code() != openwallet.ErrAdressDecodeFailed {
+			t.Errorf("CheckSBBSAddress(%s) error code = %d", test.address, openwallet.ConvertError(err).Code())
+		}
+	}
+}
+
+func TestAddressDecoder_AddressDecode(t *testing.T) {
+	wm := NewWalletManager()
+	decoder, ok := wm.GetAddressDecode().(openwallet.AddressDecoderV2)
+	if !ok {
+		t.Fatalf("GetAddressDecode = %T, want AddressDecoderV2", wm.GetAddressDecode())
+	}
+
+	address := "21aff5eb4da2591321ac12bb280ac69ea39a33472166c600ec122cf3381b6c9e772"
+	walletID, err := decoder.AddressDecode(address)
+	if err != nil {
+		t.Fatalf("AddressDecode failed unexpected error: %v", err)
+	}
+	if len(walletID) != 34 || hex.EncodeToString(walletID) != "0"+address {
+		t.Errorf("AddressDecode = %x", walletID)
+	}
+
+	if _, err = decoder.AddressDecode("receiver"); err == nil {
+		t.Errorf("AddressDecode of invalid address should fail")
+	}
+	if !decoder.AddressVerify(address) || decoder.AddressVerify("receiver") {
+		t.Errorf("AddressVerify result is unexpected")
+	}
+}
+
+func TestAddressDecoder_ValidateAddressByWallet(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	decoder := wm.Decoder.(*AddressDecoder)
+
+	srv.RejectAddress(testReceiver)
+
+	//默认只做本地检查
+	if err := decoder.ValidateAddress(testReceiver); err != nil {
+		t.Errorf("ValidateAddress failed unexpected error: %v", err)
+	}
+	if n := srv.Calls("validate_address"); n != 0 {
+		t.Errorf("validate_address calls = %d, want 0", n)
+	}
+
+	wm.Config.validateaddressbywallet = true
+
+	err := decoder.ValidateAddress(testReceiver)
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrAdressDecodeFailed {
+		t.Errorf("ValidateAddress error = %v, want address decode failed", err)
+	}
+	if err = decoder.ValidateAddress(testReceiverA); err != nil {
+		t.Errorf("ValidateAddress failed unexpected error: %v", err)
+	}
+
+	//钱包不可用时返回调用失败
+	srv.FailHTTP("validate_address", 502, wm.walletClient.MaxRetries+1)
+	err = decoder.ValidateAddress(testReceiverA)
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrCallFullNodeAPIFailed {
+		t.Errorf("ValidateAddress error = %v, want call full node api failed", err)
+	}
+
+	//被钱包拒绝的地址不会发送
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		To:   map[string]string{testReceiver: "0.1"},
+	}
+	if _, err = wm.TxDecoder.SubmitRawTransaction(nil, rawTx); err == nil {
+		t.Errorf("SubmitRawTransaction to rejected address should fail")
+	}
+	if n := srv.Calls("tx_send"); n != 0 {
+		t.Errorf("tx_send calls = %d, want 0", n)
+	}
+}
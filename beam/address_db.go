@@ -0,0 +1,207 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/openwallet"
+	"time"
+)
+
+//CreateAccountAddress 为用户账户创建地址，并登记地址所属账户。
+//钱包中的地址备注为comment，comment为空时使用accountID，expiration为空时使用配置的默认有效期
+func (wm *WalletManager) CreateAccountAddress(accountID, comment, expiration string, count, workerSize uint64) ([]*AddressRecord, error) {
+
+	if len(accountID) == 0 {
+		return nil, fmt.Errorf("account id is empty")
+	}
+
+	if len(comment) == 0 {
+		comment = accountID
+	}
+
+	if len(expiration) == 0 {
+		expiration = wm.Config.addressexpiration
+	}
+
+	walletExpiration, duration, err := parseAddressExpiration(expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := wm.walletClient.createBatchAddress(wm.context(), count, workerSize, func(ctx context.Context) (string, error) {
+		return wm.walletClient.CreateAddressWithComment(ctx, comment, walletExpiration)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := wm.addressDB()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	//部分地址创建失败时，仍登记已创建的地址
+	records := make([]*AddressRecord, 0, len(result.Addresses))
+	for _, addr := range result.Addresses {
+		record := NewAddressRecord(addr, accountID, comment, expiration, duration)
+		record.Synced = true
+		err = tx.Save(record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, result.Err()
+}
+
+//parseAddressExpiration 解析地址有效期，返回钱包create_address和edit_address使用的有效期，以及有效时长。
+//自定义时长（如72h）在钱包中永久有效，到期后由地址池任务在钱包中设为过期
+func parseAddressExpiration(expiration string) (string, time.Duration, error) {
+
+	switch expiration {
+	case AddressExpirationNever:
+		return AddressExpirationNever, 0, nil
+	case AddressExpiration24h:
+		return AddressExpiration24h, 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(expiration)
+	if err != nil || duration <= 0 {
+		return "", 0, fmt.Errorf("invalid address expiration: %s", expiration)
+	}
+
+	return AddressExpirationNever, duration, nil
+}
+
+//SaveAddressRecord 保存地址登记信息
+func (wm *WalletManager) SaveAddressRecord(record *AddressRecord) error {
+
+	if record == nil {
+		return fmt.Errorf("the address record to save is nil")
+	}
+
+	db, err := wm.addressDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Save(record)
+}
+
+//GetAddressRecord 获取地址登记信息
+func (wm *WalletManager) GetAddressRecord(address string) (*AddressRecord, error) {
+
+	var (
+		record AddressRecord
+	)
+
+	db, err := wm.addressDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.One("Address", address, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+//ListAddressRecords 按创建时间分页列出地址登记信息，accountID为空时列出所有账户
+//@limit 返回的最多记录数，0不限制
+func (wm *WalletManager) ListAddressRecords(accountID string, offset, limit int) ([]*AddressRecord, error) {
+
+	db, err := wm.addressDB()
+	if err != nil {
+		return nil, err
+	}
+
+	matchers := make([]q.Matcher, 0)
+	if len(accountID) > 0 {
+		matchers = append(matchers, q.Eq("AccountID", accountID))
+	}
+
+	query := db.Select(matchers...).OrderBy("CreatedAt", "Address").Skip(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	list := make([]*AddressRecord, 0)
+	err = query.Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//AddressRegistryScanTarget 使用地址登记信息查找扫描对象所属账户的BlockScanTargetFunc
+func (wm *WalletManager) AddressRegistryScanTarget() openwallet.BlockScanTargetFunc {
+	return func(target openwallet.ScanTarget) (string, bool) {
+		if len(target.Address) == 0 {
+			return "", false
+		}
+		record, err := wm.GetAddressRecord(target.Address)
+		if err != nil {
+			if err != storm.ErrNotFound {
+				wm.Log.Errorf("Get address record of %s failed, unexpected error: %v", target.Address, err)
+			}
+			return "", false
+		}
+		return record.AccountID, len(record.AccountID) > 0
+	}
+}
+
+//CreateRemoteAccountAddress 在服务端钱包为用户账户创建地址
+func (wm WalletManager) CreateRemoteAccountAddress(accountID, comment, expiration string, count, workerSize uint64) ([]*AddressRecord, error) {
+	if wm.Config.enableserver {
+		return nil, fmt.Errorf("server mode can not create remote address, use create local address")
+	}
+
+	if wm.Config.enablesingle {
+		return wm.CreateAccountAddress(accountID, comment, expiration, count, workerSize)
+	}
+
+	return wm.client.CreateAccountAddress(accountID, comment, expiration, count, workerSize)
+}
+
+//GetRemoteAddressRecord 获取服务端的地址登记信息
+func (wm WalletManager) GetRemoteAddressRecord(address string) (*AddressRecord, error) {
+	if wm.Config.enableserver {
+		return nil, fmt.Errorf("server mode can not get remote address record, use get local address record")
+	}
+
+	if wm.Config.enablesingle {
+		return wm.GetAddressRecord(address)
+	}
+
+	return wm.client.GetAddressRecord(address)
+}
+
+//ListRemoteAddressRecords 分页列出服务端的地址登记信息
+func (wm WalletManager) ListRemoteAddressRecords(accountID string, offset, limit int) ([]*AddressRecord, error) {
+	if wm.Config.enableserver {
+		return nil, fmt.Errorf("server mode can not list remote address records, use list local address records")
+	}
+
+	if wm.Config.enablesingle {
+		return wm.ListAddressRecords(accountID, offset, limit)
+	}
+
+	return wm.client.ListAddressRecords(accountID, offset, limit)
+}
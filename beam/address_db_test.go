@@ -0,0 +1,146 @@
+package beam
+
+import (
+	"testing"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/blocktree/openwallet/owtp"
+)
+
+func TestWalletManager_CreateAccountAddress(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+
+	records, err := wm.CreateAccountAddress("user-1", "", "", 3, 2)
+	if err != nil {
+		t.Fatalf("CreateAccountAddress failed unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("CreateAccountAddress = %d records, want 3", len(records))
+	}
+	if _, err = wm.CreateAccountAddress("user-2", "vip", "", 2, 2); err != nil {
+		t.Fatalf("CreateAccountAddress failed unexpected error: %v", err)
+	}
+	if _, err = wm.CreateAccountAddress("", "", "", 1, 1); err == nil {
+		t.Errorf("CreateAccountAddress without account id should fail")
+	}
+
+	//钱包中的地址备注为账户或指定的备注
+	comments := make(map[string]string)
+	for _, a := range srv.Addresses() {
+		comments[a.Address] = a.Comment
+	}
+	for _, r := range records {
+		if comments[r.Address] != "user-1" || r.Comment != "user-1" {
+			t.Errorf("address %s comment = %s, record = %+v", r.Address, comments[r.Address], r)
+		}
+		if r.Expiration != AddressExpirationNever || r.ExpiredAt != 0 || r.CreatedAt == 0 {
+			t.Errorf("record = %+v", r)
+		}
+	}
+
+	record, err := wm.GetAddressRecord(records[1].Address)
+	if err != nil || record.AccountID != "user-1" {
+		t.Errorf("GetAddressRecord = %+v, %v", record, err)
+	}
+	if _, err = wm.GetAddressRecord("unknown"); err != storm.ErrNotFound {
+		t.Errorf("GetAddressRecord error = %v, want not found", err)
+	}
+
+	all, err := wm.ListAddressRecords("", 0, 0)
+	if err != nil || len(all) != 5 {
+		t.Fatalf("ListAddressRecords = %d records, %v", len(all), err)
+	}
+	page, err := wm.ListAddressRecords("", 1, 2)
+	if err != nil || len(page) != 2 || page[0].Address != all[1].Address || page[1].Address != all[2].Address {
+		t.Errorf("ListAddressRecords page = %+v, %v", page, err)
+	}
+	user2, err := wm.ListAddressRecords("user-2", 0, 10)
+	if err != nil || len(user2) != 2 || user2[0].Comment != "vip" {
+		t.Errorf("ListAddressRecords user-2 = %+v, %v", user2, err)
+	}
+	none, err := wm.ListAddressRecords("user-3", 0, 10)
+	if err != nil || len(none) != 0 {
+		t.Errorf("ListAddressRecords user-3 = %+v, %v", none, err)
+	}
+
+	remote, err := wm.GetRemoteAddressRecord(records[0].Address)
+	if err != nil || remote.AccountID != "user-1" {
+		t.Errorf("GetRemoteAddressRecord in single mode = %+v, %v", remote, err)
+	}
+}
+
+func TestWalletManager_AddressRegistryScanTarget(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(3)
+
+	records, err := wm.CreateAccountAddress("user-1", "", "", 1, 1)
+	if err != nil {
+		t.Fatalf("CreateAccountAddress failed unexpected error: %v", err)
+	}
+
+	scanTarget := wm.AddressRegistryScanTarget()
+	if account, ok := scanTarget(openwallet.ScanTarget{Address: records[0].Address}); !ok || account != "user-1" {
+		t.Errorf("scan target = %s, %v", account, ok)
+	}
+	if _, ok := scanTarget(openwallet.ScanTarget{Address: testReceiver}); ok {
+		t.Errorf("unregistered address should not be a scan target")
+	}
+
+	deposit := srv.AddTransaction(&beamtest.Tx{
+		Sender:   testReceiver,
+		Receiver: records[0].Address,
+		Value:    100000000,
+		Height:   3,
+		Income:   true,
+	})
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(scanTarget)
+	observer := newTestObserver()
+	bs.AddObserver(observer)
+
+	if err = bs.SetRescanBlockHeight(2); err != nil {
+		t.Fatalf("SetRescanBlockHeight failed unexpected error: %v", err)
+	}
+	bs.Scanning = true
+	bs.ScanBlockTask()
+	observer.waitHeaders(t, 3)
+
+	data := observer.extractData("user-1")
+	if len(data) != 1 || data[0].Transaction.TxID != deposit.TxID {
+		t.Errorf("user-1 extract data = %+v", data)
+	}
+}
+
+func TestServer_createAccountAddress_Partial(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	//部分地址创建失败时，客户端收到已登记的地址和失败原因
+	for _, method := range []string{"createAccountAddress", "allocateAccountAddress"} {
+		srv.FailRPC("create_address", -32603, "Internal JSON-RPC error.", 1)
+		ctx := owtp.NewContext(1, 1, "11111", method, []byte(`{"accountID":"user-1","count":3,"workerSize":1}`))
+		server.authorize(testServerRoute(t, server, method))(ctx)
+
+		records, err := parseAccountAddressResponse(ctx.Resp)
+		batchErr, ok := err.(*BatchAddressError)
+		if !ok {
+			t.Fatalf("%s error = %v, want *BatchAddressError", method, err)
+		}
+		if len(records) != 2 || len(batchErr.Result.Addresses) != 2 || len(batchErr.Result.Failed) != 1 {
+			t.Fatalf("%s = %d records, result %+v", method, len(records), batchErr.Result)
+		}
+		for i, r := range records {
+			if r.AccountID != "user-1" || r.Address != batchErr.Result.Addresses[i] {
+				t.Errorf("%s record = %+v", method, r)
+			}
+		}
+	}
+}
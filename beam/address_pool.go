@@ -0,0 +1,312 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/timer"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//AddressPool 地址池，后台预生成未分配的地址，分配时不等待钱包创建地址。
+//定时任务同时把已分配地址的备注和有效期同步到钱包，并使自定义有效期到期的地址过期
+type AddressPool struct {
+	wm      *WalletManager
+	mu      sync.Mutex
+	task    *timer.TaskTimer
+	running bool
+	busy    int32 //维护任务执行中
+}
+
+//NewAddressPool 创建地址池
+func NewAddressPool(wm *WalletManager) *AddressPool {
+	pool := AddressPool{
+		wm: wm,
+	}
+	return &pool
+}
+
+//Run 按配置的周期定时维护地址池
+func (pool *AddressPool) Run() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.running {
+		return
+	}
+
+	pool.wm.Log.Infof("The timer for address pool start now. Execute by every %v seconds.", pool.wm.Config.addresspoolperiod.Seconds())
+
+	pool.task = timer.NewTask(pool.wm.Config.addresspoolperiod, pool.Maintain)
+	pool.task.Start()
+	pool.running = true
+}
+
+//Stop 停止定时维护
+func (pool *AddressPool) Stop() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.task != nil {
+		pool.task.Stop()
+	}
+	pool.running = false
+}
+
+//Size 地址池中未分配的地址数量
+func (pool *AddressPool) Size() (int, error) {
+
+	db, err := pool.wm.addressDB()
+	if err != nil {
+		return 0, err
+	}
+
+	return db.Count(&PooledAddress{})
+}
+
+//Allocate 从地址池为用户账户分配地址，地址池不足时向钱包创建剩余的地址。
+//分配的地址马上登记，钱包中的备注和有效期由后台任务同步
+func (pool *AddressPool) Allocate(accountID, comment, expiration string, count uint64) ([]*AddressRecord, error) {
+
+	if len(accountID) == 0 {
+		return nil, fmt.Errorf("account id is empty")
+	}
+
+	if count == 0 {
+		return nil, fmt.Errorf("allocate address count is zero")
+	}
+
+	if len(comment) == 0 {
+		comment = accountID
+	}
+
+	if len(expiration) == 0 {
+		expiration = pool.wm.Config.addressexpiration
+	}
+
+	_, duration, err := parseAddressExpiration(expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := pool.wm.addressDB()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pooled []*PooledAddress
+	err = tx.Select().OrderBy("CreatedAt", "Address").Limit(int(count)).Find(&pooled)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	records := make([]*AddressRecord, 0, count)
+	for _, p := range pooled {
+		err = tx.DeleteStruct(p)
+		if err != nil {
+			return nil, err
+		}
+		record := NewAddressRecord(p.Address, accountID, comment, expiration, duration)
+		err = tx.Save(record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	//后台同步备注和有效期，并补充地址池
+	pool.mu.Lock()
+	if pool.running {
+		go pool.Maintain()
+	}
+	pool.mu.Unlock()
+
+	if uint64(len(records)) < count {
+		pool.wm.Log.Warningf("Address pool has only %d addresses, create %d addresses on demand", len(records), count-uint64(len(records)))
+		created, err := pool.wm.CreateAccountAddress(accountID, comment, expiration, count-uint64(len(records)), count-uint64(len(records)))
+		records = append(records, created...)
+		if err != nil {
+			return records, err
+		}
+	}
+
+	return records, nil
+}
+
+//Maintain 同步已分配地址的备注和有效期，使到期的地址过期，并补充地址池。
+//同一时间只执行一个
+func (pool *AddressPool) Maintain() {
+
+	if !pool.wm.lifecycle.enter() {
+		return
+	}
+	defer pool.wm.lifecycle.leave()
+
+	if !atomic.CompareAndSwapInt32(&pool.busy, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&pool.busy, 0)
+
+	err := pool.syncAddresses()
+	if err != nil {
+		pool.wm.Log.Errorf("address pool can not sync addresses; unexpected error: %v", err)
+	}
+
+	err = pool.expireAddresses()
+	if err != nil {
+		pool.wm.Log.Errorf("address pool can not expire addresses; unexpected error: %v", err)
+	}
+
+	err = pool.refill()
+	if err != nil {
+		pool.wm.Log.Errorf("address pool can not refill; unexpected error: %v", err)
+	}
+}
+
+//syncAddresses 把已分配地址的备注和有效期同步到钱包
+func (pool *AddressPool) syncAddresses() error {
+
+	db, err := pool.wm.addressDB()
+	if err != nil {
+		return err
+	}
+
+	var records []*AddressRecord
+	err = db.Select(q.Eq("Synced", false)).Find(&records)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	for _, record := range records {
+		walletExpiration, _, err := parseAddressExpiration(record.Expiration)
+		if err != nil {
+			return err
+		}
+		err = pool.wm.walletClient.EditAddress(pool.wm.context(), record.Address, record.Comment, walletExpiration)
+		if err != nil {
+			return err
+		}
+		record.Synced = true
+		err = db.Save(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//expireAddresses 使到期的地址在钱包中过期
+func (pool *AddressPool) expireAddresses() error {
+
+	db, err := pool.wm.addressDB()
+	if err != nil {
+		return err
+	}
+
+	var records []*AddressRecord
+	err = db.Select(
+		q.Gt("ExpiredAt", 0),
+		q.Lte("ExpiredAt", time.Now().Unix()),
+		q.Eq("Expired", false),
+		q.Eq("Synced", true),
+	).Find(&records)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	for _, record := range records {
+		//24h有效期由钱包自行过期
+		if record.Expiration != AddressExpiration24h {
+			err = pool.wm.walletClient.EditAddress(pool.wm.context(), record.Address, "", AddressExpirationExpired)
+			if err != nil {
+				return err
+			}
+		}
+		record.Expired = true
+		err = db.Save(record)
+		if err != nil {
+			return err
+		}
+		pool.wm.Log.Infof("Address %s of account %s is expired", record.Address, record.AccountID)
+	}
+
+	return nil
+}
+
+//refill 补充地址池到配置的数量
+func (pool *AddressPool) refill() error {
+
+	size := pool.wm.Config.addresspoolsize
+	if size == 0 {
+		return nil
+	}
+
+	n, err := pool.Size()
+	if err != nil {
+		return err
+	}
+
+	if uint64(n) >= size {
+		return nil
+	}
+
+	result, err := pool.wm.walletClient.createBatchAddress(pool.wm.context(), size-uint64(n), size-uint64(n), func(ctx context.Context) (string, error) {
+		return pool.wm.walletClient.CreateAddressWithComment(ctx, "", AddressExpirationNever)
+	})
+	if err != nil {
+		return err
+	}
+
+	db, err := pool.wm.addressDB()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, addr := range result.Addresses {
+		err = db.Save(&PooledAddress{Address: addr, CreatedAt: now})
+		if err != nil {
+			return err
+		}
+	}
+
+	pool.wm.Log.Infof("Address pool is refilled with %d addresses", len(result.Addresses))
+
+	return result.Err()
+}
+
+//AllocateAccountAddress 为用户账户分配地址，开启地址池时从地址池分配，否则向钱包创建
+func (wm *WalletManager) AllocateAccountAddress(accountID, comment, expiration string, count uint64) ([]*AddressRecord, error) {
+	if wm.Config.addresspoolsize == 0 {
+		return wm.CreateAccountAddress(accountID, comment, expiration, count, count)
+	}
+	return wm.AddressPool.Allocate(accountID, comment, expiration, count)
+}
+
+//AllocateRemoteAccountAddress 在服务端为用户账户分配地址
+func (wm WalletManager) AllocateRemoteAccountAddress(accountID, comment, expiration string, count uint64) ([]*AddressRecord, error) {
+	if wm.Config.enableserver {
+		return nil, fmt.Errorf("server mode can not allocate remote address, use allocate local address")
+	}
+
+	if wm.Config.enablesingle {
+		return wm.AllocateAccountAddress(accountID, comment, expiration, count)
+	}
+
+	return wm.client.AllocateAccountAddress(accountID, comment, expiration, count)
+}
@@ -0,0 +1,162 @@
+package beam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+)
+
+func TestParseAddressExpiration(t *testing.T) {
+	tests := []struct {
+		expiration string
+		wallet     string
+		duration   time.Duration
+		valid      bool
+	}{
+		{AddressExpirationNever, AddressExpirationNever, 0, true},
+		{AddressExpiration24h, AddressExpiration24h, 24 * time.Hour, true},
+		{"72h", AddressExpirationNever, 72 * time.Hour, true},
+		{"30m", AddressExpirationNever, 30 * time.Minute, true},
+		{AddressExpirationExpired, "", 0, false},
+		{"-1h", "", 0, false},
+		{"0s", "", 0, false},
+		{"", "", 0, false},
+		{"tomorrow", "", 0, false},
+	}
+	for _, tt := range tests {
+		wallet, duration, err := parseAddressExpiration(tt.expiration)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseAddressExpiration(%q) error = %v, valid = %v", tt.expiration, err, tt.valid)
+			continue
+		}
+		if wallet != tt.wallet || duration != tt.duration {
+			t.Errorf("parseAddressExpiration(%q) = %s, %v, want %s, %v", tt.expiration, wallet, duration, tt.wallet, tt.duration)
+		}
+	}
+}
+
+func TestAddressPool_RefillAndAllocate(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.Config.addresspoolsize = 3
+
+	wm.AddressPool.Maintain()
+	if n, err := wm.AddressPool.Size(); err != nil || n != 3 {
+		t.Fatalf("AddressPool.Size = %d, %v, want 3", n, err)
+	}
+
+	records, err := wm.AllocateAccountAddress("user-1", "", "72h", 2)
+	if err != nil {
+		t.Fatalf("AllocateAccountAddress failed unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("AllocateAccountAddress = %d records, want 2", len(records))
+	}
+	for _, r := range records {
+		if r.AccountID != "user-1" || r.Synced || r.ExpiredAt == 0 {
+			t.Errorf("record = %+v", r)
+		}
+	}
+	if n, _ := wm.AddressPool.Size(); n != 1 {
+		t.Errorf("AddressPool.Size after allocate = %d, want 1", n)
+	}
+
+	//维护后同步备注到钱包，并补充地址池
+	wm.AddressPool.Maintain()
+	comments := walletComments(srv)
+	for _, r := range records {
+		if comments[r.Address] != "user-1" {
+			t.Errorf("address %s comment = %s, want user-1", r.Address, comments[r.Address])
+		}
+		record, err := wm.GetAddressRecord(r.Address)
+		if err != nil || !record.Synced {
+			t.Errorf("GetAddressRecord = %+v, %v", record, err)
+		}
+	}
+	if n, _ := wm.AddressPool.Size(); n != 3 {
+		t.Errorf("AddressPool.Size after maintain = %d, want 3", n)
+	}
+
+	remote, err := wm.AllocateRemoteAccountAddress("user-2", "vip", "", 1)
+	if err != nil || len(remote) != 1 || remote[0].Comment != "vip" || remote[0].Expiration != AddressExpirationNever {
+		t.Errorf("AllocateRemoteAccountAddress in single mode = %+v, %v", remote, err)
+	}
+}
+
+func TestAddressPool_AllocateFallback(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.Config.addresspoolsize = 1
+
+	wm.AddressPool.Maintain()
+
+	//地址池不足时向钱包创建剩余地址
+	records, err := wm.AllocateAccountAddress("user-1", "", "", 3)
+	if err != nil {
+		t.Fatalf("AllocateAccountAddress failed unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("AllocateAccountAddress = %d records, want 3", len(records))
+	}
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if seen[r.Address] {
+			t.Errorf("address %s allocated twice", r.Address)
+		}
+		seen[r.Address] = true
+	}
+
+	comments := walletComments(srv)
+	if comments[records[1].Address] != "user-1" || comments[records[2].Address] != "user-1" {
+		t.Errorf("created addresses should be commented with account, got %v", comments)
+	}
+
+	if _, err = wm.AllocateAccountAddress("user-1", "", "sometime", 1); err == nil {
+		t.Errorf("AllocateAccountAddress with invalid expiration should fail")
+	}
+	if _, err = wm.AllocateAccountAddress("", "", "", 1); err == nil {
+		t.Errorf("AllocateAccountAddress without account id should fail")
+	}
+}
+
+func TestAddressPool_ExpireAddresses(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+
+	records, err := wm.CreateAccountAddress("user-1", "", "1h", 2, 2)
+	if err != nil {
+		t.Fatalf("CreateAccountAddress failed unexpected error: %v", err)
+	}
+
+	//模拟第一个地址已到期
+	records[0].ExpiredAt = time.Now().Add(-time.Minute).Unix()
+	if err = wm.SaveAddressRecord(records[0]); err != nil {
+		t.Fatalf("SaveAddressRecord failed unexpected error: %v", err)
+	}
+
+	wm.AddressPool.Maintain()
+
+	expired := make(map[string]bool)
+	for _, a := range srv.Addresses() {
+		expired[a.Address] = a.Expired
+	}
+	if !expired[records[0].Address] || expired[records[1].Address] {
+		t.Errorf("wallet expired = %v", expired)
+	}
+
+	record, err := wm.GetAddressRecord(records[0].Address)
+	if err != nil || !record.Expired {
+		t.Errorf("GetAddressRecord = %+v, %v", record, err)
+	}
+	record, err = wm.GetAddressRecord(records[1].Address)
+	if err != nil || record.Expired {
+		t.Errorf("GetAddressRecord = %+v, %v", record, err)
+	}
+}
+
+//walletComments 模拟钱包中的地址备注
+func walletComments(srv *beamtest.Server) map[string]string {
+	comments := make(map[string]string)
+	for _, a := range srv.Addresses() {
+		comments[a.Address] = a.Comment
+	}
+	return comments
+}
@@ -0,0 +1,261 @@
+package beam
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego/config"
+	"github.com/blocktree/openwallet/common/file"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	//审计日志结果摘要的最大长度
+	auditResultSummaryLength = 256
+	//审计日志单条记录的最大长度
+	auditEntryMaxLength = 4 * 1024 * 1024
+)
+
+//AuditEntry 审计日志记录，Hash为包含PrevHash在内的记录内容的sha256，前后记录组成哈希链
+type AuditEntry struct {
+	Seq      uint64 `json:"seq"`      //序号，从1开始连续递增
+	Time     int64  `json:"time"`     //请求时间，unix秒
+	NodeID   string `json:"nodeID"`   //调用方节点ID
+	NodeName string `json:"nodeName"` //调用方授信节点名称
+	Method   string `json:"method"`
+	Params   string `json:"params"`   //请求参数
+	Status   uint64 `json:"status"`   //响应状态码
+	Result   string `json:"result"`   //响应结果摘要
+	Error    string `json:"error"`    //失败原因
+	Latency  int64  `json:"latency"`  //处理耗时，毫秒
+	PrevHash string `json:"prevHash"` //上一条记录的Hash
+	Hash     string `json:"hash"`
+}
+
+//computeHash 计算记录的Hash
+func (e *AuditEntry) computeHash() string {
+	entry := *e
+	entry.Hash = ""
+	data, _ := json.Marshal(&entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+//AuditLog 只追加的审计日志文件，每行一条JSON记录
+type AuditLog struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	seq      uint64
+	lastHash string
+}
+
+//OpenAuditLog 打开审计日志文件，从最后一条记录继续追加
+func OpenAuditLog(path string) (*AuditLog, error) {
+
+	l := &AuditLog{
+		path: path,
+	}
+
+	err := readAuditLog(path, func(entry *AuditEntry) error {
+		l.seq = entry.Seq
+		l.lastHash = entry.Hash
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file.MkdirAll(filepath.Dir(path))
+
+	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %s failed, unexpected error: %v", path, err)
+	}
+
+	return l, nil
+}
+
+//Append 追加一条记录，填写序号和哈希链
+func (l *AuditLog) Append(entry *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	entry.Seq = l.seq + 1
+	entry.PrevHash = l.lastHash
+	entry.Hash = entry.computeHash()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+
+	err = l.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	l.seq = entry.Seq
+	l.lastHash = entry.Hash
+
+	return nil
+}
+
+//Close 关闭审计日志文件
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+//readAuditLog 按顺序读取审计日志的每条记录
+func readAuditLog(path string, fn func(entry *AuditEntry) error) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), auditEntryMaxLength)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		var entry AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return fmt.Errorf("audit log %s line %d is invalid: %v", path, line, err)
+		}
+		err = fn(&entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+//VerifyAuditLog 校验审计日志的哈希链，返回校验通过的记录数，记录被修改、删除或插入时返回出错的序号
+func VerifyAuditLog(path string) (uint64, error) {
+
+	var (
+		count    uint64
+		lastHash string
+	)
+
+	err := readAuditLog(path, func(entry *AuditEntry) error {
+		if entry.Seq != count+1 {
+			return fmt.Errorf("audit log entry %d is out of sequence, expect %d", entry.Seq, count+1)
+		}
+		if entry.PrevHash != lastHash {
+			return fmt.Errorf("audit log entry %d does not link to the previous entry", entry.Seq)
+		}
+		if entry.Hash != entry.computeHash() {
+			return fmt.Errorf("audit log entry %d hash mismatch", entry.Seq)
+		}
+		count++
+		lastHash = entry.Hash
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+//ExportAuditLog 导出时间范围[from, to]内的记录，每行一条JSON记录，from或to为零值时不限制。
+//导出前先校验哈希链
+func ExportAuditLog(path string, from, to time.Time, w io.Writer) (int, error) {
+
+	_, err := VerifyAuditLog(path)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	enc := json.NewEncoder(w)
+	err = readAuditLog(path, func(entry *AuditEntry) error {
+		if !from.IsZero() && entry.Time < from.Unix() {
+			return nil
+		}
+		if !to.IsZero() && entry.Time > to.Unix() {
+			return nil
+		}
+		n++
+		return enc.Encode(entry)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+//auditResultSummary 响应结果摘要，数组记录元素个数，其它截取JSON的前auditResultSummaryLength个字符
+func auditResultSummary(result interface{}) string {
+
+	if result == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("%T", result)
+	}
+
+	var list []json.RawMessage
+	if json.Unmarshal(data, &list) == nil {
+		return fmt.Sprintf("%d items", len(list))
+	}
+
+	if len(data) > auditResultSummaryLength {
+		return string(data[:auditResultSummaryLength]) + "..."
+	}
+
+	return string(data)
+}
+
+//LoadAuditLogConfig 加载审计日志配置
+func (wm *WalletManager) LoadAuditLogConfig(c config.Configer) {
+	wm.Config.enableauditlog = c.DefaultBool("enableauditlog", true)
+	if auditlogfile := c.String("auditlogfile"); len(auditlogfile) > 0 {
+		wm.Config.auditlogfile = auditlogfile
+	} else {
+		wm.Config.auditlogfile = filepath.Join(wm.Config.dbPath, wm.Config.AuditFile)
+	}
+}
+
+//VerifyAuditLog 校验服务端审计日志的哈希链
+func (wm *WalletManager) VerifyAuditLog() (uint64, error) {
+	return VerifyAuditLog(wm.Config.auditlogfile)
+}
+
+//ExportAuditLog 导出服务端时间范围内的审计日志
+func (wm *WalletManager) ExportAuditLog(from, to time.Time, w io.Writer) (int, error) {
+	return ExportAuditLog(wm.Config.auditlogfile, from, to, w)
+}
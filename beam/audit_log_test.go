@@ -0,0 +1,146 @@
+package beam
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/owtp"
+)
+
+func TestAuditLog_AppendAndVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+
+	l, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed unexpected error: %v", err)
+	}
+	base := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		entry := &AuditEntry{Time: base.AddDate(0, 0, i).Unix(), NodeID: "11111", Method: "getWalletBalance"}
+		if err = l.Append(entry); err != nil {
+			t.Fatalf("Append failed unexpected error: %v", err)
+		}
+	}
+	l.Close()
+
+	//重新打开后继续哈希链
+	l, err = OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed unexpected error: %v", err)
+	}
+	entry := &AuditEntry{Time: base.AddDate(0, 0, 3).Unix(), NodeID: "11111", Method: "createBatchAddress"}
+	if err = l.Append(entry); err != nil {
+		t.Fatalf("Append failed unexpected error: %v", err)
+	}
+	l.Close()
+	if entry.Seq != 4 || len(entry.PrevHash) == 0 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if err = l.Append(&AuditEntry{}); err == nil {
+		t.Errorf("Append to closed audit log should fail")
+	}
+
+	count, err := VerifyAuditLog(path)
+	if err != nil || count != 4 {
+		t.Fatalf("VerifyAuditLog = %d, %v", count, err)
+	}
+
+	//导出时间范围内的记录
+	var buf bytes.Buffer
+	n, err := ExportAuditLog(path, base.AddDate(0, 0, 1), base.AddDate(0, 0, 2), &buf)
+	if err != nil || n != 2 || strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("ExportAuditLog = %d, %v, %s", n, err, buf.String())
+	}
+	buf.Reset()
+	if n, err = ExportAuditLog(path, time.Time{}, time.Time{}, &buf); err != nil || n != 4 {
+		t.Errorf("ExportAuditLog all = %d, %v", n, err)
+	}
+}
+
+func TestAuditLog_Tampered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed unexpected error: %v", err)
+	}
+	for _, method := range []string{"getWalletBalance", "createBatchAddress", "getTransaction"} {
+		l.Append(&AuditEntry{Time: time.Now().Unix(), NodeID: "11111", Method: method})
+	}
+	l.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+
+	tests := []struct {
+		name    string
+		content string
+		valid   uint64
+		want    string
+	}{
+		{"modified", lines[0] + strings.Replace(lines[1], "createBatchAddress", "getWalletAddress", 1) + lines[2], 1, "entry 2 hash mismatch"},
+		{"deleted", lines[0] + lines[2], 1, "entry 3 is out of sequence"},
+		{"reordered", lines[1] + lines[0] + lines[2], 0, "entry 2 is out of sequence"},
+		{"invalid", lines[0] + "not json\n", 1, "line 2 is invalid"},
+	}
+	for _, tt := range tests {
+		ioutil.WriteFile(path, []byte(tt.content), 0600)
+		count, err := VerifyAuditLog(path)
+		if err == nil || count != tt.valid || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: VerifyAuditLog = %d, %v, want %d, %s", tt.name, count, err, tt.valid, tt.want)
+		}
+		if _, err = ExportAuditLog(path, time.Time{}, time.Time{}, ioutil.Discard); err == nil {
+			t.Errorf("%s: ExportAuditLog should fail", tt.name)
+		}
+	}
+}
+
+func TestAuditResultSummary(t *testing.T) {
+	tests := []struct {
+		result interface{}
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"a", "b"}, "2 items"},
+		{map[string]interface{}{"balance": "1"}, `{"balance":"1"}`},
+		{strings.Repeat("a", 300), `"` + strings.Repeat("a", auditResultSummaryLength-1) + "..."},
+	}
+	for _, tt := range tests {
+		if got := auditResultSummary(tt.result); got != tt.want {
+			t.Errorf("auditResultSummary(%v) = %s, want %s", tt.result, got, tt.want)
+		}
+	}
+}
+
+func TestServer_Audit(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+	wm.Config.trustnodes, _ = parseTrustNodes("", "auditor:33333:read")
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+
+	handler := server.authorize(testServerRoute(t, server, "getWalletAddress"))
+	handler(owtp.NewContext(1, 1, "33333", "getWalletAddress", []byte(`{}`)))
+	handler = server.authorize(testServerRoute(t, server, "createBatchAddress"))
+	handler(owtp.NewContext(1, 2, "33333", "createBatchAddress", []byte(`{"count":1,"workerSize":1}`)))
+	server.Close()
+
+	var buf bytes.Buffer
+	n, err := wm.ExportAuditLog(time.Time{}, time.Time{}, &buf)
+	if err != nil || n != 2 {
+		t.Fatalf("ExportAuditLog = %d, %v", n, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.Contains(lines[0], `"nodeName":"auditor","method":"getWalletAddress"`) || !strings.Contains(lines[0], `"status":200`) {
+		t.Errorf("audit entry = %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"method":"createBatchAddress","params":"{\"count\":1,\"workerSize\":1}"`) || !strings.Contains(lines[1], "no permission") {
+		t.Errorf("audit entry = %s", lines[1])
+	}
+}
@@ -1,6 +1,7 @@
 package beam
 
 import (
+	"fmt"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/common/file"
 	"github.com/blocktree/openwallet/log"
@@ -67,6 +68,59 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 	wm.Config.enablessl, _ = c.Bool("enablessl")
 	wm.Config.requesttimeout, _ = c.Int("requesttimeout")
 	wm.Config.trustnodeid = c.String("trustnodeid")
+	wm.Config.trustnodes, err = parseTrustNodes(wm.Config.trustnodeid, c.String("trustnodes"))
+	if err != nil {
+		return err
+	}
+	wm.Config.trustnodefile = c.String("trustnodefile")
+	wm.LoadAuditLogConfig(c)
+
+	wm.Config.noderatelimit = c.DefaultFloat("noderatelimit", 0)
+	if wm.Config.noderatelimit < 0 {
+		return fmt.Errorf("invalid node rate limit: %v", wm.Config.noderatelimit)
+	}
+	wm.Config.noderateburst = c.DefaultFloat("noderateburst", 0)
+	if wm.Config.noderateburst <= 0 {
+		wm.Config.noderateburst = 2 * wm.Config.noderatelimit
+	}
+	if wm.Config.noderateburst < 1 {
+		wm.Config.noderateburst = 1
+	}
+	wm.Config.methodratelimits, err = parseMethodRateLimits(c.String("methodratelimits"))
+	if err != nil {
+		return err
+	}
+
+	maxaddresspercall := c.DefaultInt64("maxaddresspercall", DefaultMaxAddressPerCall)
+	if maxaddresspercall < 0 {
+		return fmt.Errorf("invalid max address per call: %d", maxaddresspercall)
+	}
+	wm.Config.maxaddresspercall = uint64(maxaddresspercall)
+
+	maxaddressperday := c.DefaultInt64("maxaddressperday", 0)
+	if maxaddressperday < 0 {
+		return fmt.Errorf("invalid max address per day: %d", maxaddressperday)
+	}
+	wm.Config.maxaddressperday = uint64(maxaddressperday)
+
+	wm.Config.maxconcurrentwalletcalls = c.DefaultInt("maxconcurrentwalletcalls", 0)
+	if wm.Config.maxconcurrentwalletcalls < 0 {
+		return fmt.Errorf("invalid max concurrent wallet calls: %d", wm.Config.maxconcurrentwalletcalls)
+	}
+
+	wm.Config.enablepush, _ = c.Bool("enablepush")
+	wm.Config.pushperiod, err = parseDurationOrDefault(c.String("pushperiod"), DefaultPushPeriod)
+	if err != nil {
+		return err
+	}
+	wm.Config.pushbatchsize = c.DefaultInt("pushbatchsize", DefaultPushBatchSize)
+	if wm.Config.pushbatchsize <= 0 {
+		return fmt.Errorf("invalid push batch size: %d", wm.Config.pushbatchsize)
+	}
+	wm.Config.pushretention, err = parseDurationOrDefault(c.String("pushretention"), DefaultPushRetention)
+	if err != nil {
+		return err
+	}
 	wm.Config.cert = c.String("cert")
 	wm.Config.logdebug, _ = c.Bool("logdebug")
 	wm.Config.logdir = c.String("logdir")
@@ -77,6 +131,30 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 	wm.Config.walletdatafile = c.String("walletdatafile")
 	wm.Config.walletdatabackupdir = c.String("walletdatabackupdir")
 	wm.Config.enablesingle, _ = c.Bool("enablesingle")
+	wm.Config.validateaddressbywallet, _ = c.Bool("validateaddressbywallet")
+	wm.Config.enableaddressregistryscan, _ = c.Bool("enableaddressregistryscan")
+	if wm.Config.enableaddressregistryscan {
+		wm.Blockscanner.SetBlockScanTargetFunc(wm.AddressRegistryScanTarget())
+	}
+
+	wm.Config.addressexpiration = c.String("addressexpiration")
+	if len(wm.Config.addressexpiration) == 0 {
+		wm.Config.addressexpiration = AddressExpirationNever
+	}
+	if _, _, err = parseAddressExpiration(wm.Config.addressexpiration); err != nil {
+		return err
+	}
+
+	addresspoolsize, _ := c.Int64("addresspoolsize")
+	if addresspoolsize < 0 {
+		return fmt.Errorf("invalid address pool size: %d", addresspoolsize)
+	}
+	wm.Config.addresspoolsize = uint64(addresspoolsize)
+
+	wm.Config.addresspoolperiod, err = parseDurationOrDefault(c.String("addresspoolperiod"), DefaultAddressPoolPeriod)
+	if err != nil {
+		return err
+	}
 
 	txsendingtimeout := c.String("txsendingtimeout")
 	if len(txsendingtimeout) == 0 {
@@ -88,6 +166,106 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 		}
 	}
 
+	wm.Config.txtrackperiod, err = parseDurationOrDefault(c.String("txtrackperiod"), DefaultTxTrackPeriod)
+	if err != nil {
+		return err
+	}
+
+	wm.Config.txregisteringtimeout, err = parseDurationOrDefault(c.String("txregisteringtimeout"), DefaultTxRegisteringTimeout)
+	if err != nil {
+		return err
+	}
+
+	wm.Config.txnotfoundlimit = c.DefaultInt64("txnotfoundlimit", DefaultTxNotFoundLimit)
+	if wm.Config.txnotfoundlimit <= 0 {
+		wm.Config.txnotfoundlimit = DefaultTxNotFoundLimit
+	}
+
+	maxreorgdepth, _ := c.Int64("maxreorgdepth")
+	if maxreorgdepth <= 0 {
+		wm.Config.maxreorgdepth = DefaultMaxReorgDepth
+	} else {
+		wm.Config.maxreorgdepth = uint64(maxreorgdepth)
+	}
+
+	minconfirmations, _ := c.Int64("minconfirmations")
+	if minconfirmations < 0 {
+		minconfirmations = 0
+	}
+	wm.Config.minconfirmations = uint64(minconfirmations)
+
+	wm.Config.rpctimeout, err = parseDurationOrDefault(c.String("rpctimeout"), DefaultRPCTimeout)
+	if err != nil {
+		return err
+	}
+
+	wm.Config.rpcmaxretries, err = c.Int("rpcmaxretries")
+	if err != nil || wm.Config.rpcmaxretries < 0 {
+		wm.Config.rpcmaxretries = DefaultRPCMaxRetries
+	}
+
+	wm.Config.rpcretrybackoff, err = parseDurationOrDefault(c.String("rpcretrybackoff"), DefaultRPCRetryBackoff)
+	if err != nil {
+		return err
+	}
+
+	wm.walletClient.Timeout = wm.Config.rpctimeout
+	wm.walletClient.MaxRetries = wm.Config.rpcmaxretries
+	wm.walletClient.RetryBackoff = wm.Config.rpcretrybackoff
+
+	maxbatchaddresscount, err := c.Int64("maxbatchaddresscount")
+	if err != nil || maxbatchaddresscount <= 0 {
+		maxbatchaddresscount = DefaultMaxBatchAddressCount
+	}
+	wm.Config.maxbatchaddresscount = uint64(maxbatchaddresscount)
+
+	maxbatchaddressworker, err := c.Int64("maxbatchaddressworker")
+	if err != nil || maxbatchaddressworker <= 0 {
+		maxbatchaddressworker = DefaultMaxBatchAddressWorker
+	}
+	wm.Config.maxbatchaddressworker = uint64(maxbatchaddressworker)
+
+	wm.walletClient.MaxBatchAddressCount = wm.Config.maxbatchaddresscount
+	wm.walletClient.MaxBatchAddressWorker = wm.Config.maxbatchaddressworker
+
+	wm.Config.rpcuser = c.String("rpcuser")
+	wm.Config.rpcpassword = c.String("rpcpassword")
+	wm.Config.rpctoken = c.String("rpctoken")
+	wm.Config.rpccafile = c.String("rpccafile")
+	wm.Config.rpccertfile = c.String("rpccertfile")
+	wm.Config.rpckeyfile = c.String("rpckeyfile")
+	wm.Config.rpcinsecureskipverify, _ = c.Bool("rpcinsecureskipverify")
+
+	err = wm.walletClient.SetAuth(WalletAuth{
+		Username: wm.Config.rpcuser,
+		Password: wm.Config.rpcpassword,
+		Token:    wm.Config.rpctoken,
+	})
+	if err != nil {
+		return err
+	}
+
+	if wm.Config.rpcinsecureskipverify {
+		wm.Log.Warn("Wallet API TLS certificate verification is disabled, do not use it in production")
+	}
+
+	err = wm.walletClient.SetTLS(WalletTLSOptions{
+		CAFile:             wm.Config.rpccafile,
+		CertFile:           wm.Config.rpccertfile,
+		KeyFile:            wm.Config.rpckeyfile,
+		InsecureSkipVerify: wm.Config.rpcinsecureskipverify,
+	})
+	if err != nil {
+		return err
+	}
+
+	wm.Config.scannerstorage = c.String("scannerstorage")
+	switch wm.Config.scannerstorage {
+	case "", ScannerStorageStorm, ScannerStorageMemory, ScannerStorageSQLite:
+	default:
+		return fmt.Errorf("unknown scanner storage: %s", wm.Config.scannerstorage)
+	}
+
 	if wm.Config.enableserver {
 		wm.server, err = NewServer(wm)
 		if err != nil {
@@ -136,3 +314,11 @@ func (wm *WalletManager) GetAssetsLogger() *log.OWLogger {
 func (wm *WalletManager) GetSmartContractDecoder() openwallet.SmartContractDecoder {
 	return wm.ContractDecoder
 }
+
+//parseDurationOrDefault 解析时间配置，没有配置使用默认值
+func parseDurationOrDefault(value string, defaultValue time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
+}
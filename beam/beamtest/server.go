@@ -0,0 +1,1023 @@
+package beamtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//交易单状态，与Beam钱包API一致
+	TxStatusPending     = 0
+	TxStatusInProgress  = 1
+	TxStatusCanceled    = 2
+	TxStatusCompleted   = 3
+	TxStatusFailed      = 4
+	TxStatusRegistering = 5
+)
+
+const (
+	//UTXO状态，与Beam钱包API一致
+	UTXOStatusUnavailable = 0
+	UTXOStatusAvailable   = 1
+	UTXOStatusMaturing    = 2
+	UTXOStatusOutgoing    = 3
+	UTXOStatusIncoming    = 4
+	UTXOStatusSpent       = 6
+)
+
+const (
+	//JSON-RPC错误码，与Beam钱包API一致
+	ErrCodeInvalidRequest  = -32600
+	ErrCodeMethodNotFound  = -32601
+	ErrCodeInvalidParams   = -32602
+	ErrCodeInternalError   = -32603
+	ErrCodeInvalidTxStatus = -32001
+	ErrCodeInvalidAddress  = -32003
+	ErrCodeInvalidTxID     = -32004
+)
+
+//Block 模拟区块，字段与浏览器API的block接口一致
+type Block struct {
+	Chainwork  string  `json:"chainwork"`
+	Difficulty float64 `json:"difficulty"`
+	Found      bool    `json:"found"`
+	Hash       string  `json:"hash"`
+	Height     uint64  `json:"height"`
+	Prev       string  `json:"prev"`
+	Subsidy    uint64  `json:"subsidy"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+//Tx 模拟交易单，字段与钱包API的tx_status接口一致
+type Tx struct {
+	TxID       string `json:"txId"`
+	Comment    string `json:"comment"`
+	CreateTime int64  `json:"create_time"`
+	Fee        uint64 `json:"fee"`
+	Height     uint64 `json:"height"`
+	Income     bool   `json:"income"`
+	Kernel     string `json:"kernel"`
+	Receiver   string `json:"receiver"`
+	Sender     string `json:"sender"`
+	Status     int    `json:"status"`
+	Value      uint64 `json:"value"`
+}
+
+//Address 模拟钱包地址，字段与钱包API的addr_list接口一致
+type Address struct {
+	Address    string `json:"address"`
+	Comment    string `json:"comment"`
+	Category   string `json:"category"`
+	CreateTime int64  `json:"create_time"`
+	Duration   uint64 `json:"duration"`
+	Expired    bool   `json:"expired"`
+	Own        bool   `json:"own"`
+}
+
+//UTXO 模拟钱包中的币，字段与钱包API的get_utxo接口一致
+type UTXO struct {
+	ID         string `json:"id"`
+	Amount     uint64 `json:"amount"`
+	Type       string `json:"type"`
+	Maturity   uint64 `json:"maturity"`
+	CreateTxID string `json:"createTxId"`
+	SpentTxID  string `json:"spentTxId"`
+	Status     int    `json:"status"`
+}
+
+//WalletBalance 模拟钱包余额
+type WalletBalance struct {
+	Available uint64
+	Receiving uint64
+	Sending   uint64
+	Maturing  uint64
+	Locked    uint64
+}
+
+//SendRequest 记录一次tx_send请求
+type SendRequest struct {
+	TxID    string
+	From    string
+	Address string
+	Value   uint64
+	Fee     uint64
+	Comment string
+}
+
+//failure 预设的故障
+type failure struct {
+	httpStatus int
+	code       int
+	message    string
+	delay      time.Duration
+	times      int
+}
+
+//Server 进程内模拟的Beam钱包API和浏览器API服务
+type Server struct {
+	mu sync.Mutex
+
+	wallet   *httptest.Server
+	explorer *httptest.Server
+
+	blocks    []*Block //下标即高度，0号位不使用
+	forkSalt  int
+	txs       map[string]*Tx
+	addresses []*Address
+	utxos     []*UTXO
+	rejected  map[string]bool //validate_address认为无效的地址
+	balance   WalletBalance
+	sent      []*SendRequest
+	failures  map[string]*failure
+	calls     map[string]int
+	seq       uint64
+
+	authorization string
+}
+
+//NewServer 创建并启动模拟服务，链上初始只有创世区块
+func NewServer() *Server {
+	s := newServer()
+	s.wallet = httptest.NewServer(http.HandlerFunc(s.serveWallet))
+	s.explorer = httptest.NewServer(http.HandlerFunc(s.serveExplorer))
+	return s
+}
+
+//NewTLSServer 创建并启动HTTPS模拟服务，证书通过Certificate获取
+func NewTLSServer() *Server {
+	s := newServer()
+	s.wallet = httptest.NewTLSServer(http.HandlerFunc(s.serveWallet))
+	s.explorer = httptest.NewTLSServer(http.HandlerFunc(s.serveExplorer))
+	return s
+}
+
+func newServer() *Server {
+	s := &Server{
+		blocks:    []*Block{nil},
+		txs:       make(map[string]*Tx),
+		addresses: make([]*Address, 0),
+		utxos:     make([]*UTXO, 0),
+		rejected:  make(map[string]bool),
+		failures:  make(map[string]*failure),
+		calls:     make(map[string]int),
+	}
+	s.mineLocked(1)
+	return s
+}
+
+//Close 关闭模拟服务
+func (s *Server) Close() {
+	s.wallet.Close()
+	s.explorer.Close()
+}
+
+//WalletAPI 钱包API地址，对应配置文件walletapi
+func (s *Server) WalletAPI() string {
+	return s.wallet.URL + "/api/wallet"
+}
+
+//ExplorerAPI 浏览器API地址，对应配置文件explorerapi
+func (s *Server) ExplorerAPI() string {
+	return s.explorer.URL
+}
+
+//CertificatePEM HTTPS模拟服务的证书，钱包API和浏览器API的证书写在一起，可作为CA文件
+func (s *Server) CertificatePEM() []byte {
+	data := make([]byte, 0)
+	for _, srv := range []*httptest.Server{s.wallet, s.explorer} {
+		if cert := srv.Certificate(); cert != nil {
+			data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+	}
+	return data
+}
+
+//SetAuthorization 要求钱包API和浏览器API请求带上指定的Authorization头，否则返回401
+func (s *Server) SetAuthorization(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorization = value
+}
+
+/*********** 链上数据编排 ***********/
+
+//MineBlocks 在最长链上追加n个区块，返回新区块
+func (s *Server) MineBlocks(n int) []*Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mineLocked(n)
+}
+
+//Reorg 从height开始（含）丢弃原有区块并重新出n个块，
+//被丢弃区块中的交易回到Registering状态，等待重新打包
+func (s *Server) Reorg(height uint64, n int) []*Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if height <= 1 || height > s.tipLocked() {
+		panic(fmt.Sprintf("beamtest: can not reorg at height %d", height))
+	}
+
+	s.blocks = s.blocks[:height]
+	s.forkSalt++
+
+	for _, tx := range s.txs {
+		if tx.Height >= height {
+			tx.Height = 0
+			tx.Status = TxStatusRegistering
+		}
+	}
+
+	return s.mineLocked(n)
+}
+
+//Tip 最新区块
+func (s *Server) Tip() *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := *s.blocks[s.tipLocked()]
+	return &b
+}
+
+//BlockByHeight 获取最长链上指定高度的区块
+func (s *Server) BlockByHeight(height uint64) *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if height == 0 || height > s.tipLocked() {
+		return nil
+	}
+	b := *s.blocks[height]
+	return &b
+}
+
+//AddTransaction 添加一笔交易，TxID和Kernel为空时自动生成，
+//Height大于0时视为已打包的完成交易
+func (s *Server) AddTransaction(tx *Tx) *Tx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx.Height > s.tipLocked() {
+		panic(fmt.Sprintf("beamtest: height %d is above the tip", tx.Height))
+	}
+
+	if len(tx.TxID) == 0 {
+		tx.TxID = s.newIDLocked("tx")[:32]
+	}
+	if len(tx.Kernel) == 0 {
+		tx.Kernel = s.newIDLocked("kernel")
+	}
+	if tx.CreateTime == 0 {
+		tx.CreateTime = time.Now().Unix()
+	}
+	if tx.Height > 0 {
+		tx.Status = TxStatusCompleted
+	}
+
+	cp := *tx
+	s.txs[tx.TxID] = &cp
+	return tx
+}
+
+//ConfirmTx 把交易打包到指定高度，状态设为完成
+func (s *Server) ConfirmTx(txid string, height uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.txs[txid]
+	if !ok {
+		panic(fmt.Sprintf("beamtest: unknown tx %s", txid))
+	}
+	tx.Height = height
+	tx.Status = TxStatusCompleted
+}
+
+//SetTxStatus 修改交易状态
+func (s *Server) SetTxStatus(txid string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.txs[txid]
+	if !ok {
+		panic(fmt.Sprintf("beamtest: unknown tx %s", txid))
+	}
+	tx.Status = status
+}
+
+//Transaction 获取交易
+func (s *Server) Transaction(txid string) *Tx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.txs[txid]
+	if !ok {
+		return nil
+	}
+	cp := *tx
+	return &cp
+}
+
+//SetBalance 设置钱包余额
+func (s *Server) SetBalance(b WalletBalance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance = b
+}
+
+//Balance 当前钱包余额
+func (s *Server) Balance() WalletBalance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balance
+}
+
+//NewAddress 直接在钱包中创建一个自有地址
+func (s *Server) NewAddress(comment string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createAddressLocked(comment, 0).Address
+}
+
+//RejectAddress 令validate_address认为地址无效，模拟格式正确但公钥无效的地址
+func (s *Server) RejectAddress(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[address] = true
+}
+
+//Addresses 钱包中的所有地址
+func (s *Server) Addresses() []*Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Address, 0, len(s.addresses))
+	for _, a := range s.addresses {
+		cp := *a
+		list = append(list, &cp)
+	}
+	return list
+}
+
+//AddUTXO 添加一个币，ID为空时自动生成，Type为空时视为普通币
+func (s *Server) AddUTXO(utxo *UTXO) *UTXO {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(utxo.ID) == 0 {
+		utxo.ID = s.newIDLocked("utxo")
+	}
+	if len(utxo.Type) == 0 {
+		utxo.Type = "norm"
+	}
+
+	cp := *utxo
+	s.utxos = append(s.utxos, &cp)
+	return utxo
+}
+
+//SentTransactions 所有tx_send请求记录
+func (s *Server) SentTransactions() []*SendRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*SendRequest, len(s.sent))
+	copy(list, s.sent)
+	return list
+}
+
+/*********** 故障注入 ***********/
+
+//FailRPC 令接下来times次调用JSON-RPC方法method时，返回错误对象
+func (s *Server) FailRPC(method string, code int, message string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = &failure{code: code, message: message, times: times}
+}
+
+//FailHTTP 令接下来times次请求name时，返回HTTP状态码status。
+//name为JSON-RPC方法名或浏览器API路径，如：status，block
+func (s *Server) FailHTTP(name string, status int, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[name] = &failure{httpStatus: status, times: times}
+}
+
+//Delay 令接下来times次请求name时，延迟d后再正常响应，用于模拟钱包无响应。
+//客户端断开请求时提前结束等待
+func (s *Server) Delay(name string, d time.Duration, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[name] = &failure{delay: d, times: times}
+}
+
+//Calls 统计name被请求的次数，name为JSON-RPC方法名或浏览器API路径
+func (s *Server) Calls(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[name]
+}
+
+/*********** 内部实现 ***********/
+
+func (s *Server) tipLocked() uint64 {
+	return uint64(len(s.blocks) - 1)
+}
+
+func (s *Server) mineLocked(n int) []*Block {
+	mined := make([]*Block, 0, n)
+	for i := 0; i < n; i++ {
+		height := uint64(len(s.blocks))
+		prev := ""
+		timestamp := time.Now().Unix()
+		if height > 1 {
+			prev = s.blocks[height-1].Hash
+			timestamp = s.blocks[height-1].Timestamp + 60
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s_%d_%d", prev, height, s.forkSalt)))
+		b := &Block{
+			Chainwork:  fmt.Sprintf("0x%x", height*1000),
+			Difficulty: 1,
+			Found:      true,
+			Hash:       hex.EncodeToString(sum[:]),
+			Height:     height,
+			Prev:       prev,
+			Subsidy:    8000000000,
+			Timestamp:  timestamp,
+		}
+		s.blocks = append(s.blocks, b)
+		cp := *b
+		mined = append(mined, &cp)
+	}
+	return mined
+}
+
+func (s *Server) newIDLocked(prefix string) string {
+	s.seq++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s_%d", prefix, s.seq)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) createAddressLocked(comment string, duration uint64) *Address {
+	s.seq++
+	addr := &Address{
+		Address:    s.newIDLocked("address") + fmt.Sprintf("%03x", s.seq%4096),
+		Comment:    comment,
+		CreateTime: time.Now().Unix(),
+		Duration:   duration,
+		Own:        true,
+	}
+	s.addresses = append(s.addresses, addr)
+	return addr
+}
+
+//delayLocked 释放锁等待d，或直到客户端断开请求
+func (s *Server) delayLocked(r *http.Request, d time.Duration) {
+	s.mu.Unlock()
+	defer s.mu.Lock()
+	select {
+	case <-time.After(d):
+	case <-r.Context().Done():
+	}
+}
+
+//authorizedLocked 检查Authorization头
+func (s *Server) authorizedLocked(w http.ResponseWriter, r *http.Request) bool {
+	if len(s.authorization) > 0 && r.Header.Get("Authorization") != s.authorization {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+//takeFailure 消耗一次预设故障
+func (s *Server) takeFailure(name string) *failure {
+	s.calls[name]++
+	f, ok := s.failures[name]
+	if !ok {
+		return nil
+	}
+	f.times--
+	if f.times <= 0 {
+		delete(s.failures, name)
+	}
+	return f
+}
+
+func (s *Server) txJSON(tx *Tx) map[string]interface{} {
+	confirmations := uint64(0)
+	if tx.Height > 0 {
+		confirmations = s.tipLocked() - tx.Height + 1
+	}
+	return map[string]interface{}{
+		"txId":          tx.TxID,
+		"comment":       tx.Comment,
+		"confirmations": confirmations,
+		"create_time":   tx.CreateTime,
+		"fee":           tx.Fee,
+		"height":        tx.Height,
+		"income":        tx.Income,
+		"kernel":        tx.Kernel,
+		"receiver":      tx.Receiver,
+		"sender":        tx.Sender,
+		"status":        tx.Status,
+		"status_string": statusString(tx),
+		"value":         tx.Value,
+	}
+}
+
+func utxoJSON(utxo *UTXO) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            utxo.ID,
+		"amount":        utxo.Amount,
+		"type":          utxo.Type,
+		"maturity":      utxo.Maturity,
+		"createTxId":    utxo.CreateTxID,
+		"spentTxId":     utxo.SpentTxID,
+		"status":        utxo.Status,
+		"status_string": utxoStatusString(utxo.Status),
+	}
+}
+
+func utxoStatusString(status int) string {
+	switch status {
+	case UTXOStatusUnavailable:
+		return "unavailable"
+	case UTXOStatusAvailable:
+		return "available"
+	case UTXOStatusMaturing:
+		return "maturing"
+	case UTXOStatusOutgoing:
+		return "outgoing"
+	case UTXOStatusIncoming:
+		return "incoming"
+	case UTXOStatusSpent:
+		return "spent"
+	}
+	return "unknown"
+}
+
+func statusString(tx *Tx) string {
+	switch tx.Status {
+	case TxStatusPending:
+		return "pending"
+	case TxStatusInProgress:
+		if tx.Income {
+			return "waiting for sender"
+		}
+		return "waiting for receiver"
+	case TxStatusCanceled:
+		return "cancelled"
+	case TxStatusCompleted:
+		if tx.Income {
+			return "received"
+		}
+		return "sent"
+	case TxStatusFailed:
+		return "failed"
+	case TxStatusRegistering:
+		return "in progress"
+	}
+	return "unknown"
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+//serveWallet 钱包JSON-RPC接口
+func (s *Server) serveWallet(w http.ResponseWriter, r *http.Request) {
+
+	var body struct {
+		ID     interface{}     `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"error":   map[string]interface{}{"code": ErrCodeInvalidRequest, "message": "Invalid JSON-RPC."},
+		})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.authorizedLocked(w, r) {
+		return
+	}
+
+	if f := s.takeFailure(body.Method); f != nil && f.delay > 0 {
+		s.delayLocked(r, f.delay)
+	} else if f != nil {
+		if f.httpStatus > 0 {
+			w.WriteHeader(f.httpStatus)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      body.ID,
+			"error":   map[string]interface{}{"code": f.code, "message": f.message},
+		})
+		return
+	}
+
+	params := make(map[string]interface{})
+	if len(body.Params) > 0 && string(body.Params) != "null" {
+		decoder := json.NewDecoder(strings.NewReader(string(body.Params)))
+		decoder.UseNumber()
+		decoder.Decode(&params)
+	}
+
+	result, code, message := s.dispatchLocked(body.Method, params)
+
+	resp := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      body.ID,
+	}
+	if code != 0 {
+		resp["error"] = map[string]interface{}{"code": code, "message": message}
+	} else {
+		resp["result"] = result
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) dispatchLocked(method string, params map[string]interface{}) (interface{}, int, string) {
+	switch method {
+	case "create_address":
+		comment, _ := params["comment"].(string)
+		var duration uint64
+		if exp, _ := params["expiration"].(string); exp == "24h" {
+			duration = 24 * 60 * 60
+		}
+		return s.createAddressLocked(comment, duration).Address, 0, ""
+
+	case "addr_list":
+		own, _ := params["own"].(bool)
+		list := make([]*Address, 0)
+		for _, a := range s.addresses {
+			if a.Own == own {
+				list = append(list, a)
+			}
+		}
+		return list, 0, ""
+
+	case "validate_address":
+		address, _ := params["address"].(string)
+		valid := isHexAddress(address) && !s.rejected[address]
+		mine := false
+		if valid {
+			if a := s.findAddressLocked(address); a != nil && a.Own {
+				mine = true
+			}
+		}
+		return map[string]interface{}{"is_valid": valid, "is_mine": mine}, 0, ""
+
+	case "edit_address":
+		address, _ := params["address"].(string)
+		a := s.findAddressLocked(address)
+		if a == nil {
+			return nil, ErrCodeInvalidAddress, "Invalid address."
+		}
+		if comment, ok := params["comment"].(string); ok {
+			a.Comment = comment
+		}
+		switch exp, _ := params["expiration"].(string); exp {
+		case "":
+		case "expired":
+			a.Expired = true
+		case "never":
+			a.Expired = false
+			a.Duration = 0
+		case "24h":
+			a.Expired = false
+			a.Duration = 24 * 60 * 60
+			a.CreateTime = time.Now().Unix()
+		default:
+			return nil, ErrCodeInvalidParams, "Invalid parameters."
+		}
+		return "done", 0, ""
+
+	case "delete_address":
+		address, _ := params["address"].(string)
+		for i, a := range s.addresses {
+			if a.Address == address {
+				s.addresses = append(s.addresses[:i], s.addresses[i+1:]...)
+				return "done", 0, ""
+			}
+		}
+		return nil, ErrCodeInvalidAddress, "Invalid address."
+
+	case "tx_send":
+		value := paramUint(params, "value")
+		fee := paramUint(params, "fee")
+		to, _ := params["address"].(string)
+		from, _ := params["from"].(string)
+		comment, _ := params["comment"].(string)
+		txid, _ := params["txId"].(string)
+		if len(to) == 0 {
+			return nil, ErrCodeInvalidAddress, "Invalid address."
+		}
+		if _, exist := s.txs[txid]; exist {
+			return nil, ErrCodeInvalidTxID, "Transaction already exists."
+		}
+		if value+fee > s.balance.Available {
+			return nil, ErrCodeInternalError, "Not enough money."
+		}
+		if len(from) == 0 && len(s.addresses) > 0 {
+			from = s.addresses[0].Address
+		}
+		s.balance.Available -= value + fee
+		s.balance.Sending += value
+		if len(txid) == 0 {
+			txid = s.newIDLocked("tx")[:32]
+		}
+		tx := &Tx{
+			TxID:       txid,
+			Kernel:     s.newIDLocked("kernel"),
+			Comment:    comment,
+			CreateTime: time.Now().Unix(),
+			Fee:        fee,
+			Receiver:   to,
+			Sender:     from,
+			Status:     TxStatusInProgress,
+			Value:      value,
+		}
+		s.txs[tx.TxID] = tx
+		s.sent = append(s.sent, &SendRequest{
+			TxID:    tx.TxID,
+			From:    from,
+			Address: to,
+			Value:   value,
+			Fee:     fee,
+			Comment: comment,
+		})
+		return map[string]interface{}{"txId": tx.TxID}, 0, ""
+
+	case "tx_split":
+		coins, _ := params["coins"].([]interface{})
+		fee := paramUint(params, "fee")
+		if len(coins) == 0 {
+			return nil, ErrCodeInvalidParams, "Invalid parameters."
+		}
+		value := uint64(0)
+		for _, coin := range coins {
+			value += toUint(coin)
+		}
+		if value+fee > s.balance.Available {
+			return nil, ErrCodeInternalError, "Not enough money."
+		}
+		self := ""
+		if len(s.addresses) > 0 {
+			self = s.addresses[0].Address
+		}
+		s.balance.Available -= value + fee
+		s.balance.Receiving += value
+		tx := &Tx{
+			TxID:       s.newIDLocked("tx")[:32],
+			Kernel:     s.newIDLocked("kernel"),
+			CreateTime: time.Now().Unix(),
+			Fee:        fee,
+			Receiver:   self,
+			Sender:     self,
+			Status:     TxStatusInProgress,
+			Value:      value,
+		}
+		s.txs[tx.TxID] = tx
+		return map[string]interface{}{"txId": tx.TxID}, 0, ""
+
+	case "generate_tx_id":
+		return s.newIDLocked("tx")[:32], 0, ""
+
+	case "tx_status":
+		txid, _ := params["txId"].(string)
+		tx, ok := s.txs[txid]
+		if !ok {
+			return nil, ErrCodeInvalidTxID, "Invalid transaction ID."
+		}
+		return s.txJSON(tx), 0, ""
+
+	case "tx_cancel":
+		txid, _ := params["txId"].(string)
+		tx, ok := s.txs[txid]
+		if !ok {
+			return nil, ErrCodeInvalidTxID, "Invalid transaction ID."
+		}
+		if tx.Status != TxStatusPending && tx.Status != TxStatusInProgress {
+			return nil, ErrCodeInvalidTxStatus, "Invalid TX status."
+		}
+		tx.Status = TxStatusCanceled
+		if !tx.Income {
+			s.balance.Sending -= tx.Value
+			s.balance.Available += tx.Value + tx.Fee
+		}
+		return true, 0, ""
+
+	case "tx_delete":
+		txid, _ := params["txId"].(string)
+		tx, ok := s.txs[txid]
+		if !ok {
+			return nil, ErrCodeInvalidTxID, "Invalid transaction ID."
+		}
+		if tx.Status != TxStatusCanceled && tx.Status != TxStatusCompleted && tx.Status != TxStatusFailed {
+			return nil, ErrCodeInvalidTxStatus, "Invalid TX status."
+		}
+		delete(s.txs, txid)
+		return "done", 0, ""
+
+	case "tx_list":
+		return s.txListLocked(params), 0, ""
+
+	case "get_utxo":
+		start, end := paging(params, len(s.utxos))
+		result := make([]map[string]interface{}, 0, end-start)
+		for _, utxo := range s.utxos[start:end] {
+			result = append(result, utxoJSON(utxo))
+		}
+		return result, 0, ""
+
+	case "wallet_status":
+		tip := s.blocks[s.tipLocked()]
+		return map[string]interface{}{
+			"current_height":     tip.Height,
+			"current_state_hash": tip.Hash,
+			"prev_state_hash":    tip.Prev,
+			"available":          s.balance.Available,
+			"receiving":          s.balance.Receiving,
+			"sending":            s.balance.Sending,
+			"maturing":           s.balance.Maturing,
+			"locked":             s.balance.Locked,
+			"difficulty":         tip.Difficulty,
+		}, 0, ""
+	}
+
+	return nil, ErrCodeMethodNotFound, "Procedure not found."
+}
+
+func (s *Server) txListLocked(params map[string]interface{}) []map[string]interface{} {
+
+	filter, _ := params["filter"].(map[string]interface{})
+
+	list := make([]*Tx, 0)
+	for _, tx := range s.txs {
+		if filter != nil {
+			if _, ok := filter["status"]; ok && uint64(tx.Status) != paramUint(filter, "status") {
+				continue
+			}
+			if _, ok := filter["height"]; ok && tx.Height != paramUint(filter, "height") {
+				continue
+			}
+		}
+		list = append(list, tx)
+	}
+
+	//新的交易排在前面
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreateTime != list[j].CreateTime {
+			return list[i].CreateTime > list[j].CreateTime
+		}
+		return list[i].TxID < list[j].TxID
+	})
+
+	start, end := paging(params, len(list))
+	list = list[start:end]
+
+	result := make([]map[string]interface{}, 0, len(list))
+	for _, tx := range list {
+		result = append(result, s.txJSON(tx))
+	}
+	return result
+}
+
+//serveExplorer 浏览器API
+func (s *Server) serveExplorer(w http.ResponseWriter, r *http.Request) {
+
+	name := strings.Trim(r.URL.Path, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.authorizedLocked(w, r) {
+		return
+	}
+
+	if f := s.takeFailure(name); f != nil && f.delay > 0 {
+		s.delayLocked(r, f.delay)
+	} else if f != nil {
+		if f.httpStatus > 0 {
+			w.WriteHeader(f.httpStatus)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch name {
+	case "status":
+		tip := s.blocks[s.tipLocked()]
+		writeJSON(w, map[string]interface{}{
+			"chainwork":   tip.Chainwork,
+			"hash":        tip.Hash,
+			"height":      tip.Height,
+			"low_horizon": 0,
+			"timestamp":   tip.Timestamp,
+		})
+	case "block":
+		query := r.URL.Query()
+		if v := query.Get("height"); len(v) > 0 {
+			height, _ := strconv.ParseUint(v, 10, 64)
+			if height == 0 || height > s.tipLocked() {
+				writeJSON(w, map[string]interface{}{"found": false, "height": height})
+				return
+			}
+			writeJSON(w, s.blocks[height])
+			return
+		}
+		if v := query.Get("hash"); len(v) > 0 {
+			for _, b := range s.blocks[1:] {
+				if b.Hash == v {
+					writeJSON(w, b)
+					return
+				}
+			}
+			writeJSON(w, map[string]interface{}{"found": false})
+			return
+		}
+		if v := query.Get("kernel"); len(v) > 0 {
+			for _, tx := range s.txs {
+				if tx.Kernel == v && tx.Height > 0 {
+					writeJSON(w, s.blocks[tx.Height])
+					return
+				}
+			}
+			writeJSON(w, map[string]interface{}{"found": false})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+//paging 按skip和count参数计算分页范围
+func paging(params map[string]interface{}, n int) (int, int) {
+	start, end := uint64(0), uint64(n)
+	if _, ok := params["skip"]; ok {
+		start = paramUint(params, "skip")
+		if start > end {
+			start = end
+		}
+	}
+	if _, ok := params["count"]; ok {
+		if count := paramUint(params, "count"); start+count < end {
+			end = start + count
+		}
+	}
+	return int(start), int(end)
+}
+
+func (s *Server) findAddressLocked(address string) *Address {
+	for _, a := range s.addresses {
+		if a.Address == address {
+			return a
+		}
+	}
+	return nil
+}
+
+//isHexAddress SBBS地址为十六进制字符串
+func isHexAddress(address string) bool {
+	if len(address) < 64 || len(address) > 72 {
+		return false
+	}
+	for _, c := range address {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func paramUint(params map[string]interface{}, key string) uint64 {
+	return toUint(params[key])
+}
+
+func toUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := strconv.ParseUint(v.String(), 10, 64)
+		return n
+	case float64:
+		return uint64(v)
+	}
+	return 0
+}
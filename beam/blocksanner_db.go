@@ -2,103 +2,62 @@ package beam
 
 import (
 	"fmt"
-	"github.com/asdine/storm"
-	"path/filepath"
-	"strings"
 )
 
 //GetLocalNewBlock 获取本地记录的区块高度和hash
-func (wm *WalletManager) GetLocalNewBlock() (uint64, string) {
-
-	var (
-		blockHeight uint64 = 0
-		blockHash   string = ""
-	)
-
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+func (wm *WalletManager) GetLocalNewBlock() (uint64, string, error) {
+	storage, err := wm.ScannerStorage()
 	if err != nil {
-		return 0, ""
+		return 0, "", err
 	}
-	defer db.Close()
-
-	db.Get(blockchainBucket, "blockHeight", &blockHeight)
-	db.Get(blockchainBucket, "blockHash", &blockHash)
-
-	return blockHeight, blockHash
+	return storage.GetLocalNewBlock()
 }
 
 //SaveLocalNewBlock 记录区块高度和hash到本地
-func (wm *WalletManager) SaveLocalNewBlock(blockHeight uint64, blockHash string) {
-
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+func (wm *WalletManager) SaveLocalNewBlock(blockHeight uint64, blockHash string) error {
+	storage, err := wm.ScannerStorage()
 	if err != nil {
-		return
+		return err
 	}
-	defer db.Close()
-
-	db.Set(blockchainBucket, "blockHeight", &blockHeight)
-	db.Set(blockchainBucket, "blockHash", &blockHash)
+	return storage.SaveLocalNewBlock(blockHeight, blockHash)
 }
 
 //SaveLocalBlock 记录本地新区块
-func (wm *WalletManager) SaveLocalBlock(block *Block) {
-
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+func (wm *WalletManager) SaveLocalBlock(block *Block) error {
+	storage, err := wm.ScannerStorage()
 	if err != nil {
-		return
+		return err
 	}
-	defer db.Close()
-
-	db.Save(block)
+	return storage.SaveLocalBlock(block)
 }
 
-
-//GetLocalBlock 获取本地区块数据
-func (wm *WalletManager) GetLocalBlock(height uint64) (*Block, error) {
-
-	var (
-		block Block
-	)
-
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+//SaveScannedBlock 在同一事务中记录本地新区块并推进本地区块高度
+func (wm *WalletManager) SaveScannedBlock(block *Block) error {
+	storage, err := wm.ScannerStorage()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer db.Close()
+	return storage.SaveScannedBlock(block)
+}
 
-	err = db.One("Height", height, &block)
+//GetLocalBlock 获取本地区块数据
+func (wm *WalletManager) GetLocalBlock(height uint64) (*Block, error) {
+	storage, err := wm.ScannerStorage()
 	if err != nil {
 		return nil, err
 	}
-
-	return &block, nil
+	return storage.GetLocalBlock(height)
 }
 
 //DeleteUnscanRecord 删除指定高度的未扫记录
 func (wm *WalletManager) DeleteUnscanRecord(height uint64) error {
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	storage, err := wm.ScannerStorage()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-
-	var list []*UnscanRecord
-	err = db.Find("BlockHeight", height, &list)
-	if err != nil {
-		return err
-	}
-
-	for _, r := range list {
-		db.DeleteStruct(r)
-	}
-
-	return nil
+	return storage.DeleteUnscanRecord(height)
 }
 
-
 //SaveTxToWalletDB 保存交易记录到钱包数据库
 func (bs *BEAMBlockScanner) SaveUnscanRecord(record *UnscanRecord) error {
 
@@ -111,61 +70,105 @@ func (bs *BEAMBlockScanner) SaveUnscanRecord(record *UnscanRecord) error {
 		return nil
 	}
 
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(bs.wm.Config.dbPath, bs.wm.Config.BlockchainFile))
+	storage, err := bs.wm.ScannerStorage()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-
-	return db.Save(record)
+	return storage.SaveUnscanRecord(record)
 }
 
 //获取未扫记录
 func (wm *WalletManager) GetUnscanRecords() ([]*UnscanRecord, error) {
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	storage, err := wm.ScannerStorage()
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-
-	var list []*UnscanRecord
-	err = db.All(&list)
-	if err != nil {
-		return nil, err
-	}
-	return list, nil
+	return storage.GetUnscanRecords()
 }
 
-
 //DeleteUnscanRecordNotFindTX 删除未没有找到交易记录的重扫记录
 func (wm *WalletManager) DeleteUnscanRecordNotFindTX() error {
 
+	storage, err := wm.ScannerStorage()
+	if err != nil {
+		return err
+	}
+
 	//删除找不到交易单
-	reason := "[-5]No information available about transaction"
+	for _, code := range []int64{ErrCodeInvalidTxID, ErrCodeNoTxInformation} {
+		err = storage.DeleteUnscanRecordsByReason(rpcErrorReasonPrefix(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+//SaveBlockExtractDataRecords 记录已通知的区块提取结果
+func (wm *WalletManager) SaveBlockExtractDataRecords(records []*BlockExtractDataRecord) error {
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	storage, err := wm.ScannerStorage()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	return storage.SaveBlockExtractDataRecords(records)
+}
+
+//GetBlockExtractDataRecords 获取大于等于指定高度的已通知提取结果
+func (wm *WalletManager) GetBlockExtractDataRecords(fromHeight uint64) ([]*BlockExtractDataRecord, error) {
+	storage, err := wm.ScannerStorage()
+	if err != nil {
+		return nil, err
+	}
+	return storage.GetBlockExtractDataRecords(fromHeight)
+}
 
-	var list []*UnscanRecord
-	err = db.All(&list)
+//MarkBlockExtractDataRetracting 把大于等于指定高度的已通知提取结果标记为等待撤回
+func (wm *WalletManager) MarkBlockExtractDataRetracting(fromHeight uint64) error {
+	storage, err := wm.ScannerStorage()
 	if err != nil {
 		return err
 	}
+	return storage.MarkBlockExtractDataRetracting(fromHeight)
+}
+
+//GetRetractingBlockExtractDataRecords 获取等待撤回的提取结果
+func (wm *WalletManager) GetRetractingBlockExtractDataRecords() ([]*BlockExtractDataRecord, error) {
+	storage, err := wm.ScannerStorage()
+	if err != nil {
+		return nil, err
+	}
+	return storage.GetRetractingBlockExtractDataRecords()
+}
+
+//GetPendingBlockExtractDataRecords 获取小于等于指定高度的待确认提取结果
+func (wm *WalletManager) GetPendingBlockExtractDataRecords(maxHeight uint64) ([]*BlockExtractDataRecord, error) {
+	storage, err := wm.ScannerStorage()
+	if err != nil {
+		return nil, err
+	}
+	return storage.GetPendingBlockExtractDataRecords(maxHeight)
+}
 
-	tx, err := db.Begin(true)
+//DeleteBlockExtractDataRecord 删除已通知的提取结果
+func (wm *WalletManager) DeleteBlockExtractDataRecord(record *BlockExtractDataRecord) error {
+	storage, err := wm.ScannerStorage()
 	if err != nil {
 		return err
 	}
-	for _, r := range list {
-		if strings.HasPrefix(r.Reason, reason) {
-			tx.DeleteStruct(r)
-		}
+	return storage.DeleteBlockExtractDataRecord(record)
+}
+
+//DeleteLocalBlockDataBelow 删除低于指定高度的本地区块和已通知的提取结果，待确认和等待撤回的记录保留
+func (wm *WalletManager) DeleteLocalBlockDataBelow(height uint64) error {
+	storage, err := wm.ScannerStorage()
+	if err != nil {
+		return err
 	}
-	return tx.Commit()
-}
\ No newline at end of file
+	return storage.DeleteLocalBlockDataBelow(height)
+}
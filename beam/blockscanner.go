@@ -6,12 +6,14 @@ import (
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
 	"math/big"
+	"sync"
 )
 
 const (
 	blockchainBucket = "blockchain" // blockchain dataset
 	//periodOfTask      = 5 * time.Second // task interval
 	maxExtractingSize = 10 // thread count
+	maxScanningWindow = 10 // 追块时并发预取的区块数量
 )
 
 //BEAMBlockScanner BEAM block scanner
@@ -24,6 +26,30 @@ type BEAMBlockScanner struct {
 	RescanLastBlockCount uint64         //重扫上N个区块数量
 }
 
+//BlockExtractDataRetractObserver 区块提取结果撤回观测者。
+//观测者实现该接口后，区块分叉时会收到已通知的孤块提取结果的撤回通知，用于冲正入账
+type BlockExtractDataRetractObserver interface {
+
+	//BlockExtractDataRetractNotify 区块提取结果撤回通知
+	BlockExtractDataRetractNotify(sourceKey string, data *openwallet.TxExtractData) error
+}
+
+//BlockExtractDataPendingObserver 待确认提取结果观测者。
+//未达到minconfirmations的提取结果只通知实现该接口的观测者，其他观测者只在达到确认数后收到BlockExtractDataNotify
+type BlockExtractDataPendingObserver interface {
+
+	//BlockExtractDataPendingNotify 待确认的提取结果通知，不能作为入账依据
+	BlockExtractDataPendingNotify(sourceKey string, data *openwallet.TxExtractData) error
+}
+
+//BlockReorgAlertObserver 区块重组告警观测者。
+//区块重组深度超过maxreorgdepth时，扫描器无法自动回滚，观测者会收到告警通知
+type BlockReorgAlertObserver interface {
+
+	//BlockReorgAlertNotify 区块重组告警通知
+	BlockReorgAlertNotify(forkHeight uint64, maxReorgDepth uint64) error
+}
+
 //ExtractResult 扫描完成的提取结果
 type ExtractResult struct {
 	extractData map[string][]*openwallet.TxExtractData
@@ -32,6 +58,17 @@ type ExtractResult struct {
 	Success     bool
 }
 
+//prefetchResult 并发预取的区块数据
+type prefetchResult struct {
+	height         uint64
+	block          *Block
+	blockErr       error
+	remoteBlock    *Block
+	remoteBlockErr error
+	txs            []*Transaction
+	txsErr         error
+}
+
 //SaveResult result
 type SaveResult struct {
 	TxID        string
@@ -58,7 +95,7 @@ func NewBEAMBlockScanner(wm *WalletManager) *BEAMBlockScanner {
 
 //GetBalanceByAddress 查询地址余额
 func (bs *BEAMBlockScanner) GetBalanceByAddress(address ...string) ([]*openwallet.Balance, error) {
-	wallet, err := bs.wm.walletClient.GetWalletStatus()
+	wallet, err := bs.wm.walletClient.GetWalletStatus(bs.wm.context())
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +118,7 @@ func (bs *BEAMBlockScanner) GetBalanceByAddress(address ...string) ([]*openwalle
 //GetCurrentBlock 获取当前最新区块
 func (bs *BEAMBlockScanner) GetCurrentBlock() (*Block, error) {
 
-	wallet, err := bs.wm.walletClient.GetWalletStatus()
+	wallet, err := bs.wm.walletClient.GetWalletStatus(bs.wm.context())
 	if err != nil {
 		return nil, err
 	}
@@ -127,17 +164,15 @@ func (bs *BEAMBlockScanner) SetRescanBlockHeight(height uint64) error {
 		return err
 	}
 
-	bs.wm.SaveLocalNewBlock(height, block.Hash)
-
-	return nil
+	return bs.wm.SaveLocalNewBlock(height, block.Hash)
 }
 
 func (bs *BEAMBlockScanner) GetBlockByHash(hash string) (*Block, error) {
-	return bs.wm.walletClient.GetBlockByHash(hash)
+	return bs.wm.walletClient.GetBlockByHash(bs.wm.context(), hash)
 }
 
 func (bs *BEAMBlockScanner) GetBlockByHeight(height uint64) (*Block, error) {
-	return bs.wm.walletClient.GetBlockByHeight(height)
+	return bs.wm.walletClient.GetBlockByHeight(bs.wm.context(), height)
 }
 
 //GetScannedBlockHeader 获取当前扫描的区块头
@@ -150,7 +185,10 @@ func (bs *BEAMBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, er
 		err         error
 	)
 
-	blockHeight, hash = bs.wm.GetLocalNewBlock()
+	blockHeight, hash, err = bs.wm.GetLocalNewBlock()
+	if err != nil {
+		return nil, err
+	}
 
 	//如果本地没有记录，查询接口的高度
 	if blockHeight == 0 {
@@ -175,7 +213,10 @@ func (bs *BEAMBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, er
 
 //GetScannedBlockHeight 获取已扫区块高度
 func (bs *BEAMBlockScanner) GetScannedBlockHeight() uint64 {
-	localHeight, _ := bs.wm.GetLocalNewBlock()
+	localHeight, _, err := bs.wm.GetLocalNewBlock()
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not get local block height; unexpected error: %v", err)
+	}
 	return localHeight
 }
 
@@ -192,15 +233,23 @@ func (bs *BEAMBlockScanner) GetGlobalMaxBlockHeight() uint64 {
 
 //GetTransaction
 func (bs *BEAMBlockScanner) GetTransaction(hash string) (*Transaction, error) {
-	return bs.wm.walletClient.GetTransaction(hash)
+	return bs.wm.walletClient.GetTransaction(bs.wm.context(), hash)
 }
 
 //ScanBlockTask 扫描任务
 func (bs *BEAMBlockScanner) ScanBlockTask() {
 
+	if !bs.wm.lifecycle.enter() {
+		return
+	}
+	defer bs.wm.lifecycle.leave()
+
 	//:清除超时的交易单
 	bs.wm.ClearExpireTx()
 
+	//重发上次未完成的撤回通知
+	bs.retractNotify()
+
 	//获取本地区块高度
 	blockHeader, err := bs.GetScannedBlockHeader()
 	if err != nil {
@@ -211,6 +260,7 @@ func (bs *BEAMBlockScanner) ScanBlockTask() {
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
 
+scanning:
 	for {
 
 		if !bs.Scanning {
@@ -232,115 +282,144 @@ func (bs *BEAMBlockScanner) ScanBlockTask() {
 			break
 		}
 
-		//继续扫描下一个区块
-		currentHeight = currentHeight + 1
-
-		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
-
-		block, err := bs.GetBlockByHeight(currentHeight)
-		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
-
-			//记录未扫区块
-			unscanRecord := NewUnscanRecord(currentHeight, "", err.Error())
-			bs.SaveUnscanRecord(unscanRecord)
-			bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
-			continue
+		//追块时并发预取一个窗口的区块和交易单，再按高度顺序提交
+		window := maxHeight - currentHeight
+		if window > maxScanningWindow {
+			window = maxScanningWindow
 		}
 
-		remoteBlock, err := bs.wm.GetRemoteBlockByHeight(currentHeight)
-		if err != nil {
-			bs.wm.Log.Std.Error("remote server is disconnected")
-			break
+		if window > 1 {
+			bs.wm.Log.Std.Info("block scanner prefetching height: %d - %d ...", currentHeight+1, currentHeight+window)
 		}
 
-		if remoteBlock.Found == false {
-			bs.wm.Log.Std.Warn("remote server block is not synced to the same height of mainnet")
-			break
-		}
+		for _, prefetch := range bs.prefetchBlocks(currentHeight+1, window) {
 
-		if remoteBlock.Hash != block.Hash {
-			bs.wm.Log.Std.Warn("remote server block is not synced to the same hash of mainnet")
-			break
-		}
+			if !bs.Scanning {
+				//区块扫描器已暂停，马上结束本次任务
+				return
+			}
 
-		isFork := false
+			//继续扫描下一个区块
+			currentHeight = prefetch.height
 
-		//判断hash是否上一区块的hash
-		if currentHash != block.PrevBlockHash {
+			bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
 
-			bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
-			bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
-			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.PrevBlockHash)
+			block, err := prefetch.block, prefetch.blockErr
+			if err != nil {
+				bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
+				//记录未扫区块
+				unscanRecord := NewUnscanRecord(currentHeight, "", err.Error())
+				bs.SaveUnscanRecord(unscanRecord)
+				bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
+				continue
+			}
 
-			//查询本地分叉的区块
-			forkBlock, _ := bs.wm.GetLocalBlock(currentHeight - 1)
+			remoteBlock, err := prefetch.remoteBlock, prefetch.remoteBlockErr
+			if err != nil {
+				bs.wm.Log.Std.Error("remote server is disconnected")
+				break scanning
+			}
 
-			//删除上一区块链的所有充值记录
-			//bs.DeleteRechargesByHeight(currentHeight - 1)
-			//删除上一区块链的未扫记录
-			bs.wm.DeleteUnscanRecord(currentHeight - 1)
-			currentHeight = currentHeight - 2 //倒退2个区块重新扫描
-			if currentHeight <= 0 {
-				currentHeight = 1
+			if remoteBlock.Found == false {
+				bs.wm.Log.Std.Warn("remote server block is not synced to the same height of mainnet")
+				break scanning
 			}
 
-			localBlock, err := bs.wm.GetLocalBlock(currentHeight)
-			if err != nil {
-				bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
+			if remoteBlock.Hash != block.Hash {
+				bs.wm.Log.Std.Warn("remote server block is not synced to the same hash of mainnet")
+				break scanning
+			}
+
+			isFork := false
+
+			//判断hash是否上一区块的hash
+			if currentHash != block.PrevBlockHash {
 
-				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
+				bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
+				bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
+				bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.PrevBlockHash)
 
-				localBlock, err = bs.GetBlockByHeight(currentHeight)
+				forkHeight := currentHeight - 1
+
+				//查找本地与主链的共同祖先区块
+				ancestor, err := bs.findCommonAncestor(forkHeight)
 				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
+					bs.wm.Log.Std.Error("block scanner can not find common ancestor; unexpected error: %v", err)
+					break scanning
 				}
 
-			}
+				bs.wm.Log.Std.Info("block reorg depth: %d, common ancestor height: %d, hash: %s .", forkHeight-ancestor.Height, ancestor.Height, ancestor.Hash)
 
-			//重置当前区块的hash
-			currentHash = localBlock.Hash
+				//查询本地分叉的区块
+				forkBlocks := make([]*Block, 0)
+				for h := ancestor.Height + 1; h <= forkHeight; h++ {
+					forkBlock, _ := bs.wm.GetLocalBlock(h)
+					if forkBlock != nil {
+						forkBlocks = append(forkBlocks, forkBlock)
+					}
+					//删除分叉区块的未扫记录
+					bs.wm.DeleteUnscanRecord(h)
+				}
 
-			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
+				//从共同祖先重新扫描
+				currentHeight = ancestor.Height
+				currentHash = ancestor.Hash
 
-			//重新记录一个新扫描起点
-			bs.wm.SaveLocalNewBlock(localBlock.Height, localBlock.Hash)
+				//撤回孤块中已通知的提取结果，再重新扫描
+				bs.retractExtractData(currentHeight + 1)
 
-			isFork = true
+				bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
 
-			if forkBlock != nil {
+				//重新记录一个新扫描起点
+				err = bs.wm.SaveLocalNewBlock(currentHeight, currentHash)
+				if err != nil {
+					bs.wm.Log.Std.Error("block scanner can not save local block height; unexpected error: %v", err)
+					return
+				}
 
-				//通知分叉区块给观测者，异步处理
-				bs.newBlockNotify(forkBlock, isFork)
-			}
+				isFork = true
 
-		} else {
+				for _, forkBlock := range forkBlocks {
+					//通知分叉区块给观测者，异步处理
+					bs.newBlockNotify(forkBlock, isFork)
+				}
 
-			err = bs.BatchExtractTransaction(block.Height, block.Hash)
-			if err != nil {
-				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
-				return
-			}
+				//预取的后续区块基于旧的扫描起点，丢弃后重新预取
+				continue scanning
+			} else {
+
+				err = prefetch.txsErr
+				if err == nil {
+					err = bs.extractTransactions(block.Height, block.Hash, prefetch.txs)
+				}
+				if err != nil {
+					bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+					return
+				}
 
-			//重置当前区块的hash
-			currentHash = block.Hash
+				//重置当前区块的hash
+				currentHash = block.Hash
 
-			//保存本地新高度
-			bs.wm.SaveLocalNewBlock(currentHeight, currentHash)
-			bs.wm.SaveLocalBlock(block)
+				//保存本地新区块和新高度
+				err = bs.wm.SaveScannedBlock(block)
+				if err != nil {
+					bs.wm.Log.Std.Error("block scanner can not save local block; unexpected error: %v", err)
+					return
+				}
 
-			isFork = false
+				isFork = false
 
-			//通知新区块给观测者，异步处理
-			bs.newBlockNotify(block, isFork)
-		}
+				//通知新区块给观测者，异步处理
+				bs.newBlockNotify(block, isFork)
+			}
 
+		}
 	}
 
+	//通知达到确认数的提取结果
+	bs.confirmNotify(currentHeight)
+
 	//重扫前N个块，为保证记录找到
 	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
 		bs.scanBlock(i)
@@ -349,6 +428,99 @@ func (bs *BEAMBlockScanner) ScanBlockTask() {
 	//重扫失败区块
 	bs.RescanFailedRecord()
 
+	//清理超出最大重组深度的本地区块数据
+	if currentHeight > bs.wm.Config.maxreorgdepth {
+		err = bs.wm.DeleteLocalBlockDataBelow(currentHeight - bs.wm.Config.maxreorgdepth)
+		if err != nil {
+			bs.wm.Log.Std.Error("block scanner can not prune local block data; unexpected error: %v", err)
+		}
+	}
+}
+
+//findCommonAncestor 从分叉高度往回查找本地与主链的共同祖先区块，重组深度超过maxreorgdepth时告警
+func (bs *BEAMBlockScanner) findCommonAncestor(forkHeight uint64) (*Block, error) {
+
+	maxReorgDepth := bs.wm.Config.maxreorgdepth
+
+	for depth := uint64(1); depth < forkHeight; depth++ {
+
+		if depth > maxReorgDepth {
+			bs.reorgAlert(forkHeight, maxReorgDepth)
+			return nil, fmt.Errorf("block reorg on height: %d is deeper than max reorg depth: %d", forkHeight, maxReorgDepth)
+		}
+
+		height := forkHeight - depth
+
+		mainBlock, err := bs.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+
+		localBlock, err := bs.wm.GetLocalBlock(height)
+		if err != nil {
+			//本地没有记录，已是扫描起点之前的区块，以主链为准
+			bs.wm.Log.Std.Info("block height: %d has no local record, use mainnet block as common ancestor.", height)
+			return mainBlock, nil
+		}
+
+		if localBlock.Hash == mainBlock.Hash {
+			return localBlock, nil
+		}
+
+		bs.wm.Log.Std.Info("block height: %d local hash = %s, mainnet hash = %s ", height, localBlock.Hash, mainBlock.Hash)
+	}
+
+	return nil, fmt.Errorf("block reorg on height: %d can not find common ancestor", forkHeight)
+}
+
+//reorgAlert 区块重组深度超过maxreorgdepth，扫描器停在分叉处，需要人工处理
+func (bs *BEAMBlockScanner) reorgAlert(forkHeight, maxReorgDepth uint64) {
+
+	bs.wm.Log.Errorf("ALERT: block reorg on height: %d is deeper than max reorg depth: %d, block scanner stop on the fork until rescan height is reset", forkHeight, maxReorgDepth)
+
+	for o, _ := range bs.Observers {
+		alerter, ok := o.(BlockReorgAlertObserver)
+		if !ok {
+			continue
+		}
+		err := alerter.BlockReorgAlertNotify(forkHeight, maxReorgDepth)
+		if err != nil {
+			bs.wm.Log.Error("BlockReorgAlertNotify unexpected error:", err)
+		}
+	}
+}
+
+//prefetchBlocks 并发获取从指定高度开始的size个区块、远程区块和交易单，结果按高度排序
+func (bs *BEAMBlockScanner) prefetchBlocks(fromHeight, size uint64) []*prefetchResult {
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]*prefetchResult, size)
+	)
+
+	for i := uint64(0); i < size; i++ {
+		wg.Add(1)
+		go func(index uint64) {
+			defer wg.Done()
+
+			result := &prefetchResult{height: fromHeight + index}
+			result.block, result.blockErr = bs.GetBlockByHeight(result.height)
+			if result.blockErr == nil {
+				if bs.wm.client != nil && bs.wm.Config.enablepush {
+					//开启推送时，服务端自行扫描托管钱包，不再比对服务端的区块
+					result.remoteBlock = result.block
+				} else {
+					result.remoteBlock, result.remoteBlockErr = bs.wm.GetRemoteBlockByHeight(result.height)
+				}
+				result.txs, result.txsErr = bs.wm.GetTransactionsByHeight(result.height)
+			}
+			results[index] = result
+		}(i)
+	}
+
+	wg.Wait()
+
+	return results
 }
 
 //ScanBlock 扫描指定高度区块
@@ -454,6 +626,18 @@ func (bs *BEAMBlockScanner) newBlockNotify(block *Block, isFork bool) {
 //bitcoin 1M的区块链可以容纳3000笔交易，批量多线程处理，速度更快
 func (bs *BEAMBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash string) error {
 
+	// 获取查找本地交易单和远程服务上的交易单
+	txs, err := bs.wm.GetTransactionsByHeight(blockHeight)
+	if err != nil {
+		return err
+	}
+
+	return bs.extractTransactions(blockHeight, blockHash, txs)
+}
+
+//extractTransactions 多线程提取区块的交易单，并通知给观测者
+func (bs *BEAMBlockScanner) extractTransactions(blockHeight uint64, blockHash string, txs []*Transaction) error {
+
 	var (
 		quit       = make(chan struct{})
 		done       = 0 //完成标记
@@ -461,12 +645,6 @@ func (bs *BEAMBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 		shouldDone = 0 //需要完成的总数
 	)
 
-	// 获取查找本地交易单和远程服务上的交易单
-	txs, err := bs.wm.GetTransactionsByHeight(blockHeight)
-	if err != nil {
-		return err
-	}
-
 	if len(txs) == 0 {
 		return nil
 	}
@@ -760,26 +938,186 @@ func (bs *BEAMBlockScanner) extractTxOutput(tx *Transaction, txExtractData *open
 	txExtractData.TxOutputs = append(txExtractData.TxOutputs, txOutput)
 }
 
-//newExtractDataNotify 发送通知
+//newExtractDataNotify 发送通知，通知失败时记录未扫区块，由重扫任务重新通知，不影响扫描进度
 //发送通知
 func (bs *BEAMBlockScanner) newExtractDataNotify(height uint64, extractData map[string][]*openwallet.TxExtractData) error {
+
+	//按已扫描高度计算确认数，未达到minconfirmations的先以待确认状态通知
+	scannedHeight, _, err := bs.wm.GetLocalNewBlock()
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not get local block height; unexpected error: %v", err)
+	}
+
+	err = bs.extractDataRecordsNotify(height, scannedHeight, extractData)
+	if err != nil {
+		//记录未扫区块
+		unscanRecord := NewUnscanRecord(height, "", "ExtractData Notify failed.")
+		err = bs.SaveUnscanRecord(unscanRecord)
+		if err != nil {
+			bs.wm.Log.Std.Error("block height: %d, save unscan record failed. unexpected error: %v", height, err.Error())
+		}
+	}
+	return nil
+}
+
+//extractDataRecordsNotify 按已扫描高度记录提取结果并通知观测者，返回最后一个通知失败的错误
+func (bs *BEAMBlockScanner) extractDataRecordsNotify(height, scannedHeight uint64, extractData map[string][]*openwallet.TxExtractData) error {
+
+	//记录已通知的提取结果，分叉时用于撤回，待确认的达到确认数后再次通知
+	records := make([]*BlockExtractDataRecord, 0)
+	for key, array := range extractData {
+		for _, data := range array {
+			record := NewBlockExtractDataRecord(height, key, data)
+			bs.setConfirmState(record, scannedHeight)
+			records = append(records, record)
+		}
+	}
+	err := bs.wm.SaveBlockExtractDataRecords(records)
+	if err != nil {
+		bs.wm.Log.Std.Error("block height: %d, save extract data records failed. unexpected error: %v", height, err)
+	}
+
+	var notifyErr error
+	for _, r := range records {
+		err := bs.extractDataNotify(r)
+		if err != nil {
+			notifyErr = err
+		}
+	}
+	return notifyErr
+}
+
+//extractDataNotify 通知观测者提取结果，待确认的只通知BlockExtractDataPendingObserver，返回最后一个通知失败的错误
+func (bs *BEAMBlockScanner) extractDataNotify(r *BlockExtractDataRecord) error {
+
+	var notifyErr error
 	for o, _ := range bs.Observers {
-		for key, array := range extractData {
-			for _, data := range array {
-				err := o.BlockExtractDataNotify(key, data)
-				if err != nil {
-					bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
-					//记录未扫区块
-					unscanRecord := NewUnscanRecord(height, "", "ExtractData Notify failed.")
-					err = bs.SaveUnscanRecord(unscanRecord)
-					if err != nil {
-						bs.wm.Log.Std.Error("block height: %d, save unscan record failed. unexpected error: %v", height, err.Error())
-					}
-				}
+		if r.Confirmed {
+			err := o.BlockExtractDataNotify(r.SourceKey, r.Data)
+			if err != nil {
+				bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
+				notifyErr = err
 			}
+			continue
+		}
+
+		pending, ok := o.(BlockExtractDataPendingObserver)
+		if !ok {
+			continue
+		}
+		err := pending.BlockExtractDataPendingNotify(r.SourceKey, r.Data)
+		if err != nil {
+			bs.wm.Log.Error("BlockExtractDataPendingNotify unexpected error:", err)
+			notifyErr = err
+		}
+	}
+	return notifyErr
+}
+
+//setConfirmState 按已扫描高度设置提取结果的确认数和确认状态
+func (bs *BEAMBlockScanner) setConfirmState(record *BlockExtractDataRecord, scannedHeight uint64) {
+
+	var confirmations uint64 = 0
+	if scannedHeight > record.BlockHeight {
+		confirmations = scannedHeight - record.BlockHeight
+	}
+
+	record.Confirmed = confirmations >= bs.wm.Config.minconfirmations
+
+	data := record.Data
+	if data.Transaction != nil {
+		data.Transaction.Confirm = int64(confirmations)
+		data.Transaction.SetExtParam("confirmed", record.Confirmed)
+	}
+	for _, input := range data.TxInputs {
+		input.Confirm = int64(confirmations)
+	}
+	for _, output := range data.TxOutputs {
+		output.Confirm = int64(confirmations)
+	}
+}
+
+//confirmNotify 待确认的提取结果达到minconfirmations后，以确认状态再次通知，失败的下次扫描任务重发
+func (bs *BEAMBlockScanner) confirmNotify(scannedHeight uint64) {
+
+	if scannedHeight < bs.wm.Config.minconfirmations {
+		return
+	}
+
+	list, err := bs.wm.GetPendingBlockExtractDataRecords(scannedHeight - bs.wm.Config.minconfirmations)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not get pending extract data; unexpected error: %v", err)
+		return
+	}
+
+	for _, r := range list {
+		bs.setConfirmState(r, scannedHeight)
+
+		if bs.extractDataNotify(r) != nil {
+			continue
+		}
+
+		bs.wm.Log.Std.Info("block height: %d, tx: %s of %s has been confirmed.", r.BlockHeight, r.TxID, r.SourceKey)
+
+		err = bs.wm.SaveBlockExtractDataRecords([]*BlockExtractDataRecord{r})
+		if err != nil {
+			bs.wm.Log.Std.Error("save confirmed extract data failed. unexpected error: %v", err)
+		}
+	}
+}
+
+//retractExtractData 区块分叉，撤回大于等于指定高度的已通知提取结果
+func (bs *BEAMBlockScanner) retractExtractData(fromHeight uint64) {
+
+	bs.wm.Log.Std.Info("retract extract data from block height: %d.", fromHeight)
+
+	err := bs.wm.MarkBlockExtractDataRetracting(fromHeight)
+	if err != nil {
+		bs.wm.Log.Std.Error("block height: %d, mark extract data retracting failed. unexpected error: %v", fromHeight, err)
+		return
+	}
+
+	bs.retractNotify()
+}
+
+//retractNotify 发送等待撤回的提取结果通知，全部观测者通知成功后删除记录，失败的下次扫描任务重发
+func (bs *BEAMBlockScanner) retractNotify() {
+
+	list, err := bs.wm.GetRetractingBlockExtractDataRecords()
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not get retracting extract data; unexpected error: %v", err)
+		return
+	}
+
+	for _, r := range list {
+		success := true
+		for o, _ := range bs.Observers {
+			retractor, ok := o.(BlockExtractDataRetractObserver)
+			if !ok {
+				continue
+			}
+			//待确认的提取结果只通知过BlockExtractDataPendingObserver
+			if _, pending := o.(BlockExtractDataPendingObserver); !r.Confirmed && !pending {
+				continue
+			}
+			err = retractor.BlockExtractDataRetractNotify(r.SourceKey, r.Data)
+			if err != nil {
+				bs.wm.Log.Error("BlockExtractDataRetractNotify unexpected error:", err)
+				success = false
+			}
+		}
+
+		if !success {
+			continue
+		}
+
+		bs.wm.Log.Std.Info("block height: %d, tx: %s of %s has been retracted.", r.BlockHeight, r.TxID, r.SourceKey)
+
+		err = bs.wm.DeleteBlockExtractDataRecord(r)
+		if err != nil {
+			bs.wm.Log.Std.Error("delete retracted extract data failed. unexpected error: %v", err)
 		}
 	}
-	return nil
 }
 
 //ExtractTransactionData
@@ -0,0 +1,429 @@
+package beam
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+func TestBEAMBlockScanner_Mock_ScanBlockTask(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(3)
+
+	deposit := srv.AddTransaction(&beamtest.Tx{
+		Sender:   "outside",
+		Receiver: "user-address",
+		Value:    150000000,
+		Fee:      100,
+		Height:   3,
+		Income:   true,
+	})
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{"user-address": "user"}))
+	observer := newTestObserver()
+	bs.AddObserver(observer)
+
+	if err := bs.SetRescanBlockHeight(2); err != nil {
+		t.Fatalf("SetRescanBlockHeight failed unexpected error: %v", err)
+	}
+
+	bs.Scanning = true
+	bs.ScanBlockTask()
+
+	tip := srv.Tip()
+	height, hash, _ := wm.GetLocalNewBlock()
+	if height != tip.Height || hash != tip.Hash {
+		t.Errorf("local new block = %d:%s, want %d:%s", height, hash, tip.Height, tip.Hash)
+	}
+
+	headers := observer.waitHeaders(t, 3)
+	for i, header := range headers {
+		if header.Height != uint64(i+2) || header.Fork {
+			t.Errorf("header[%d] = %+v", i, header)
+		}
+	}
+
+	data := observer.extractData("user")
+	if len(data) != 1 {
+		t.Fatalf("user extract data count = %d, want 1", len(data))
+	}
+	if data[0].Transaction.TxID != deposit.TxID || data[0].Transaction.Amount != "1.5" {
+		t.Errorf("extract transaction = %+v", data[0].Transaction)
+	}
+	if len(data[0].TxOutputs) != 1 || data[0].TxOutputs[0].Address != "user-address" {
+		t.Errorf("extract outputs = %+v", data[0].TxOutputs)
+	}
+	if len(data[0].TxInputs) != 0 {
+		t.Errorf("deposit should not extract inputs: %+v", data[0].TxInputs)
+	}
+}
+
+func TestBEAMBlockScanner_Mock_Fork(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(4)
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{}))
+	observer := newTestObserver()
+	bs.AddObserver(observer)
+
+	bs.SetRescanBlockHeight(2)
+	bs.Scanning = true
+	bs.ScanBlockTask()
+	observer.waitHeaders(t, 4)
+
+	orphan := srv.Tip()
+
+	//替换最新的区块，并出更多的块
+	srv.Reorg(5, 2)
+	bs.ScanBlockTask()
+
+	tip := srv.Tip()
+	height, hash, _ := wm.GetLocalNewBlock()
+	if height != tip.Height || hash != tip.Hash {
+		t.Errorf("local new block = %d:%s, want %d:%s", height, hash, tip.Height, tip.Hash)
+	}
+
+	//分叉的孤块通知给观测者
+	var forkHeader *openwallet.BlockHeader
+	for _, header := range observer.waitHeaders(t, 7) {
+		if header.Fork {
+			forkHeader = header
+		}
+	}
+	if forkHeader == nil || forkHeader.Height != orphan.Height || forkHeader.Hash != orphan.Hash {
+		t.Errorf("fork header = %+v, want %d:%s", forkHeader, orphan.Height, orphan.Hash)
+	}
+}
+
+func TestBEAMBlockScanner_Mock_ForkRetraction(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(4)
+
+	deposit := srv.AddTransaction(&beamtest.Tx{
+		Sender:   "outside",
+		Receiver: "user-address",
+		Value:    100000000,
+		Height:   4,
+		Income:   true,
+	})
+	kept := srv.AddTransaction(&beamtest.Tx{
+		Sender:   "outside",
+		Receiver: "user-address",
+		Value:    200000000,
+		Height:   3,
+		Income:   true,
+	})
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{"user-address": "user"}))
+	observer := newTestObserver()
+	bs.AddObserver(observer)
+
+	bs.SetRescanBlockHeight(2)
+	bs.Scanning = true
+	bs.ScanBlockTask()
+	observer.waitHeaders(t, 3)
+
+	if n := len(observer.extractData("user")); n != 2 {
+		t.Fatalf("user extract data count = %d, want 2", n)
+	}
+
+	//撤回通知第一次失败，下次扫描任务重发
+	failed := false
+	observer.retractFn = func(sourceKey string, data *openwallet.TxExtractData) error {
+		if !failed {
+			failed = true
+			return fmt.Errorf("ledger unavailable")
+		}
+		return nil
+	}
+
+	srv.Reorg(4, 3)
+	bs.ScanBlockTask()
+
+	if len(observer.retractedData("user")) != 0 {
+		t.Fatalf("failed retraction should not be recorded")
+	}
+	records, err := wm.GetBlockExtractDataRecords(4)
+	if err != nil {
+		t.Fatalf("GetBlockExtractDataRecords failed unexpected error: %v", err)
+	}
+	if len(records) != 1 || !records[0].Retracting || records[0].TxID != deposit.TxID {
+		t.Fatalf("retracting records = %+v", records)
+	}
+
+	bs.ScanBlockTask()
+
+	retracted := observer.retractedData("user")
+	if len(retracted) != 1 || retracted[0].Transaction.TxID != deposit.TxID {
+		t.Fatalf("retracted = %+v", retracted)
+	}
+
+	//未分叉区块的记录保留
+	records, err = wm.GetBlockExtractDataRecords(0)
+	if err != nil {
+		t.Fatalf("GetBlockExtractDataRecords failed unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].TxID != kept.TxID || records[0].Retracting {
+		t.Errorf("remaining records = %+v", records)
+	}
+}
+
+func TestBEAMBlockScanner_Mock_DeepReorg(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(10)
+
+	deposit := srv.AddTransaction(&beamtest.Tx{
+		Sender:   "outside",
+		Receiver: "user-address",
+		Value:    100000000,
+		Height:   7,
+		Income:   true,
+	})
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{"user-address": "user"}))
+	observer := newTestObserver()
+	bs.AddObserver(observer)
+
+	bs.SetRescanBlockHeight(2)
+	bs.Scanning = true
+	bs.ScanBlockTask()
+	observer.waitHeaders(t, 10)
+
+	orphans := make(map[uint64]string)
+	for h := uint64(6); h <= 11; h++ {
+		orphans[h] = srv.BlockByHeight(h).Hash
+	}
+
+	//重组6个区块
+	srv.Reorg(6, 7)
+	bs.ScanBlockTask()
+
+	tip := srv.Tip()
+	height, hash, _ := wm.GetLocalNewBlock()
+	if height != tip.Height || hash != tip.Hash {
+		t.Errorf("local new block = %d:%s, want %d:%s", height, hash, tip.Height, tip.Hash)
+	}
+
+	forks := 0
+	for _, header := range observer.waitHeaders(t, 10+6+7) {
+		if !header.Fork {
+			continue
+		}
+		forks++
+		if orphans[header.Height] != header.Hash {
+			t.Errorf("fork header = %d:%s, want %s", header.Height, header.Hash, orphans[header.Height])
+		}
+	}
+	if forks != len(orphans) {
+		t.Errorf("fork header count = %d, want %d", forks, len(orphans))
+	}
+
+	retracted := observer.retractedData("user")
+	if len(retracted) != 1 || retracted[0].Transaction.TxID != deposit.TxID {
+		t.Errorf("retracted = %+v", retracted)
+	}
+	if len(observer.alerts) != 0 {
+		t.Errorf("alerts = %v", observer.alerts)
+	}
+}
+
+func TestBEAMBlockScanner_Mock_ReorgDepthExceeded(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.Config.maxreorgdepth = 2
+	srv.MineBlocks(6)
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{}))
+	observer := newTestObserver()
+	bs.AddObserver(observer)
+
+	bs.SetRescanBlockHeight(2)
+	bs.Scanning = true
+	bs.ScanBlockTask()
+	observer.waitHeaders(t, 6)
+
+	localHeight, localHash, _ := wm.GetLocalNewBlock()
+
+	//超出最大重组深度的本地区块已清理
+	if _, err := wm.GetLocalBlock(localHeight - 3); err == nil {
+		t.Errorf("local block %d should be pruned", localHeight-3)
+	}
+	if _, err := wm.GetLocalBlock(localHeight - 2); err != nil {
+		t.Errorf("local block %d should be kept; unexpected error: %v", localHeight-2, err)
+	}
+
+	//重组4个区块，超过最大重组深度
+	srv.Reorg(4, 5)
+	bs.ScanBlockTask()
+
+	height, hash, _ := wm.GetLocalNewBlock()
+	if height != localHeight || hash != localHash {
+		t.Errorf("local new block = %d:%s, scanner should stop on %d:%s", height, hash, localHeight, localHash)
+	}
+	if len(observer.alerts) != 1 || observer.alerts[0] != localHeight {
+		t.Errorf("alerts = %v", observer.alerts)
+	}
+}
+
+func TestBEAMBlockScanner_Mock_MinConfirmations(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.Config.minconfirmations = 2
+	srv.MineBlocks(2)
+
+	deposit := srv.AddTransaction(&beamtest.Tx{
+		Sender:   "outside",
+		Receiver: "user-address",
+		Value:    100000000,
+		Height:   3,
+		Income:   true,
+	})
+
+	scanTarget := testScanTarget(map[string]string{"user-address": "user"})
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(scanTarget)
+	observer := newTestObserver()
+	pendingObserver := &testPendingObserver{testObserver: newTestObserver()}
+	bs.AddObserver(observer)
+	bs.AddObserver(pendingObserver)
+
+	bs.SetRescanBlockHeight(2)
+	bs.Scanning = true
+	bs.ScanBlockTask()
+
+	//待确认的提取结果只通知选择接收的观测者
+	if n := len(observer.extractData("user")); n != 0 {
+		t.Fatalf("pending extract data should not notify observer, got %d", n)
+	}
+	data := pendingObserver.pendingData("user")
+	if len(data) != 1 || data[0].Transaction.TxID != deposit.TxID ||
+		gjson.Get(data[0].Transaction.ExtParam, "confirmed").Bool() {
+		t.Fatalf("pending extract data = %+v", data)
+	}
+
+	//确认数不足，不会再次通知
+	srv.MineBlocks(1)
+	bs.ScanBlockTask()
+	if n := len(pendingObserver.pendingData("user")); n != 1 || len(observer.extractData("user")) != 0 {
+		t.Fatalf("user pending extract data count = %d, want 1", n)
+	}
+
+	//重启扫描器后，待确认状态从本地恢复
+	bs.Stop()
+	bs = NewBEAMBlockScanner(wm)
+	bs.SetBlockScanTargetFunc(scanTarget)
+	bs.AddObserver(observer)
+	bs.AddObserver(pendingObserver)
+	bs.Scanning = true
+
+	srv.MineBlocks(1)
+	bs.ScanBlockTask()
+	bs.ScanBlockTask()
+
+	for _, o := range []*testObserver{observer, pendingObserver.testObserver} {
+		data = o.extractData("user")
+		if len(data) != 1 {
+			t.Fatalf("user extract data count = %d, want 1", len(data))
+		}
+		confirmed := data[0]
+		if confirmed.Transaction.TxID != deposit.TxID || confirmed.Transaction.Confirm != 2 ||
+			!gjson.Get(confirmed.Transaction.ExtParam, "confirmed").Bool() {
+			t.Errorf("confirmed transaction = %+v", confirmed.Transaction)
+		}
+		if len(confirmed.TxOutputs) != 1 || confirmed.TxOutputs[0].Confirm != 2 {
+			t.Errorf("confirmed outputs = %+v", confirmed.TxOutputs)
+		}
+	}
+	if n := len(pendingObserver.pendingData("user")); n != 1 {
+		t.Errorf("user pending extract data count = %d, want 1", n)
+	}
+}
+
+func TestBEAMBlockScanner_Mock_NotifyFailed(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(2)
+
+	deposit := srv.AddTransaction(&beamtest.Tx{
+		Sender:   "outside",
+		Receiver: "user-address",
+		Value:    100000000,
+		Height:   3,
+		Income:   true,
+	})
+	srv.MineBlocks(2)
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{"user-address": "user"}))
+	observer := newTestObserver()
+	failing := &testFailObserver{testObserver: newTestObserver(), fail: 100}
+	bs.AddObserver(observer)
+	bs.AddObserver(failing)
+
+	bs.SetRescanBlockHeight(2)
+	bs.Scanning = true
+	bs.ScanBlockTask()
+
+	//观测者通知失败时记录未扫区块由重扫任务重发，扫描继续
+	if height, _, _ := wm.GetLocalNewBlock(); height != srv.Tip().Height {
+		t.Errorf("local new block = %d, want %d", height, srv.Tip().Height)
+	}
+	if data := observer.extractData("user"); len(data) == 0 || data[0].Transaction.TxID != deposit.TxID {
+		t.Errorf("extract data = %+v", data)
+	}
+}
+
+func TestBEAMBlockScanner_Mock_CatchUp(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(25)
+
+	deposits := make([]string, 0)
+	for _, height := range []uint64{3, 9, 10, 15, 24} {
+		tx := srv.AddTransaction(&beamtest.Tx{
+			Sender:   "outside",
+			Receiver: "user-address",
+			Value:    height * 100000000,
+			Height:   height,
+			Income:   true,
+		})
+		deposits = append(deposits, tx.TxID)
+	}
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{"user-address": "user"}))
+	observer := newTestObserver()
+	bs.AddObserver(observer)
+
+	bs.SetRescanBlockHeight(2)
+	bs.Scanning = true
+	bs.ScanBlockTask()
+
+	tip := srv.Tip()
+	height, hash, _ := wm.GetLocalNewBlock()
+	if height != tip.Height || hash != tip.Hash {
+		t.Errorf("local new block = %d:%s, want %d:%s", height, hash, tip.Height, tip.Hash)
+	}
+
+	//按高度顺序通知
+	headers := observer.waitHeaders(t, int(tip.Height)-1)
+	for i, header := range headers {
+		if header.Height != uint64(i+2) {
+			t.Fatalf("header[%d] height = %d, want %d", i, header.Height, i+2)
+		}
+	}
+
+	data := observer.extractData("user")
+	if len(data) != len(deposits) {
+		t.Fatalf("user extract data count = %d, want %d", len(data), len(deposits))
+	}
+	for i, d := range data {
+		if d.Transaction.TxID != deposits[i] {
+			t.Errorf("extract data[%d] = %s at %d, want %s", i, d.Transaction.TxID, d.Transaction.BlockHeight, deposits[i])
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/blocktree/openwallet/owtp"
+	"sync"
 	"time"
 )
 
@@ -14,9 +15,11 @@ const (
 )
 
 type Client struct {
-	wm     *WalletManager
-	node   *owtp.OWTPNode
-	config *WalletConfig
+	wm        *WalletManager
+	node      *owtp.OWTPNode
+	config    *WalletConfig
+	quit      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewClient(wm *WalletManager) (*Client, error) {
@@ -39,10 +42,14 @@ func NewClient(wm *WalletManager) (*Client, error) {
 		node:   node,
 		config: wm.Config,
 		wm:     wm,
+		quit:   make(chan struct{}),
 	}
 
 	//绑定本地路由方法
 	//cli.transmitNode.HandleFunc("getTrustNodeInfo", cli.getTrustNodeInfo)
+	if c.config.enablepush {
+		node.HandleFunc("pushEvents", c.pushEvents)
+	}
 
 	autoReconnect := true
 	//自动连接
@@ -88,6 +95,14 @@ func (c *Client) connectRemoteNode() error {
 		return err
 	}
 
+	//订阅服务端推送，服务端重发断开前未确认的事件
+	if c.config.enablepush {
+		err = c.SubscribeEvents()
+		if err != nil {
+			c.wm.Log.Errorf("Subscribe %s push events failed unexpected error: %v", trustHostID, err)
+		}
+	}
+
 	return nil
 }
 
@@ -104,14 +119,12 @@ func (c *Client) autoReconnectRemoteNode() error {
 		reconnectWait = 5
 	)
 
-	defer func() {
-		close(reconnect)
-		close(disconnected)
-	}()
-
-	//断开连接通知
+	//断开连接通知，关闭节点时重连循环已退出，不能阻塞
 	c.node.SetCloseHandler(func(n *owtp.OWTPNode, peer owtp.PeerInfo) {
-		disconnected <- struct{}{}
+		select {
+		case disconnected <- struct{}{}:
+		default:
+		}
 	})
 
 	//启动连接
@@ -120,13 +133,19 @@ func (c *Client) autoReconnectRemoteNode() error {
 	//节点运行时
 	for {
 		select {
+		case <-c.quit:
+			return nil
+
 		case <-reconnect:
 			//重新连接
 			c.wm.Log.Info("Connecting to", c.config.remoteserver)
 			err = c.connectRemoteNode()
 			if err != nil {
 				c.wm.Log.Errorf("Connect %s node failed unexpected error: %v", trustHostID, err)
-				disconnected <- struct{}{}
+				select {
+				case disconnected <- struct{}{}:
+				default:
+				}
 			} else {
 				c.wm.Log.Infof("Connect %s node successfully.", trustHostID)
 			}
@@ -134,12 +153,22 @@ func (c *Client) autoReconnectRemoteNode() error {
 		case <-disconnected:
 			//重新连接，前等待
 			c.wm.Log.Info("Auto reconnect after", reconnectWait, "seconds...")
-			time.Sleep(time.Duration(reconnectWait) * time.Second)
+			select {
+			case <-c.quit:
+				return nil
+			case <-time.After(time.Duration(reconnectWait) * time.Second):
+			}
 			reconnect <- true
 		}
 	}
+}
 
-	return nil
+//Close 停止自动重连并关闭节点
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.quit)
+		c.node.Close()
+	})
 }
 
 /*********** 客户服务平台业务方法调用 ***********/
@@ -222,7 +251,7 @@ func (c *Client) GetTransaction(txid string) (*Transaction, error) {
 	return tx, retErr
 }
 
-//CreateBatchAddress
+//CreateBatchAddress 部分地址创建失败时，返回已创建的地址和*BatchAddressError
 func (c *Client) CreateBatchAddress(count, workerSize uint64) ([]string, error) {
 
 	var (
@@ -241,6 +270,13 @@ func (c *Client) CreateBatchAddress(count, workerSize uint64) ([]string, error)
 				retErr = json.Unmarshal([]byte(resp.JsonData().Raw), &addrs)
 			} else {
 				retErr = openwallet.Errorf(resp.Status, resp.Msg)
+
+				//服务端返回了部分创建结果
+				var result BatchAddressResult
+				if resp.JsonData().IsObject() && json.Unmarshal([]byte(resp.JsonData().Raw), &result) == nil && result.Count > 0 {
+					addrs = result.Addresses
+					retErr = &BatchAddressError{Result: &result}
+				}
 			}
 		})
 	if err != nil {
@@ -327,3 +363,226 @@ func (c *Client) GetBlockByHeight(height uint64) (*Block, error) {
 
 	return block, retErr
 }
+
+//QueryTransactions 分页查询服务端钱包的交易历史
+func (c *Client) QueryTransactions(query *TxQuery) (*TxQueryResult, error) {
+
+	var (
+		result *TxQueryResult
+		retErr error
+	)
+
+	if !c.node.IsConnectPeer(trustHostID) {
+		return nil, fmt.Errorf("client had disconnected: %s", trustHostID)
+	}
+
+	params := map[string]interface{}{
+		"query": query,
+	}
+
+	err := c.node.Call(trustHostID, "queryTransactions", params,
+		true, func(resp owtp.Response) {
+			if resp.Status == owtp.StatusSuccess {
+				retErr = json.Unmarshal([]byte(resp.JsonData().Raw), &result)
+			} else {
+				retErr = openwallet.Errorf(resp.Status, resp.Msg)
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, retErr
+}
+
+//CreateAccountAddress 部分地址创建失败时，返回已登记的地址和*BatchAddressError
+func (c *Client) CreateAccountAddress(accountID, comment, expiration string, count, workerSize uint64) ([]*AddressRecord, error) {
+
+	var (
+		records []*AddressRecord
+		retErr  error
+	)
+
+	params := map[string]interface{}{
+		"accountID":  accountID,
+		"comment":    comment,
+		"expiration": expiration,
+		"count":      count,
+		"workerSize": workerSize,
+	}
+
+	err := c.node.Call(trustHostID, "createAccountAddress", params,
+		true, func(resp owtp.Response) {
+			records, retErr = parseAccountAddressResponse(resp)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, retErr
+}
+
+//AllocateAccountAddress 部分地址创建失败时，返回已分配的地址和*BatchAddressError
+func (c *Client) AllocateAccountAddress(accountID, comment, expiration string, count uint64) ([]*AddressRecord, error) {
+
+	var (
+		records []*AddressRecord
+		retErr  error
+	)
+
+	params := map[string]interface{}{
+		"accountID":  accountID,
+		"comment":    comment,
+		"expiration": expiration,
+		"count":      count,
+	}
+
+	err := c.node.Call(trustHostID, "allocateAccountAddress", params,
+		true, func(resp owtp.Response) {
+			records, retErr = parseAccountAddressResponse(resp)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, retErr
+}
+
+//parseAccountAddressResponse 解析账户地址的响应，服务端返回了部分结果时返回已登记的地址和*BatchAddressError
+func parseAccountAddressResponse(resp owtp.Response) ([]*AddressRecord, error) {
+
+	var records []*AddressRecord
+
+	if resp.Status == owtp.StatusSuccess {
+		err := json.Unmarshal([]byte(resp.JsonData().Raw), &records)
+		return records, err
+	}
+
+	var partial AccountAddressResult
+	if resp.JsonData().IsObject() && json.Unmarshal([]byte(resp.JsonData().Raw), &partial) == nil && partial.Result != nil {
+		return partial.Records, &BatchAddressError{Result: partial.Result}
+	}
+
+	return nil, openwallet.Errorf(resp.Status, resp.Msg)
+}
+
+//GetAddressRecord
+func (c *Client) GetAddressRecord(address string) (*AddressRecord, error) {
+
+	var (
+		record *AddressRecord
+		retErr error
+	)
+
+	params := map[string]interface{}{
+		"address": address,
+	}
+
+	err := c.node.Call(trustHostID, "getAddressRecord", params,
+		true, func(resp owtp.Response) {
+			if resp.Status == owtp.StatusSuccess {
+				retErr = json.Unmarshal([]byte(resp.JsonData().Raw), &record)
+			} else {
+				retErr = openwallet.Errorf(resp.Status, resp.Msg)
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, retErr
+}
+
+//ListAddressRecords
+func (c *Client) ListAddressRecords(accountID string, offset, limit int) ([]*AddressRecord, error) {
+
+	var (
+		records []*AddressRecord
+		retErr  error
+	)
+
+	params := map[string]interface{}{
+		"accountID": accountID,
+		"offset":    offset,
+		"limit":     limit,
+	}
+
+	err := c.node.Call(trustHostID, "listAddressRecords", params,
+		true, func(resp owtp.Response) {
+			if resp.Status == owtp.StatusSuccess {
+				retErr = json.Unmarshal([]byte(resp.JsonData().Raw), &records)
+			} else {
+				retErr = openwallet.Errorf(resp.Status, resp.Msg)
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, retErr
+}
+
+//SubscribeEvents 订阅服务端推送的事件，服务端从已处理的事件之后继续推送
+func (c *Client) SubscribeEvents() error {
+
+	var (
+		retErr error
+	)
+
+	acked, err := c.wm.ReceivedPushEventID()
+	if err != nil {
+		return err
+	}
+
+	params := map[string]interface{}{
+		"acked": acked,
+	}
+
+	err = c.node.Call(trustHostID, "subscribeEvents", params,
+		true, func(resp owtp.Response) {
+			if resp.Status != owtp.StatusSuccess {
+				retErr = openwallet.Errorf(resp.Status, resp.Msg)
+				return
+			}
+			//服务端推送数据被重置，事件ID重新开始
+			if serverAcked := resp.JsonData().Get("acked").Uint(); serverAcked < acked {
+				c.wm.Log.Warningf("Server acked push event %d is older than the received event %d, reset the received event", serverAcked, acked)
+				retErr = c.wm.resetReceivedPushEventID(serverAcked)
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	return retErr
+}
+
+/*********** 本地路由方法实现 ***********/
+
+//pushEvents 处理服务端推送的事件，响应已处理的最大事件ID作为确认
+func (c *Client) pushEvents(ctx *owtp.Context) {
+
+	if ctx.PID != trustHostID {
+		ctx.Response(nil, owtp.ErrDenialOfService, "the node is not trusted")
+		return
+	}
+
+	var events []*PushEvent
+	err := json.Unmarshal([]byte(ctx.Params().Get("events").Raw), &events)
+	if err != nil {
+		ctx.Response(nil, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	acked, err := c.wm.ReceivePushEvents(events)
+	result := map[string]interface{}{
+		"acked": acked,
+	}
+	if err != nil {
+		c.wm.Log.Errorf("Receive push events failed unexpected error: %v", err)
+		ctx.Response(result, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	ctx.Response(result, owtp.StatusSuccess, "success")
+}
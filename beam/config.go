@@ -15,6 +15,26 @@ const (
 
 	//交易单发送超时时限
 	DefaultTxSendingTimeout =  5 * time.Minute
+	//交易状态查询周期
+	DefaultTxTrackPeriod = 10 * time.Second
+	//交易处于Registering状态的超时时限
+	DefaultTxRegisteringTimeout = 30 * time.Minute
+	//钱包连续查不到交易的最多次数，超过后按失败处理
+	DefaultTxNotFoundLimit = 30
+	//最大区块重组深度
+	DefaultMaxReorgDepth = 100
+	//钱包API单次请求超时时限
+	DefaultRPCTimeout = 30 * time.Second
+	//钱包API幂等请求的最多重试次数
+	DefaultRPCMaxRetries = 3
+	//钱包API首次重试前的等待时间
+	DefaultRPCRetryBackoff = 500 * time.Millisecond
+	//地址池维护周期
+	DefaultAddressPoolPeriod = 10 * time.Second
+	//批量创建地址的最大数量
+	DefaultMaxBatchAddressCount = 10000
+	//批量创建地址的最大并行线程数
+	DefaultMaxBatchAddressWorker = 50
 )
 
 const (
@@ -32,6 +52,26 @@ const (
 	TxStatusCompleted   = 3
 	TxStatusFailed      = 4
 	TxStatusRegistering = 5
+
+	//tx_list不按状态过滤
+	TxStatusAny = -1
+)
+
+const (
+	//地址有效期，用于create_address和edit_address
+	AddressExpirationExpired = "expired" //立即过期
+	AddressExpirationNever   = "never"   //永久有效
+	AddressExpiration24h     = "24h"     //24小时后过期
+)
+
+const (
+	//UTXO状态
+	UTXOStatusUnavailable = 0 //交易未完成，暂不可用
+	UTXOStatusAvailable   = 1
+	UTXOStatusMaturing    = 2
+	UTXOStatusOutgoing    = 3
+	UTXOStatusIncoming    = 4
+	UTXOStatusSpent       = 6
 )
 
 type WalletConfig struct {
@@ -44,6 +84,16 @@ type WalletConfig struct {
 	configFileName string
 	//区块链数据文件
 	BlockchainFile string
+	//区块链数据SQLite文件
+	BlockchainSQLiteFile string
+	//提现账本文件
+	WithdrawalFile string
+	//地址登记文件
+	AddressFile string
+	//审计日志文件
+	AuditFile string
+	//推送事件文件
+	PushFile string
 	//本地数据库文件路径
 	dbPath string
 	//默认配置内容
@@ -68,6 +118,34 @@ type WalletConfig struct {
 	connecttype string
 	//信任节点
 	trustnodeid string
+	//授信节点列表，格式：name:nodeID[:permission|permission], ...
+	trustnodes []*TrustNode
+	//授信节点文件，修改后自动重新加载
+	trustnodefile string
+	//是否记录服务端审计日志
+	enableauditlog bool
+	//审计日志文件路径
+	auditlogfile string
+	//每个节点每秒的请求数，0不限制
+	noderatelimit float64
+	//每个节点的突发请求数
+	noderateburst float64
+	//每个节点调用方法的频率限制
+	methodratelimits []*MethodRateLimit
+	//每次创建地址的最大数量，0不限制
+	maxaddresspercall uint64
+	//每个节点每天创建地址的最大数量，0不限制
+	maxaddressperday uint64
+	//同时调用钱包API的最大请求数，0不限制
+	maxconcurrentwalletcalls int
+	//服务端扫描托管钱包并推送充值和区块头，客户端接收推送代替轮询服务端
+	enablepush bool
+	//服务端推送扫描和重发的周期
+	pushperiod time.Duration
+	//每次推送的最大事件数
+	pushbatchsize int
+	//推送事件的保留时长，超过后删除
+	pushretention time.Duration
 	//是否作为服务端
 	enableserver bool
 	//是否输出LogDebugg日志
@@ -84,6 +162,52 @@ type WalletConfig struct {
 	logdir string
 	//交易单发送超时
 	txsendingtimeout time.Duration
+	//交易状态查询周期
+	txtrackperiod time.Duration
+	//交易处于Registering状态的超时时限
+	txregisteringtimeout time.Duration
+	//钱包连续查不到交易的最多次数
+	txnotfoundlimit int64
+	//最大区块重组深度，超过则告警并停止扫描
+	maxreorgdepth uint64
+	//充值最少确认数，区块上需要叠加的区块数量，未达到前以待确认状态通知
+	minconfirmations uint64
+	//区块扫描状态存储方式：storm, memory, sqlite
+	scannerstorage string
+	//钱包API单次请求超时时限
+	rpctimeout time.Duration
+	//钱包API幂等请求的最多重试次数
+	rpcmaxretries int
+	//钱包API首次重试前的等待时间
+	rpcretrybackoff time.Duration
+	//钱包API HTTP Basic认证用户名
+	rpcuser string
+	//钱包API HTTP Basic认证密码
+	rpcpassword string
+	//钱包API Bearer Token
+	rpctoken string
+	//钱包API自定义CA证书文件
+	rpccafile string
+	//钱包API客户端证书文件
+	rpccertfile string
+	//钱包API客户端证书私钥文件
+	rpckeyfile string
+	//钱包API不验证服务端证书
+	rpcinsecureskipverify bool
+	//发送前由钱包validate_address确认接收地址
+	validateaddressbywallet bool
+	//区块扫描使用地址登记信息查找充值账户
+	enableaddressregistryscan bool
+	//创建账户地址的默认有效期：never，24h，或自定义时长
+	addressexpiration string
+	//地址池保持的未分配地址数量，0不预生成
+	addresspoolsize uint64
+	//地址池维护周期
+	addresspoolperiod time.Duration
+	//批量创建地址的最大数量
+	maxbatchaddresscount uint64
+	//批量创建地址的最大并行线程数
+	maxbatchaddressworker uint64
 	//钱包wallet.db备份目录
 	walletdatabackupdir string
 	//钱包wallet.db绝对路径
@@ -108,6 +232,16 @@ func NewConfig(symbol string) *WalletConfig {
 	c.configFileName = c.Symbol + ".ini"
 	//区块链数据文件
 	c.BlockchainFile = "blockchain.db"
+	//区块链数据SQLite文件
+	c.BlockchainSQLiteFile = "blockchain.sqlite"
+	//提现账本文件
+	c.WithdrawalFile = "withdrawal.db"
+	//地址登记文件
+	c.AddressFile = "address.db"
+	//审计日志文件
+	c.AuditFile = "audit.log"
+	//推送事件文件
+	c.PushFile = "push.db"
 	//本地数据库文件路径
 	c.dbPath = filepath.Join("data", strings.ToLower(c.Symbol), "db")
 
@@ -0,0 +1,197 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"github.com/blocktree/openwallet/timer"
+	"sync"
+	"time"
+)
+
+//lifecycle 钱包管理的运行状态，Stop时等待执行中的定时任务结束再关闭数据库
+type lifecycle struct {
+	mu          sync.Mutex
+	tasks       sync.WaitGroup
+	started     bool
+	stopped     bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+	summaryTask *timer.TaskTimer
+}
+
+func newLifecycle() *lifecycle {
+	l := &lifecycle{
+		done: make(chan struct{}),
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	return l
+}
+
+//enter 开始执行定时任务，已停止返回false
+func (l *lifecycle) enter() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopped {
+		return false
+	}
+	l.tasks.Add(1)
+	return true
+}
+
+//leave 定时任务执行完成
+func (l *lifecycle) leave() {
+	l.tasks.Done()
+}
+
+//Start 启动钱包服务，所有模式都启动定时汇总，并跟踪交易状态。
+//ctx结束时自动执行Stop
+func (wm *WalletManager) Start(ctx context.Context) error {
+
+	var (
+		l = wm.lifecycle
+	)
+
+	l.mu.Lock()
+
+	if l.stopped {
+		l.mu.Unlock()
+		return fmt.Errorf("wallet manager has been stopped")
+	}
+
+	if l.started {
+		l.mu.Unlock()
+		return nil
+	}
+
+	task, err := wm.newSummaryTask()
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	l.summaryTask = task
+	l.summaryTask.Start()
+
+	//跟踪已发送交易的状态
+	wm.TxTracker.Run()
+
+	//维护地址池，同步地址有效期
+	wm.AddressPool.Run()
+
+	//扫描托管钱包，向客户端推送充值和区块头
+	if wm.server != nil && wm.server.pusher != nil {
+		wm.server.pusher.Run()
+	}
+
+	l.started = true
+	l.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			wm.Stop()
+		case <-l.done:
+		}
+	}()
+
+	//马上执行一次
+	wm.SummaryWallets()
+
+	return nil
+}
+
+//newSummaryTask 按配置创建汇总定时器
+func (wm *WalletManager) newSummaryTask() (*timer.TaskTimer, error) {
+
+	cycleTime := wm.Config.summaryperiod
+	if len(cycleTime) == 0 {
+		cycleTime = "1m"
+	}
+
+	cycleSec, err := time.ParseDuration(cycleTime)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wm.Config.summaryaddress) == 0 {
+		return nil, fmt.Errorf("summary address is not setup")
+	}
+
+	if len(wm.Config.summarythreshold) == 0 {
+		return nil, fmt.Errorf("summary threshold is not setup")
+	}
+
+	wm.Log.Infof("The timer for summary task start now. Execute by every %v seconds.", cycleSec.Seconds())
+
+	return timer.NewTask(cycleSec, wm.SummaryWallets), nil
+}
+
+//Stop 停止汇总定时器、交易跟踪、事件推送、区块扫描、客户端重连和OWTP服务，
+//等待执行中的任务结束后关闭数据库。重复调用无副作用
+func (wm *WalletManager) Stop() error {
+
+	var (
+		l = wm.lifecycle
+	)
+
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		return nil
+	}
+	l.stopped = true
+	//中断执行中的钱包API请求
+	l.cancel()
+	summaryTask := l.summaryTask
+	l.mu.Unlock()
+
+	wm.Log.Info("Wallet manager is stopping...")
+
+	if summaryTask != nil {
+		summaryTask.Stop()
+	}
+
+	wm.TxTracker.Stop()
+	wm.AddressPool.Stop()
+
+	if wm.server != nil && wm.server.pusher != nil {
+		wm.server.pusher.Stop()
+	}
+
+	if wm.Blockscanner.Scanning {
+		wm.Blockscanner.Stop()
+	}
+
+	if wm.client != nil {
+		wm.client.Close()
+	}
+
+	if wm.server != nil {
+		wm.server.Close()
+	}
+
+	//等待执行中的任务结束
+	l.tasks.Wait()
+
+	err := wm.CloseDB()
+	if err != nil {
+		wm.Log.Errorf("close database failed, unexpected error: %v", err)
+	}
+
+	close(l.done)
+
+	wm.Log.Info("Wallet manager stopped.")
+
+	return err
+}
+
+//context 钱包API请求使用的上下文，Stop时取消
+func (wm *WalletManager) context() context.Context {
+	return wm.lifecycle.ctx
+}
+
+//Done 钱包服务停止后关闭的通道
+func (wm *WalletManager) Done() <-chan struct{} {
+	return wm.lifecycle.done
+}
@@ -0,0 +1,122 @@
+package beam
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+)
+
+func TestWalletManager_StartStop(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 500000})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := wm.Start(ctx); err != nil {
+		t.Fatalf("Start failed unexpected error: %v", err)
+	}
+
+	//启动时马上执行一次汇总
+	if len(srv.SentTransactions()) != 1 {
+		t.Errorf("summary should run once on start")
+	}
+	if err := wm.SaveLocalNewBlock(3, "hash-3"); err != nil {
+		t.Fatalf("SaveLocalNewBlock failed unexpected error: %v", err)
+	}
+
+	cancel()
+
+	select {
+	case <-wm.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wallet manager should stop after context canceled")
+	}
+
+	//停止后定时任务不再执行
+	srv.SetBalance(beamtest.WalletBalance{Available: 500000})
+	wm.SummaryWallets()
+	if len(srv.SentTransactions()) != 1 {
+		t.Errorf("summary should not run after stop")
+	}
+	if len(wm.storage.dbs) != 0 || wm.storage.scanner != nil {
+		t.Errorf("storage should be flushed and closed after stop")
+	}
+
+	if err := wm.Stop(); err != nil {
+		t.Errorf("repeated Stop failed unexpected error: %v", err)
+	}
+	if err := wm.Start(context.Background()); err == nil {
+		t.Errorf("Start after stop should return error")
+	}
+}
+
+func TestWalletManager_StartClientMode(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 500000})
+	wm.Config.enableserver = false
+	wm.Config.enablesingle = false
+
+	if err := wm.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed unexpected error: %v", err)
+	}
+	defer wm.Stop()
+
+	//客户端模式同样执行汇总
+	if len(srv.SentTransactions()) != 1 {
+		t.Errorf("summary should run once on start in client mode")
+	}
+}
+
+func TestWalletManager_StopScanner(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(3)
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{}))
+	if err := bs.Run(); err != nil {
+		t.Fatalf("scanner Run failed unexpected error: %v", err)
+	}
+
+	if err := wm.Stop(); err != nil {
+		t.Fatalf("Stop failed unexpected error: %v", err)
+	}
+	if wm.Blockscanner.Scanning {
+		t.Errorf("block scanner should be stopped")
+	}
+
+	//停止后扫描任务直接返回
+	wm.Blockscanner.ScanBlockTask()
+	if len(wm.storage.dbs) != 0 || wm.storage.scanner != nil {
+		t.Errorf("scan task should not reopen storage after stop")
+	}
+}
+
+func TestWalletManager_StartSummaryWalletBlocksUntilStop(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- wm.StartSummaryWallet()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-result:
+		t.Fatalf("StartSummaryWallet returned before stop: %v", err)
+	default:
+	}
+
+	wm.Stop()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("StartSummaryWallet failed unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("StartSummaryWallet should return after stop")
+	}
+}
@@ -1,13 +1,13 @@
 package beam
 
 import (
+	"context"
 	"fmt"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/common/file"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/blocktree/openwallet/owtp"
-	"github.com/blocktree/openwallet/timer"
 	"github.com/shopspring/decimal"
 	"math/big"
 	"time"
@@ -23,17 +23,25 @@ type WalletManager struct {
 	Log             *log.OWLogger                   //日志工具
 	ContractDecoder openwallet.SmartContractDecoder //智能合约解析器
 	Blockscanner    *BEAMBlockScanner               //区块扫描器
+	TxTracker       *TxTracker                      //交易跟踪器
+	AddressPool     *AddressPool                    //地址池
 	walletClient    *WalletClient                   //本地封装的http client
 	client          *Client                         //节点作为客户端
 	server          *Server                         //节点作为服务端
+	storage         *walletStorage                  //本地数据库
+	lifecycle       *lifecycle                      //运行状态
 }
 
 func NewWalletManager() *WalletManager {
 	wm := WalletManager{}
 	wm.Config = NewConfig(Symbol)
+	wm.storage = newWalletStorage()
+	wm.lifecycle = newLifecycle()
 	wm.Blockscanner = NewBEAMBlockScanner(&wm)
-	//wm.Decoder = NewAddressDecoder(&wm)
+	wm.Decoder = NewAddressDecoder(&wm)
 	wm.TxDecoder = NewTransactionDecoder(&wm)
+	wm.TxTracker = NewTxTracker(&wm)
+	wm.AddressPool = NewAddressPool(&wm)
 	wm.Log = log.NewOWLogger(wm.Symbol())
 	return &wm
 }
@@ -80,7 +88,7 @@ func (wm WalletManager) GetRemoteWalletBalance() (*openwallet.Balance, error) {
 }
 
 func (wm WalletManager) CreateLocalWalletAddress(count, workerSize uint64) ([]string, error) {
-	return wm.walletClient.CreateBatchAddress(count, workerSize)
+	return wm.walletClient.CreateBatchAddress(wm.context(), count, workerSize)
 }
 
 func (wm WalletManager) GetLocalWalletBalance() (*openwallet.Balance, error) {
@@ -97,13 +105,13 @@ func (wm WalletManager) GetLocalWalletBalance() (*openwallet.Balance, error) {
 }
 
 func (wm WalletManager) GetLocalWalletAddress() ([]string, error) {
-	return wm.walletClient.GetAddressList()
+	return wm.walletClient.GetAddressList(wm.context())
 }
 
 //GetTransactionsByHeight
 func (wm *WalletManager) GetTransaction(txid string) (*Transaction, error) {
 
-	localTx, err := wm.walletClient.GetTransaction(txid)
+	localTx, err := wm.walletClient.GetTransaction(wm.context(), txid)
 	if err != nil {
 		wm.Log.Errorf("Local GetTransaction failed, unexpected error %v", err)
 	}
@@ -132,7 +140,7 @@ func (wm *WalletManager) GetTransactionsByHeight(height uint64) ([]*Transaction,
 	trxMap := make(map[string]*Transaction, 0)
 	trxs := make([]*Transaction, 0)
 
-	localTrxs, err := wm.walletClient.GetTransactionsByHeight(height)
+	localTrxs, err := wm.walletClient.GetTransactionsByHeight(wm.context(), height)
 	if err != nil {
 		wm.Log.Errorf("Local GetTransactionsByHeight failed, unexpected error %v", err)
 		return nil, err
@@ -142,7 +150,8 @@ func (wm *WalletManager) GetTransactionsByHeight(height uint64) ([]*Transaction,
 		trxMap[tx.TxID] = tx
 	}
 
-	if wm.client != nil && !wm.Config.enablesingle {
+	//开启推送时，服务端的充值交易由推送通知
+	if wm.client != nil && !wm.Config.enablesingle && !wm.Config.enablepush {
 		remoteTrxs, err := wm.client.GetTransactionsByHeight(height)
 		if err != nil {
 			wm.Log.Errorf("Remote GetTransactionsByHeight failed, unexpected error %v", err)
@@ -168,46 +177,21 @@ func (wm WalletManager) GetRemoteBlockByHeight(height uint64) (*Block, error) {
 	}
 
 	if wm.Config.enablesingle {
-		return wm.walletClient.GetBlockByHeight(height)
+		return wm.walletClient.GetBlockByHeight(wm.context(), height)
 	}
 
 	return wm.client.GetBlockByHeight(height)
 }
 
+//StartSummaryWallet 启动定时汇总，阻塞直到Stop
 func (wm *WalletManager) StartSummaryWallet() error {
 
-	var (
-		endRunning = make(chan bool, 1)
-	)
-
-	cycleTime := wm.Config.summaryperiod
-	if len(cycleTime) == 0 {
-		cycleTime = "1m"
-	}
-
-	cycleSec, err := time.ParseDuration(cycleTime)
+	err := wm.Start(context.Background())
 	if err != nil {
 		return err
 	}
 
-	if len(wm.Config.summaryaddress) == 0 {
-		return fmt.Errorf("summary address is not setup")
-	}
-
-	if len(wm.Config.summarythreshold) == 0 {
-		return fmt.Errorf("summary threshold is not setup")
-	}
-
-	wm.Log.Infof("The timer for summary task start now. Execute by every %v seconds.", cycleSec.Seconds())
-
-	//启动钱包汇总程序
-	sumTimer := timer.NewTask(cycleSec, wm.SummaryWallets)
-	sumTimer.Start()
-
-	//马上执行一次
-	wm.SummaryWallets()
-
-	<-endRunning
+	<-wm.Done()
 
 	return nil
 }
@@ -215,6 +199,11 @@ func (wm *WalletManager) StartSummaryWallet() error {
 //SummaryWallets 执行汇总流程
 func (wm *WalletManager) SummaryWallets() {
 
+	if !wm.lifecycle.enter() {
+		return
+	}
+	defer wm.lifecycle.leave()
+
 	wm.Log.Infof("[Summary Task Start]------%s", common.TimeFormat("2006-01-02 15:04:05"))
 
 	err := wm.summaryWalletProcess()
@@ -230,7 +219,7 @@ func (wm *WalletManager) SummaryWallets() {
 
 func (wm *WalletManager) summaryWalletProcess() error {
 
-	status, err := wm.walletClient.GetWalletStatus()
+	status, err := wm.walletClient.GetWalletStatus(wm.context())
 	if err != nil {
 		return fmt.Errorf("get local wallet balance failed, unexpected error: %v", err)
 	}
@@ -265,7 +254,7 @@ func (wm *WalletManager) summaryWalletProcess() error {
 		}
 
 		//取一个地址作为发送
-		addresses, err := wm.walletClient.GetAddressList()
+		addresses, err := wm.walletClient.GetAddressList(wm.context())
 		if err != nil {
 			return err
 		}
@@ -276,13 +265,15 @@ func (wm *WalletManager) summaryWalletProcess() error {
 
 		from := addresses[0]
 
-		txid, err := wm.walletClient.SendTransaction(from, wm.Config.summaryaddress, sumAmount_BI.Uint64(), fixFees.Uint64(), "")
+		txid, err := wm.walletClient.SendTransaction(wm.context(), from, wm.Config.summaryaddress, sumAmount_BI.Uint64(), fixFees.Uint64(), "")
 		if err != nil {
 			return err
 		}
 
 		wm.Log.Infof("[Success] txid: %s", txid)
 
+		wm.TxTracker.Track(txid)
+
 		//完成一次汇总备份一次wallet.db
 		backErr := wm.BackupWalletData()
 		if backErr != nil {
@@ -299,7 +290,7 @@ func (wm *WalletManager) summaryWalletProcess() error {
 //ClearExpireTx
 func (wm *WalletManager) ClearExpireTx() error {
 
-	txs, err := wm.walletClient.GetTransactionsByStatus(TxStatusInProgress)
+	txs, err := wm.walletClient.GetTransactionsByStatus(wm.context(), TxStatusInProgress)
 	if err != nil {
 		return err
 	}
@@ -319,11 +310,20 @@ func (wm *WalletManager) ClearExpireTx() error {
 
 			log.Infof("In Progress Tx: %s is expired", tx.TxID)
 
-			flag, cancelErr := wm.walletClient.CancelTx(tx.TxID)
+			flag, cancelErr := wm.walletClient.CancelTx(wm.context(), tx.TxID)
 			if cancelErr != nil {
+				//交易状态已经变化，不能再取消
+				if IsInvalidTxStatus(cancelErr) || IsTxNotFound(cancelErr) {
+					log.Warningf("Cancel Tx: %s skipped: %v", tx.TxID, cancelErr)
+					continue
+				}
 				return cancelErr
 			}
 			log.Infof("Cancel Tx: %s = %v", tx.TxID, flag)
+
+			if flag {
+				wm.TxTracker.TxCanceled(tx, "sending expired")
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,54 @@
+package beam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+)
+
+func TestWalletManager_Mock_SummaryWallets(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 500000})
+
+	wm.SummaryWallets()
+
+	sent := srv.SentTransactions()
+	if len(sent) != 1 {
+		t.Fatalf("summary tx count = %d, want 1", len(sent))
+	}
+	if sent[0].Address != wm.Config.summaryaddress || sent[0].Value != 499999 || sent[0].Fee != 1 {
+		t.Errorf("summary tx = %+v", sent[0])
+	}
+
+	//低于阈值不汇总
+	wm.SummaryWallets()
+	if len(srv.SentTransactions()) != 1 {
+		t.Errorf("balance under threshold should not be summarized")
+	}
+}
+
+func TestWalletManager_Mock_ClearExpireTx(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+
+	expired := srv.AddTransaction(&beamtest.Tx{
+		Value:      100,
+		Status:     beamtest.TxStatusInProgress,
+		CreateTime: time.Now().Add(-wm.Config.txsendingtimeout - time.Minute).Unix(),
+	})
+	fresh := srv.AddTransaction(&beamtest.Tx{
+		Value:  100,
+		Status: beamtest.TxStatusInProgress,
+	})
+
+	if err := wm.ClearExpireTx(); err != nil {
+		t.Fatalf("ClearExpireTx failed unexpected error: %v", err)
+	}
+
+	if s := srv.Transaction(expired.TxID).Status; s != beamtest.TxStatusCanceled {
+		t.Errorf("expired tx status = %d, want canceled", s)
+	}
+	if s := srv.Transaction(fresh.TxID).Status; s != beamtest.TxStatusInProgress {
+		t.Errorf("fresh tx status = %d, want in progress", s)
+	}
+}
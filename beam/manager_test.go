@@ -1,3 +1,6 @@
+//go:build integration
+// +build integration
+
 /*
  * Copyright 2018 The openwallet Authors
  * This file is part of the openwallet library.
@@ -0,0 +1,182 @@
+package beam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/config"
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const testMockConfig = `
+walletapi = "%s"
+explorerapi = "%s"
+enableserver = false
+enablesingle = true
+fixfees = "0.00000001"
+logdebug = false
+summaryaddress = "%s"
+summarythreshold = "0.001"
+summaryperiod = "30s"
+txsendingtimeout = "5m"
+rpcretrybackoff = "1ms"
+logdir = "%s"
+walletdatabackupdir = "%s"
+`
+
+var (
+	//测试用的接收地址，前缀保证按字母序排列
+	testReceiver  = testSBBSAddress("d0")
+	testReceiverA = testSBBSAddress("a0")
+	testReceiverB = testSBBSAddress("b0")
+	testReceiverC = testSBBSAddress("c0")
+)
+
+//testSBBSAddress 生成格式正确的SBBS地址
+func testSBBSAddress(prefix string) string {
+	sum := sha256.Sum256([]byte(prefix))
+	return (prefix + hex.EncodeToString(sum[:]) + "000")[:67]
+}
+
+//testNewMockWalletManager 创建连接到模拟钱包服务的单节点WalletManager
+func testNewMockWalletManager(t *testing.T) (*WalletManager, *beamtest.Server) {
+	srv := beamtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = t.TempDir()
+	t.Cleanup(func() {
+		if err := wm.CloseDB(); err != nil {
+			t.Errorf("CloseDB failed unexpected error: %v", err)
+		}
+	})
+
+	summaryAddress := srv.NewAddress("summary")
+	dir := t.TempDir()
+	ini := fmt.Sprintf(testMockConfig, srv.WalletAPI(), srv.ExplorerAPI(), summaryAddress, dir, dir)
+	c, err := config.NewConfigData("ini", []byte(ini))
+	if err != nil {
+		t.Fatalf("load mock config failed unexpected error: %v", err)
+	}
+	if err = wm.LoadAssetsConfig(c); err != nil {
+		t.Fatalf("LoadAssetsConfig failed unexpected error: %v", err)
+	}
+	return wm, srv
+}
+
+//testObserver 记录扫描器通知
+type testObserver struct {
+	mu        sync.Mutex
+	headers   []*openwallet.BlockHeader
+	data      map[string][]*openwallet.TxExtractData
+	retracted map[string][]*openwallet.TxExtractData
+	retractFn func(sourceKey string, data *openwallet.TxExtractData) error
+	alerts    []uint64
+}
+
+func newTestObserver() *testObserver {
+	return &testObserver{
+		data:      make(map[string][]*openwallet.TxExtractData),
+		retracted: make(map[string][]*openwallet.TxExtractData),
+	}
+}
+
+func (o *testObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.headers = append(o.headers, header)
+	return nil
+}
+
+func (o *testObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.data[sourceKey] = append(o.data[sourceKey], data)
+	return nil
+}
+
+func (o *testObserver) BlockExtractDataRetractNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.retractFn != nil {
+		if err := o.retractFn(sourceKey, data); err != nil {
+			return err
+		}
+	}
+	o.retracted[sourceKey] = append(o.retracted[sourceKey], data)
+	return nil
+}
+
+func (o *testObserver) BlockReorgAlertNotify(forkHeight uint64, maxReorgDepth uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.alerts = append(o.alerts, forkHeight)
+	return nil
+}
+
+//testPendingObserver 接收待确认提取结果的观测者
+type testPendingObserver struct {
+	*testObserver
+	pending map[string][]*openwallet.TxExtractData
+}
+
+func (o *testPendingObserver) BlockExtractDataPendingNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.pending == nil {
+		o.pending = make(map[string][]*openwallet.TxExtractData)
+	}
+	o.pending[sourceKey] = append(o.pending[sourceKey], data)
+	return nil
+}
+
+//pendingData 某个sourceKey收到的待确认提取结果
+func (o *testPendingObserver) pendingData(sourceKey string) []*openwallet.TxExtractData {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending[sourceKey]
+}
+
+//retractedData 某个sourceKey收到的撤回结果
+func (o *testObserver) retractedData(sourceKey string) []*openwallet.TxExtractData {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.retracted[sourceKey]
+}
+
+//extractData 某个sourceKey收到的提取结果
+func (o *testObserver) extractData(sourceKey string) []*openwallet.TxExtractData {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.data[sourceKey]
+}
+
+//waitHeaders 区块头是异步通知的，等待收到n个区块头
+func (o *testObserver) waitHeaders(t *testing.T, n int) []*openwallet.BlockHeader {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		o.mu.Lock()
+		if len(o.headers) >= n {
+			headers := o.headers
+			o.mu.Unlock()
+			return headers
+		}
+		o.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("wait %d block headers timeout", n)
+	return nil
+}
+
+//testScanTarget 按地址表查找sourceKey
+func testScanTarget(addrs map[string]string) openwallet.BlockScanTargetFunc {
+	return func(target openwallet.ScanTarget) (string, bool) {
+		key, ok := addrs[target.Address]
+		return key, ok
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/blocktree/openwallet/crypto"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/tidwall/gjson"
+	"time"
 )
 
 type Block struct {
@@ -14,7 +15,7 @@ type Block struct {
 	Found         bool
 	PrevBlockHash string
 	Time          int64
-	Height        uint64
+	Height        uint64 `storm:"id"`
 	inputs        []interface{}
 	kernels       []interface{}
 	outputs       []interface{}
@@ -152,6 +153,33 @@ func NewUnscanRecord(height uint64, txID, reason string) *UnscanRecord {
 	return &obj
 }
 
+//BlockExtractDataRecord 已通知的区块提取结果，区块分叉时用于撤回
+type BlockExtractDataRecord struct {
+	ID          string `storm:"id"` // primary key
+	BlockHeight uint64 `storm:"index"`
+	BlockHash   string
+	SourceKey   string
+	TxID        string
+	Data        *openwallet.TxExtractData
+	Retracting  bool //区块已分叉，等待撤回通知
+	Confirmed   bool //已达到minconfirmations并以确认状态通知
+	NotifyAt    int64
+}
+
+func NewBlockExtractDataRecord(height uint64, sourceKey string, data *openwallet.TxExtractData) *BlockExtractDataRecord {
+	obj := BlockExtractDataRecord{}
+	obj.BlockHeight = height
+	obj.SourceKey = sourceKey
+	obj.Data = data
+	if data.Transaction != nil {
+		obj.BlockHash = data.Transaction.BlockHash
+		obj.TxID = data.Transaction.TxID
+	}
+	obj.NotifyAt = time.Now().Unix()
+	obj.ID = common.Bytes2Hex(crypto.SHA256([]byte(fmt.Sprintf("%d_%s_%s_%s", height, obj.BlockHash, sourceKey, obj.TxID))))
+	return &obj
+}
+
 type TrustNodeInfo struct {
 	NodeID      string `json:"nodeID"` //@required 节点ID
 	NodeName    string `json:"nodeName"`
@@ -195,6 +223,7 @@ type WalletStatus struct {
 	Sending          uint64
 	Maturing         uint64
 	Locked           uint64
+	Difficulty       float64
 
 	/*
 		{
@@ -221,11 +250,298 @@ func NewWalletStatus(result *gjson.Result) *WalletStatus {
 	obj.Sending = result.Get("sending").Uint()
 	obj.Maturing = result.Get("maturing").Uint()
 	obj.Locked = result.Get("locked").Uint()
+	obj.Difficulty = result.Get("difficulty").Float()
+	return &obj
+}
+
+//WalletAddress 钱包地址簿中的地址
+type WalletAddress struct {
+	Address    string
+	Comment    string
+	Category   string
+	CreateTime int64
+	Duration   uint64 //有效时长，单位秒，0为永久有效
+	Expired    bool
+	Own        bool
+
+	/*
+		{
+		    "address": "29510b33fac0cb20695fd3b836d835451e600c4224d8fb335dc1a68271deb9b6b5b",
+		    "category": "",
+		    "create_time": 1553174321,
+		    "duration": 1520,
+		    "expired": true,
+		    "comment": "some comment",
+		    "own": true
+		}
+	*/
+}
+
+func NewWalletAddress(result *gjson.Result) *WalletAddress {
+	obj := WalletAddress{}
+	obj.Address = result.Get("address").String()
+	obj.Comment = result.Get("comment").String()
+	obj.Category = result.Get("category").String()
+	obj.CreateTime = result.Get("create_time").Int()
+	obj.Duration = result.Get("duration").Uint()
+	obj.Expired = result.Get("expired").Bool()
+	obj.Own = result.Get("own").Bool()
+	return &obj
+}
+
+//AddressValidation 地址校验结果
+type AddressValidation struct {
+	IsValid bool
+	IsMine  bool
+
+	/*
+		{
+		    "is_valid" : true,
+		    "is_mine" : false
+		}
+	*/
+}
+
+func NewAddressValidation(result *gjson.Result) *AddressValidation {
+	obj := AddressValidation{}
+	obj.IsValid = result.Get("is_valid").Bool()
+	obj.IsMine = result.Get("is_mine").Bool()
+	return &obj
+}
+
+//UTXO 钱包中的币
+type UTXO struct {
+	ID           string
+	Amount       uint64
+	Type         string
+	Maturity     uint64
+	CreateTxID   string
+	SpentTxID    string
+	Status       int64
+	StatusString string
+
+	/*
+		{
+		    "id": "0000000000000000012345000000000000000000000000000000000000000000400000000000000fe00",
+		    "amount": 12345,
+		    "type": "mine",
+		    "maturity": 60,
+		    "createTxId": "10c4b760c842433cb58339a0fafef3db",
+		    "spentTxId": "",
+		    "status": 2,
+		    "status_string": "maturing"
+		}
+	*/
+}
+
+func NewUTXO(result *gjson.Result) *UTXO {
+	obj := UTXO{}
+	obj.ID = result.Get("id").String()
+	obj.Amount = result.Get("amount").Uint()
+	obj.Type = result.Get("type").String()
+	obj.Maturity = result.Get("maturity").Uint()
+	obj.CreateTxID = result.Get("createTxId").String()
+	obj.SpentTxID = result.Get("spentTxId").String()
+	obj.Status = result.Get("status").Int()
+	obj.StatusString = result.Get("status_string").String()
 	return &obj
 }
 
+//TxListFilter tx_list查询条件
+type TxListFilter struct {
+	Status int    //交易状态，TxStatusAny不过滤
+	Height uint64 //区块高度，0不过滤
+	Skip   uint64 //跳过的记录数
+	Count  uint64 //返回的最多记录数，0不限制
+}
+
 type AddressCreateResult struct {
-	Success bool
-	Err     error
-	Address string
-}
\ No newline at end of file
+	Index    uint64 `json:"index"` //在批量创建中的序号
+	Success  bool   `json:"success"`
+	Err      error  `json:"-"`
+	Error    string `json:"error"` //失败原因
+	Address  string `json:"address"`
+	Attempts int    `json:"attempts"` //尝试创建的次数
+}
+
+//BatchAddressResult 批量创建地址的结果
+type BatchAddressResult struct {
+	Count     uint64                 `json:"count"`     //请求创建的数量
+	Addresses []string               `json:"addresses"` //创建成功的地址，按序号排列
+	Failed    []*AddressCreateResult `json:"failed"`    //创建失败的地址
+	Canceled  bool                   `json:"canceled"`  //是否被取消
+}
+
+//Err 未全部创建成功时返回*BatchAddressError
+func (r *BatchAddressResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return &BatchAddressError{Result: r}
+}
+
+//AccountAddressResult 账户地址未全部创建或分配成功时，服务端返回的部分结果
+type AccountAddressResult struct {
+	Records []*AddressRecord    `json:"records"` //已登记到账户的地址
+	Result  *BatchAddressResult `json:"result"`  //创建地址的结果，包含各地址的失败原因
+}
+
+//PayoutResult 批量付款中一个接收者的发送结果
+type PayoutResult struct {
+	From        string                  `json:"from"`
+	Address     string                  `json:"address"`
+	Amount      string                  `json:"amount"`
+	Fees        string                  `json:"fees"`
+	TxID        string                  `json:"txid,omitempty"`
+	Reason      string                  `json:"reason,omitempty"` //失败原因
+	Err         error                   `json:"-"`
+	Transaction *openwallet.Transaction `json:"-"`
+}
+
+const (
+	//提现记录状态
+	WithdrawalStatusSubmitting = "submitting" //正在发送，tx_send结果未知
+	WithdrawalStatusSubmitted  = "submitted"  //已发送到钱包
+	WithdrawalStatusCompleted  = "completed"  //交易完成
+	WithdrawalStatusFailed     = "failed"     //发送失败或交易失败
+	WithdrawalStatusCanceled   = "canceled"   //交易已取消
+)
+
+//WithdrawalStatusChange 提现记录状态变化
+type WithdrawalStatusChange struct {
+	Status   string
+	TxStatus int64 //钱包交易状态，未发送为-1
+	Reason   string
+	Time     int64
+}
+
+//WithdrawalRecord 提现记录，每个接收者一条
+type WithdrawalRecord struct {
+	ID        string `storm:"id"`    // primary key
+	Key       string `storm:"index"` //调用方提供的幂等键
+	Address   string
+	Amount    string
+	Fees      string
+	TxID      string `storm:"index"`
+	Status    string `storm:"index"`
+	TxStatus  int64  //钱包交易状态，未发送为-1
+	Reason    string
+	CreatedAt int64
+	UpdatedAt int64
+	History   []*WithdrawalStatusChange
+}
+
+func NewWithdrawalRecord(key, address, amount, fees string) *WithdrawalRecord {
+	now := time.Now().Unix()
+	obj := WithdrawalRecord{}
+	obj.Key = key
+	obj.Address = address
+	obj.Amount = amount
+	obj.Fees = fees
+	obj.CreatedAt = now
+	obj.TxStatus = -1
+	if len(key) > 0 {
+		obj.ID = withdrawalID(key, address)
+	} else {
+		//没有幂等键，每次都是新记录
+		obj.ID = withdrawalID(fmt.Sprintf("%d", time.Now().UnixNano()), address)
+	}
+	obj.SetStatus(WithdrawalStatusSubmitting, "")
+	return &obj
+}
+
+func withdrawalID(key, address string) string {
+	return common.Bytes2Hex(crypto.SHA256([]byte(fmt.Sprintf("%s_%s", key, address))))
+}
+
+//SetStatus 变更状态，并记录变化历史
+func (r *WithdrawalRecord) SetStatus(status, reason string) {
+	now := time.Now().Unix()
+	r.Status = status
+	r.Reason = reason
+	r.UpdatedAt = now
+	r.History = append(r.History, &WithdrawalStatusChange{
+		Status:   status,
+		TxStatus: r.TxStatus,
+		Reason:   reason,
+		Time:     now,
+	})
+}
+
+//SetTxStatus 记录钱包交易状态变化，交易完成、失败、取消时同步变更提现状态
+func (r *WithdrawalRecord) SetTxStatus(txStatus int64, reason string) {
+	r.TxStatus = txStatus
+	switch txStatus {
+	case TxStatusCompleted:
+		r.SetStatus(WithdrawalStatusCompleted, reason)
+	case TxStatusFailed:
+		r.SetStatus(WithdrawalStatusFailed, reason)
+	case TxStatusCanceled:
+		r.SetStatus(WithdrawalStatusCanceled, reason)
+	default:
+		//发送结果未知的提现在钱包中查到交易，即已发送
+		if r.Status == WithdrawalStatusSubmitting {
+			r.SetStatus(WithdrawalStatusSubmitted, reason)
+			return
+		}
+		r.SetStatus(r.Status, reason)
+	}
+}
+
+//Retryable 失败或取消的提现可以用相同的幂等键重新发送
+func (r *WithdrawalRecord) Retryable() bool {
+	return r.Status == WithdrawalStatusFailed || r.Status == WithdrawalStatusCanceled
+}
+
+//AddressRecord 地址登记信息，记录地址所属的用户账户
+type AddressRecord struct {
+	Address    string `storm:"id" json:"address"`
+	AccountID  string `storm:"index" json:"accountID"` //所属账户
+	Comment    string `json:"comment"`                 //钱包中的地址备注
+	Expiration string `json:"expiration"`              //有效期：never，24h，或自定义时长
+	ExpiredAt  int64  `json:"expiredAt"`               //过期时间，0为永久有效
+	Expired    bool   `json:"expired"`                 //已在钱包中过期
+	Synced     bool   `json:"synced"`                  //备注和有效期已同步到钱包
+	CreatedAt  int64  `storm:"index" json:"createdAt"`
+}
+
+//NewAddressRecord 地址登记信息，duration为有效时长，0为永久有效
+func NewAddressRecord(address, accountID, comment, expiration string, duration time.Duration) *AddressRecord {
+	now := time.Now().Unix()
+	obj := AddressRecord{}
+	obj.Address = address
+	obj.AccountID = accountID
+	obj.Comment = comment
+	obj.Expiration = expiration
+	obj.CreatedAt = now
+	if duration > 0 {
+		obj.ExpiredAt = now + int64(duration/time.Second)
+	}
+	return &obj
+}
+
+//PooledAddress 地址池中未分配的地址
+type PooledAddress struct {
+	Address   string `storm:"id"`
+	CreatedAt int64  `storm:"index"`
+}
+
+//PushEvent 服务端推送给客户端的事件，ID按产生顺序递增，客户端按ID确认
+type PushEvent struct {
+	ID        uint64       `storm:"id,increment" json:"id"`
+	Type      string       `json:"type"` //事件类型：deposit，header
+	Height    uint64       `json:"height"`
+	Hash      string       `json:"hash"`
+	Fork      bool         `json:"fork"`            //区块头是否为分叉的孤块
+	Block     *Block       `json:"block,omitempty"` //header事件的区块
+	Tx        *Transaction `json:"tx,omitempty"`    //deposit事件的充值交易
+	CreatedAt int64        `storm:"index" json:"createdAt"`
+}
+
+//PushCursor 节点已确认的推送事件ID，服务端为每个订阅节点记录，客户端记录已处理的事件
+type PushCursor struct {
+	NodeID    string `storm:"id"`
+	Acked     uint64
+	Height    uint64 //客户端已处理的推送区块高度，用于计算推送充值的确认数
+	UpdatedAt int64
+}
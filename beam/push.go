@@ -0,0 +1,707 @@
+package beam
+
+import (
+	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/blocktree/openwallet/timer"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//推送事件类型
+	PushEventDeposit = "deposit" //充值交易
+	PushEventHeader  = "header"  //区块头
+
+	//推送扫描和重发的周期
+	DefaultPushPeriod = 5 * time.Second
+	//每次推送的最大事件数
+	DefaultPushBatchSize = 100
+	//推送事件的保留时长
+	DefaultPushRetention = 7 * 24 * time.Hour
+)
+
+//PushBlockObserver 服务端推送区块头的观测者。
+//客户端开启enablepush后，观测者实现该接口可以收到托管钱包扫描到的区块头，分叉的孤块Fork为true
+type PushBlockObserver interface {
+
+	//PushBlockNotify 服务端推送的区块头通知
+	PushBlockNotify(header *openwallet.BlockHeader) error
+}
+
+//pushSender 向节点推送一批事件，返回节点确认的最大事件ID
+type pushSender func(nodeID string, events []*PushEvent) (uint64, error)
+
+//EventPusher 服务端事件推送，定时扫描托管钱包的新区块和充值交易，记录为推送事件，按顺序推送给已订阅的节点。
+//节点确认前的事件保留在数据库中，推送失败的下次任务重发，节点重新连接订阅后从已确认的位置继续推送
+type EventPusher struct {
+	wm          *WalletManager
+	mu          sync.Mutex
+	task        *timer.TaskTimer
+	running     bool
+	busy        int32           //扫描任务执行中
+	subscribers map[string]bool //已订阅的节点
+	delivering  map[string]bool //推送中的节点
+	send        pushSender
+}
+
+//NewEventPusher 创建事件推送，send为向节点推送事件的方法
+func NewEventPusher(wm *WalletManager, send pushSender) *EventPusher {
+	pusher := EventPusher{
+		wm:          wm,
+		subscribers: make(map[string]bool),
+		delivering:  make(map[string]bool),
+		send:        send,
+	}
+	return &pusher
+}
+
+//Run 按配置的周期定时扫描和推送
+func (pusher *EventPusher) Run() {
+	pusher.mu.Lock()
+	defer pusher.mu.Unlock()
+
+	if pusher.running {
+		return
+	}
+
+	pusher.wm.Log.Infof("The timer for event pusher start now. Execute by every %v seconds.", pusher.wm.Config.pushperiod.Seconds())
+
+	pusher.task = timer.NewTask(pusher.wm.Config.pushperiod, pusher.Poll)
+	pusher.task.Start()
+	pusher.running = true
+}
+
+//Stop 停止定时扫描和推送
+func (pusher *EventPusher) Stop() {
+	pusher.mu.Lock()
+	defer pusher.mu.Unlock()
+
+	if pusher.task != nil {
+		pusher.task.Stop()
+	}
+	pusher.running = false
+}
+
+//Subscribe 节点订阅推送事件，acked为节点已处理的事件ID。
+//首次订阅的节点从当前最新的事件之后开始推送，acked大于服务端记录时（确认的响应丢失）以acked为准。
+//acked大于最新的事件ID时（服务端推送数据被重置），从最新的事件之后开始推送
+func (pusher *EventPusher) Subscribe(nodeID string, acked uint64) (*PushCursor, error) {
+
+	db, err := pusher.wm.pushDB()
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := pusher.lastEventID(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if acked > lastID {
+		pusher.wm.Log.Warningf("Node: %s acked event %d is newer than the last event %d, push from the last event", nodeID, acked, lastID)
+		acked = lastID
+	}
+
+	var cursor PushCursor
+	err = db.One("NodeID", nodeID, &cursor)
+	if err != nil {
+		if err != storm.ErrNotFound {
+			return nil, err
+		}
+		cursor.NodeID = nodeID
+		cursor.Acked = lastID
+		if acked > 0 {
+			cursor.Acked = acked
+		}
+	} else if acked > cursor.Acked {
+		cursor.Acked = acked
+	}
+
+	cursor.UpdatedAt = time.Now().Unix()
+	err = db.Save(&cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	pusher.mu.Lock()
+	pusher.subscribers[nodeID] = true
+	pusher.mu.Unlock()
+
+	pusher.wm.Log.Infof("Node: %s subscribe push events after %d", nodeID, cursor.Acked)
+
+	return &cursor, nil
+}
+
+//Unsubscribe 节点断开连接后取消订阅，未确认的事件保留到重新订阅
+func (pusher *EventPusher) Unsubscribe(nodeID string) {
+	pusher.mu.Lock()
+	defer pusher.mu.Unlock()
+	delete(pusher.subscribers, nodeID)
+}
+
+//Subscribers 已订阅的节点
+func (pusher *EventPusher) Subscribers() []string {
+	pusher.mu.Lock()
+	defer pusher.mu.Unlock()
+	nodes := make([]string, 0, len(pusher.subscribers))
+	for nodeID := range pusher.subscribers {
+		nodes = append(nodes, nodeID)
+	}
+	return nodes
+}
+
+//Poll 扫描托管钱包的新区块，再向已订阅的节点推送未确认的事件
+func (pusher *EventPusher) Poll() {
+
+	if !pusher.wm.lifecycle.enter() {
+		return
+	}
+	defer pusher.wm.lifecycle.leave()
+
+	if !atomic.CompareAndSwapInt32(&pusher.busy, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&pusher.busy, 0)
+
+	err := pusher.Scan()
+	if err != nil {
+		pusher.wm.Log.Errorf("event pusher scan failed; unexpected error: %v", err)
+	}
+
+	err = pusher.prune()
+	if err != nil {
+		pusher.wm.Log.Errorf("event pusher prune events failed; unexpected error: %v", err)
+	}
+
+	for _, nodeID := range pusher.Subscribers() {
+		pusher.Deliver(nodeID)
+	}
+}
+
+//Scan 扫描托管钱包从上次扫描位置到最新高度的区块，把区块头和充值交易记录为推送事件。
+//首次扫描从当前最新高度开始，区块分叉时记录孤块的分叉区块头并回退
+func (pusher *EventPusher) Scan() error {
+
+	db, err := pusher.wm.pushDB()
+	if err != nil {
+		return err
+	}
+
+	status, err := pusher.wm.walletClient.GetWalletStatus(pusher.wm.context())
+	if err != nil {
+		return err
+	}
+
+	last, err := pusher.lastBlock(db)
+	if err != nil {
+		return err
+	}
+
+	if last == nil {
+		block, err := pusher.wm.walletClient.GetBlockByHeight(pusher.wm.context(), status.CurrentHeight)
+		if err != nil {
+			return err
+		}
+		pusher.wm.Log.Infof("event pusher start scanning after height: %d", block.Height)
+		return db.Save(block)
+	}
+
+	for last.Height < status.CurrentHeight {
+
+		block, err := pusher.wm.walletClient.GetBlockByHeight(pusher.wm.context(), last.Height+1)
+		if err != nil {
+			return err
+		}
+
+		if !block.Found {
+			return fmt.Errorf("block %d is not found", last.Height+1)
+		}
+
+		//上一区块已成为孤块，记录分叉区块头并回退一个区块
+		if block.PrevBlockHash != last.Hash {
+
+			pusher.wm.Log.Std.Info("event pusher block has been fork on height: %d.", last.Height)
+
+			prev, err := pusher.rollback(db, last)
+			if err != nil {
+				return err
+			}
+
+			//已记录的区块中没有共同祖先，停在分叉处，需要人工处理
+			if prev == nil {
+				pusher.wm.Log.Errorf("ALERT: event pusher can not find the common ancestor of height: %d within max reorg depth: %d", last.Height, pusher.wm.Config.maxreorgdepth)
+				return fmt.Errorf("event pusher can not find the block before fork height: %d", last.Height)
+			}
+
+			last = prev
+			continue
+		}
+
+		txs, err := pusher.wm.walletClient.GetTransactionsByHeight(pusher.wm.context(), block.Height)
+		if err != nil {
+			return err
+		}
+
+		err = pusher.saveBlockEvents(db, block, txs)
+		if err != nil {
+			return err
+		}
+
+		last = block
+	}
+
+	//清理超出最大重组深度的区块
+	if last.Height > pusher.wm.Config.maxreorgdepth {
+		err = db.Select(q.Lt("Height", last.Height-pusher.wm.Config.maxreorgdepth)).Delete(&Block{})
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//saveBlockEvents 在同一事务中记录区块的充值交易事件、区块头事件和已扫描的区块
+func (pusher *EventPusher) saveBlockEvents(db *storm.DB, block *Block, txs []*Transaction) error {
+
+	now := time.Now().Unix()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, trx := range txs {
+		if !trx.Income {
+			continue
+		}
+		err = tx.Save(&PushEvent{
+			Type:      PushEventDeposit,
+			Height:    block.Height,
+			Hash:      block.Hash,
+			Tx:        trx,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Save(&PushEvent{
+		Type:      PushEventHeader,
+		Height:    block.Height,
+		Hash:      block.Hash,
+		Block:     block,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Save(block)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//rollback 删除孤块并记录分叉区块头事件，返回孤块的上一个区块。
+//没有记录上一个区块时不回退，返回nil
+func (pusher *EventPusher) rollback(db *storm.DB, orphan *Block) (*Block, error) {
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var prev Block
+	err = tx.One("Height", orphan.Height-1, &prev)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = tx.DeleteStruct(orphan)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	err = tx.Save(&PushEvent{
+		Type:      PushEventHeader,
+		Height:    orphan.Height,
+		Hash:      orphan.Hash,
+		Fork:      true,
+		Block:     orphan,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &prev, nil
+}
+
+//Deliver 按顺序向节点推送未确认的事件，直到全部确认或推送失败，失败的下次任务重发
+func (pusher *EventPusher) Deliver(nodeID string) {
+
+	if !pusher.wm.lifecycle.enter() {
+		return
+	}
+	defer pusher.wm.lifecycle.leave()
+
+	//同一节点同时只有一个推送，保证事件顺序
+	pusher.mu.Lock()
+	if pusher.delivering[nodeID] {
+		pusher.mu.Unlock()
+		return
+	}
+	pusher.delivering[nodeID] = true
+	pusher.mu.Unlock()
+
+	defer func() {
+		pusher.mu.Lock()
+		delete(pusher.delivering, nodeID)
+		pusher.mu.Unlock()
+	}()
+
+	for {
+		n, err := pusher.deliverBatch(nodeID)
+		if err != nil {
+			pusher.wm.Log.Warningf("Push events to node: %s failed: %v", nodeID, err)
+			return
+		}
+		if n == 0 {
+			return
+		}
+	}
+}
+
+//deliverBatch 推送一批未确认的事件，记录节点确认的位置，返回节点确认的事件数
+func (pusher *EventPusher) deliverBatch(nodeID string) (int, error) {
+
+	db, err := pusher.wm.pushDB()
+	if err != nil {
+		return 0, err
+	}
+
+	var cursor PushCursor
+	err = db.One("NodeID", nodeID, &cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := pusher.Events(cursor.Acked, pusher.wm.Config.pushbatchsize)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	acked, sendErr := pusher.send(nodeID, events)
+
+	//只接受本次推送范围内的确认
+	if last := events[len(events)-1].ID; acked > last {
+		acked = last
+	}
+
+	n := 0
+	for _, e := range events {
+		if e.ID <= acked {
+			n++
+		}
+	}
+
+	if acked > cursor.Acked {
+		cursor.Acked = acked
+		cursor.UpdatedAt = time.Now().Unix()
+		err = db.Save(&cursor)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if sendErr != nil {
+		return n, sendErr
+	}
+
+	if n < len(events) {
+		return n, fmt.Errorf("node acked %d of %d events", n, len(events))
+	}
+
+	return n, nil
+}
+
+//Events 按顺序获取ID大于afterID的推送事件
+//@limit 返回的最多事件数，0不限制
+func (pusher *EventPusher) Events(afterID uint64, limit int) ([]*PushEvent, error) {
+
+	db, err := pusher.wm.pushDB()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Select(q.Gt("ID", afterID)).OrderBy("ID")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	events := make([]*PushEvent, 0)
+	err = query.Find(&events)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+//Cursor 节点已确认的推送位置
+func (pusher *EventPusher) Cursor(nodeID string) (*PushCursor, error) {
+
+	db, err := pusher.wm.pushDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor PushCursor
+	err = db.One("NodeID", nodeID, &cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+//prune 删除超过保留时长的事件，保留最后一个事件使事件ID继续递增
+func (pusher *EventPusher) prune() error {
+
+	db, err := pusher.wm.pushDB()
+	if err != nil {
+		return err
+	}
+
+	lastID, err := pusher.lastEventID(db)
+	if err != nil {
+		return err
+	}
+
+	expired := time.Now().Add(-pusher.wm.Config.pushretention).Unix()
+	err = db.Select(q.Lt("CreatedAt", expired), q.Lt("ID", lastID)).Delete(&PushEvent{})
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	return nil
+}
+
+//lastEventID 最新的事件ID，没有事件返回0
+func (pusher *EventPusher) lastEventID(db *storm.DB) (uint64, error) {
+	var e PushEvent
+	err := db.Select().OrderBy("ID").Reverse().First(&e)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return e.ID, nil
+}
+
+//lastBlock 最后扫描的区块，没有记录返回nil
+func (pusher *EventPusher) lastBlock(db *storm.DB) (*Block, error) {
+	var block Block
+	err := db.Select().OrderBy("Height").Reverse().First(&block)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &block, nil
+}
+
+/*********** 客户端接收推送 ***********/
+
+//ReceivePushEvents 按顺序处理服务端推送的事件，返回已处理的最大事件ID。
+//已处理过的事件直接确认，处理失败时停止，之后的事件由服务端重发
+func (wm *WalletManager) ReceivePushEvents(events []*PushEvent) (uint64, error) {
+
+	db, err := wm.pushDB()
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := wm.receivedPushCursor(db)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		acked  = cursor.Acked
+		height = cursor.Height
+		retErr error
+	)
+
+	for _, e := range events {
+		if e.ID <= acked {
+			continue
+		}
+		retErr = wm.Blockscanner.pushEventNotify(e, height)
+		if retErr != nil {
+			break
+		}
+		acked = e.ID
+		if e.Type == PushEventHeader {
+			height = e.Height
+			if e.Fork {
+				height = e.Height - 1
+			}
+		}
+	}
+
+	if acked > cursor.Acked {
+		cursor.Acked = acked
+		cursor.Height = height
+		cursor.UpdatedAt = time.Now().Unix()
+		err = db.Save(cursor)
+		if err != nil {
+			return cursor.Acked, err
+		}
+	}
+
+	return acked, retErr
+}
+
+//ReceivedPushEventID 客户端已处理的最大推送事件ID
+func (wm *WalletManager) ReceivedPushEventID() (uint64, error) {
+
+	db, err := wm.pushDB()
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := wm.receivedPushCursor(db)
+	if err != nil {
+		return 0, err
+	}
+
+	return cursor.Acked, nil
+}
+
+//receivedPushCursor 客户端处理服务端推送的位置
+func (wm *WalletManager) receivedPushCursor(db *storm.DB) (*PushCursor, error) {
+	var cursor PushCursor
+	err := db.One("NodeID", trustHostID, &cursor)
+	if err != nil {
+		if err != storm.ErrNotFound {
+			return nil, err
+		}
+		cursor.NodeID = trustHostID
+	}
+	return &cursor, nil
+}
+
+//resetReceivedPushEventID 服务端推送数据被重置后，客户端已处理的事件ID以服务端为准
+func (wm *WalletManager) resetReceivedPushEventID(acked uint64) error {
+
+	db, err := wm.pushDB()
+	if err != nil {
+		return err
+	}
+
+	cursor, err := wm.receivedPushCursor(db)
+	if err != nil {
+		return err
+	}
+
+	cursor.Acked = acked
+	cursor.UpdatedAt = time.Now().Unix()
+	return db.Save(cursor)
+}
+
+//pushEventNotify 把服务端推送的事件通知给观测者，充值交易按扫描对象提取后通知。
+//height为已处理的推送区块高度，充值交易按该高度计算确认数，之后的区块头到达时通知达到确认数的充值，
+//分叉的孤块区块头到达时撤回该高度及以上已通知的提取结果。
+//有观测者通知失败时返回错误，事件不确认，由服务端重新推送
+func (bs *BEAMBlockScanner) pushEventNotify(e *PushEvent, height uint64) error {
+
+	switch e.Type {
+	case PushEventDeposit:
+		if e.Tx == nil {
+			return fmt.Errorf("push event %d has no transaction", e.ID)
+		}
+		result := bs.ExtractTransaction(e.Height, e.Hash, e.Tx, bs.ScanTargetFunc)
+		if !result.Success {
+			return fmt.Errorf("push event %d extract transaction: %s failed", e.ID, e.Tx.TxID)
+		}
+		return bs.extractDataRecordsNotify(e.Height, height, result.extractData)
+	case PushEventHeader:
+		if e.Block == nil {
+			return fmt.Errorf("push event %d has no block", e.ID)
+		}
+		if e.Fork {
+			err := bs.retractPushedExtractData(e.Height)
+			if err != nil {
+				return err
+			}
+		}
+		header := e.Block.BlockHeader(bs.wm.Symbol())
+		header.Fork = e.Fork
+		var notifyErr error
+		for o, _ := range bs.Observers {
+			observer, ok := o.(PushBlockObserver)
+			if !ok {
+				continue
+			}
+			err := observer.PushBlockNotify(header)
+			if err != nil {
+				bs.wm.Log.Error("PushBlockNotify unexpected error:", err)
+				notifyErr = err
+			}
+		}
+		if !e.Fork {
+			bs.confirmNotify(e.Height)
+		}
+		return notifyErr
+	}
+
+	bs.wm.Log.Warningf("Unknown push event %d type: %s", e.ID, e.Type)
+
+	return nil
+}
+
+//retractPushedExtractData 服务端推送孤块时，撤回大于等于该高度的已通知提取结果，撤回未全部完成时返回错误
+func (bs *BEAMBlockScanner) retractPushedExtractData(fromHeight uint64) error {
+
+	err := bs.wm.MarkBlockExtractDataRetracting(fromHeight)
+	if err != nil {
+		return err
+	}
+
+	bs.retractNotify()
+
+	list, err := bs.wm.GetRetractingBlockExtractDataRecords()
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		return fmt.Errorf("%d extract data records from block height: %d are not retracted", len(list), fromHeight)
+	}
+
+	return nil
+}
@@ -0,0 +1,408 @@
+package beam
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/blocktree/openwallet/owtp"
+)
+
+//testPushNode 模拟订阅推送的节点，记录收到的事件
+type testPushNode struct {
+	mu     sync.Mutex
+	events []*PushEvent
+	fail   int //前fail次推送只确认第一个事件并返回错误
+}
+
+func (n *testPushNode) send(nodeID string, events []*PushEvent) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail > 0 {
+		n.fail--
+		n.events = append(n.events, events[0])
+		return events[0].ID, fmt.Errorf("node is busy")
+	}
+	n.events = append(n.events, events...)
+	return events[len(events)-1].ID, nil
+}
+
+func (n *testPushNode) received() []*PushEvent {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.events
+}
+
+//testPushObserver 记录推送的区块头
+type testPushObserver struct {
+	*testObserver
+	pushed []*openwallet.BlockHeader
+	fail   int //前fail次区块头通知返回错误
+}
+
+func (o *testPushObserver) PushBlockNotify(header *openwallet.BlockHeader) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.fail > 0 {
+		o.fail--
+		return fmt.Errorf("observer is busy")
+	}
+	o.pushed = append(o.pushed, header)
+	return nil
+}
+
+//testFailObserver 前fail次提取结果通知返回错误
+type testFailObserver struct {
+	*testObserver
+	fail int
+}
+
+func (o *testFailObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	if o.fail > 0 {
+		o.fail--
+		o.mu.Unlock()
+		return fmt.Errorf("observer is busy")
+	}
+	o.mu.Unlock()
+	return o.testObserver.BlockExtractDataNotify(sourceKey, data)
+}
+
+func TestEventPusher_Scan(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(3)
+
+	pusher := NewEventPusher(wm, nil)
+
+	//首次扫描从最新高度开始，不产生事件
+	if err := pusher.Scan(); err != nil {
+		t.Fatalf("Scan failed unexpected error: %v", err)
+	}
+	events, _ := pusher.Events(0, 0)
+	if len(events) != 0 {
+		t.Fatalf("first scan events = %d, want 0", len(events))
+	}
+
+	start := srv.Tip().Height
+	srv.MineBlocks(2)
+	deposit := srv.AddTransaction(&beamtest.Tx{
+		Sender:   "outside",
+		Receiver: "user-address",
+		Value:    150000000,
+		Height:   start + 1,
+		Income:   true,
+	})
+	srv.AddTransaction(&beamtest.Tx{
+		Sender:   "user-address",
+		Receiver: "outside",
+		Value:    100000000,
+		Height:   start + 1,
+	})
+
+	if err := pusher.Scan(); err != nil {
+		t.Fatalf("Scan failed unexpected error: %v", err)
+	}
+	events, _ = pusher.Events(0, 0)
+	if len(events) != 3 {
+		t.Fatalf("scan events = %d, want 3", len(events))
+	}
+	if events[0].Type != PushEventDeposit || events[0].Tx.TxID != deposit.TxID || events[0].Height != start+1 {
+		t.Errorf("events[0] = %+v", events[0])
+	}
+	if events[1].Type != PushEventHeader || events[1].Height != start+1 || events[1].Hash != srv.BlockByHeight(start+1).Hash {
+		t.Errorf("events[1] = %+v", events[1])
+	}
+	if events[2].Type != PushEventHeader || events[2].Height != start+2 || events[2].Fork {
+		t.Errorf("events[2] = %+v", events[2])
+	}
+
+	//最新区块被替换，推送孤块的分叉区块头后重新扫描
+	orphan := srv.Tip()
+	srv.Reorg(orphan.Height, 2)
+	if err := pusher.Scan(); err != nil {
+		t.Fatalf("Scan failed unexpected error: %v", err)
+	}
+	events, _ = pusher.Events(events[2].ID, 0)
+	if len(events) != 3 {
+		t.Fatalf("reorg events = %d, want 3", len(events))
+	}
+	if !events[0].Fork || events[0].Hash != orphan.Hash {
+		t.Errorf("fork event = %+v, want orphan %s", events[0], orphan.Hash)
+	}
+	tip := srv.Tip()
+	if events[1].Height != tip.Height-1 || events[2].Height != tip.Height || events[2].Hash != tip.Hash {
+		t.Errorf("rescan events = %+v, %+v", events[1], events[2])
+	}
+}
+
+func TestEventPusher_Deliver(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(3)
+	wm.Config.pushbatchsize = 2
+
+	node := &testPushNode{fail: 1}
+	pusher := NewEventPusher(wm, node.send)
+	pusher.Scan()
+	srv.MineBlocks(1)
+	pusher.Scan()
+
+	//首次订阅从最新的事件之后开始推送
+	cursor, err := pusher.Subscribe("node-a", 0)
+	if err != nil {
+		t.Fatalf("Subscribe failed unexpected error: %v", err)
+	}
+	if cursor.Acked != 1 {
+		t.Errorf("cursor acked = %d, want 1", cursor.Acked)
+	}
+
+	srv.MineBlocks(3)
+	pusher.Scan()
+
+	//推送失败时只记录确认的事件
+	pusher.Deliver("node-a")
+	if cursor, _ = pusher.Cursor("node-a"); cursor.Acked != 2 {
+		t.Errorf("cursor acked after failure = %d, want 2", cursor.Acked)
+	}
+
+	//重新推送未确认的事件
+	pusher.Deliver("node-a")
+	if cursor, _ = pusher.Cursor("node-a"); cursor.Acked != 4 {
+		t.Errorf("cursor acked = %d, want 4", cursor.Acked)
+	}
+	received := node.received()
+	if len(received) != 3 {
+		t.Fatalf("received events = %d, want 3", len(received))
+	}
+	for i, e := range received {
+		if e.ID != uint64(i+2) {
+			t.Errorf("received[%d] = %d, want %d", i, e.ID, i+2)
+		}
+	}
+
+	//断开连接后不再推送，重新订阅时确认位置以客户端已处理的为准
+	pusher.Unsubscribe("node-a")
+	if len(pusher.Subscribers()) != 0 {
+		t.Errorf("subscribers = %v, want none", pusher.Subscribers())
+	}
+	srv.MineBlocks(1)
+	pusher.Poll()
+	if len(node.received()) != 3 {
+		t.Errorf("unsubscribed node received events = %d, want 3", len(node.received()))
+	}
+	if cursor, err = pusher.Subscribe("node-a", 3); err != nil || cursor.Acked != 4 {
+		t.Errorf("resubscribe cursor = %+v, %v, want acked 4", cursor, err)
+	}
+	pusher.Poll()
+	received = node.received()
+	if len(received) != 4 || received[3].ID != 5 {
+		t.Errorf("resubscribed node received events = %d, want 4", len(received))
+	}
+
+	//节点确认的事件比服务端最新的事件还新时（服务端推送数据被重置），从最新的事件之后开始推送
+	if cursor, err = pusher.Subscribe("node-a", 10); err != nil || cursor.Acked != 5 {
+		t.Errorf("Subscribe with acked newer than the last event = %+v, %v, want acked 5", cursor, err)
+	}
+}
+
+func TestWalletManager_ReceivePushEvents(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(3)
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{"user-address": "user"}))
+	observer := &testPushObserver{testObserver: newTestObserver()}
+	bs.AddObserver(observer)
+
+	block := srv.Tip()
+	events := []*PushEvent{
+		{ID: 1, Type: PushEventDeposit, Height: block.Height, Hash: block.Hash, Tx: &Transaction{TxID: "tx-1", Sender: "outside", Receiver: "user-address", Value: 150000000, Income: true}},
+		{ID: 2, Type: PushEventHeader, Height: block.Height, Hash: block.Hash, Block: &Block{Height: block.Height, Hash: block.Hash}},
+		{ID: 3, Type: PushEventDeposit, Height: block.Height, Hash: block.Hash},
+	}
+
+	//处理失败时确认之前的事件
+	acked, err := wm.ReceivePushEvents(events)
+	if err == nil || acked != 2 {
+		t.Errorf("ReceivePushEvents = %d, %v, want 2 and error", acked, err)
+	}
+
+	data := observer.extractData("user")
+	if len(data) != 1 || data[0].Transaction.TxID != "tx-1" || data[0].Transaction.Amount != "1.5" {
+		t.Fatalf("extract data = %+v", data)
+	}
+	if len(observer.pushed) != 1 || observer.pushed[0].Hash != block.Hash {
+		t.Errorf("pushed headers = %+v", observer.pushed)
+	}
+
+	//重发的事件不再重复通知
+	events[2].Tx = &Transaction{TxID: "tx-2", Sender: "outside", Receiver: "other-address", Income: true}
+	acked, err = wm.ReceivePushEvents(events)
+	if err != nil || acked != 3 {
+		t.Errorf("ReceivePushEvents = %d, %v, want 3", acked, err)
+	}
+	if len(observer.extractData("user")) != 1 || len(observer.pushed) != 1 {
+		t.Errorf("redelivered events should not notify again")
+	}
+	if id, _ := wm.ReceivedPushEventID(); id != 3 {
+		t.Errorf("ReceivedPushEventID = %d, want 3", id)
+	}
+
+	//观测者通知失败时不确认事件，重发后再次通知
+	failing := &testFailObserver{testObserver: newTestObserver(), fail: 1}
+	bs.AddObserver(failing)
+	observer.fail = 1
+	events = []*PushEvent{
+		{ID: 4, Type: PushEventDeposit, Height: block.Height, Hash: block.Hash, Tx: &Transaction{TxID: "tx-3", Sender: "outside", Receiver: "user-address", Value: 100000000, Income: true}},
+		{ID: 5, Type: PushEventHeader, Height: block.Height + 1, Hash: "next-hash", Block: &Block{Height: block.Height + 1, Hash: "next-hash"}},
+	}
+	if acked, err = wm.ReceivePushEvents(events); err == nil || acked != 3 {
+		t.Errorf("ReceivePushEvents with failed deposit notify = %d, %v, want 3 and error", acked, err)
+	}
+	if acked, err = wm.ReceivePushEvents(events); err == nil || acked != 4 {
+		t.Errorf("ReceivePushEvents with failed header notify = %d, %v, want 4 and error", acked, err)
+	}
+	if acked, err = wm.ReceivePushEvents(events); err != nil || acked != 5 {
+		t.Errorf("ReceivePushEvents = %d, %v, want 5", acked, err)
+	}
+	if data := failing.extractData("user"); len(data) != 1 || data[0].Transaction.TxID != "tx-3" {
+		t.Errorf("failing observer extract data = %+v", data)
+	}
+	if len(observer.pushed) != 2 || observer.pushed[1].Hash != "next-hash" {
+		t.Errorf("pushed headers = %+v", observer.pushed)
+	}
+	if id, _ := wm.ReceivedPushEventID(); id != 5 {
+		t.Errorf("ReceivedPushEventID = %d, want 5", id)
+	}
+
+	//服务端推送数据被重置后，事件ID重新开始
+	if err = wm.resetReceivedPushEventID(1); err != nil {
+		t.Fatalf("resetReceivedPushEventID failed unexpected error: %v", err)
+	}
+	events = []*PushEvent{{ID: 2, Type: PushEventHeader, Height: block.Height + 2, Hash: "reset-hash", Block: &Block{Height: block.Height + 2, Hash: "reset-hash"}}}
+	if acked, err = wm.ReceivePushEvents(events); err != nil || acked != 2 || len(observer.pushed) != 3 {
+		t.Errorf("ReceivePushEvents after reset = %d, %v, pushed %d", acked, err, len(observer.pushed))
+	}
+}
+
+func TestServer_subscribeEvents(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	route := testServerRoute(t, server, "subscribeEvents")
+	ctx := owtp.NewContext(1, 1, "node-a", "subscribeEvents", nil)
+	server.authorize(route)(ctx)
+	if ctx.Resp.Status == owtp.StatusSuccess {
+		t.Errorf("subscribeEvents should fail when push is not enabled")
+	}
+
+	wm.Config.enablepush = true
+	server.Close()
+	server, err = NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	ctx = owtp.NewContext(1, 2, "node-a", "subscribeEvents", []byte(`{"acked":0}`))
+	server.authorize(testServerRoute(t, server, "subscribeEvents"))(ctx)
+	if ctx.Resp.Status != owtp.StatusSuccess {
+		t.Fatalf("subscribeEvents response = %+v", ctx.Resp)
+	}
+	if subscribers := server.Pusher().Subscribers(); len(subscribers) != 1 || subscribers[0] != "node-a" {
+		t.Errorf("subscribers = %v", subscribers)
+	}
+
+	//等待后台推送结束再关闭数据库
+	wm.Stop()
+}
+
+func TestWalletManager_ReceivePushEvents_Confirm(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+	wm.Config.minconfirmations = 2
+
+	bs := wm.Blockscanner
+	bs.SetBlockScanTargetFunc(testScanTarget(map[string]string{"user-address": "user"}))
+	observer := &testPushObserver{testObserver: newTestObserver()}
+	bs.AddObserver(observer)
+
+	header := func(id, height uint64, hash string, fork bool) *PushEvent {
+		return &PushEvent{ID: id, Type: PushEventHeader, Height: height, Hash: hash, Fork: fork, Block: &Block{Height: height, Hash: hash}}
+	}
+	deposit := &Transaction{TxID: "tx-1", Sender: "outside", Receiver: "user-address", Value: 100000000, Income: true, BlockHash: "hash-11"}
+
+	//推送的充值未达到确认数前不通知
+	events := []*PushEvent{
+		header(1, 10, "hash-10", false),
+		{ID: 2, Type: PushEventDeposit, Height: 11, Hash: "hash-11", Tx: deposit},
+		header(3, 11, "hash-11", false),
+		header(4, 12, "hash-12", false),
+	}
+	if acked, err := wm.ReceivePushEvents(events); err != nil || acked != 4 {
+		t.Fatalf("ReceivePushEvents = %d, %v, want 4", acked, err)
+	}
+	if n := len(observer.extractData("user")); n != 0 {
+		t.Fatalf("pending deposit should not be notified, got %d", n)
+	}
+
+	if _, err := wm.ReceivePushEvents([]*PushEvent{header(5, 13, "hash-13", false)}); err != nil {
+		t.Fatalf("ReceivePushEvents failed unexpected error: %v", err)
+	}
+	data := observer.extractData("user")
+	if len(data) != 1 || data[0].Transaction.TxID != "tx-1" || data[0].Transaction.Confirm != 2 {
+		t.Fatalf("confirmed deposit = %+v", data)
+	}
+
+	//孤块的区块头到达时撤回已通知的充值
+	observer.retractFn = func(sourceKey string, data *openwallet.TxExtractData) error {
+		return fmt.Errorf("observer is busy")
+	}
+	forks := []*PushEvent{header(6, 13, "hash-13", true), header(7, 12, "hash-12", true), header(8, 11, "hash-11", true)}
+	if acked, err := wm.ReceivePushEvents(forks); err == nil || acked != 7 {
+		t.Errorf("ReceivePushEvents with failed retract = %d, %v, want 7 and error", acked, err)
+	}
+	observer.retractFn = nil
+	if acked, err := wm.ReceivePushEvents(forks); err != nil || acked != 8 {
+		t.Errorf("ReceivePushEvents = %d, %v, want 8", acked, err)
+	}
+	if retracted := observer.retractedData("user"); len(retracted) != 1 || retracted[0].Transaction.TxID != "tx-1" {
+		t.Errorf("retracted data = %+v", retracted)
+	}
+	if len(observer.pushed) != 7 {
+		t.Errorf("pushed headers = %d, want 7", len(observer.pushed))
+	}
+}
+
+func TestEventPusher_ScanMissingAncestor(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(5)
+	wm.Config.maxreorgdepth = 1
+
+	pusher := NewEventPusher(wm, nil)
+	pusher.Scan()
+	srv.MineBlocks(3)
+	if err := pusher.Scan(); err != nil {
+		t.Fatalf("Scan failed unexpected error: %v", err)
+	}
+	events, _ := pusher.Events(0, 0)
+
+	//重组深度超过已记录的区块，停在分叉处
+	srv.Reorg(srv.Tip().Height-2, 4)
+	for i := 0; i < 2; i++ {
+		if err := pusher.Scan(); err == nil {
+			t.Fatalf("Scan should fail when the common ancestor is not found")
+		}
+	}
+	after, _ := pusher.Events(events[len(events)-1].ID, 0)
+	for _, e := range after {
+		if !e.Fork {
+			t.Errorf("event after the missing ancestor = %+v, want fork headers only", e)
+		}
+	}
+}
@@ -1,20 +1,42 @@
 package beam
 
 import (
+	"context"
 	"fmt"
 	"github.com/blocktree/openwallet/log"
 	"github.com/imroc/req"
 	"github.com/tidwall/gjson"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+//idempotentMethods 可以安全重试的钱包JSON-RPC方法
+var idempotentMethods = map[string]bool{
+	"tx_status":        true,
+	"tx_list":          true,
+	"wallet_status":    true,
+	"addr_list":        true,
+	"validate_address": true,
+	"get_utxo":         true,
+	"generate_tx_id":   true,
+}
+
 // A Client is a Bitcoin RPC client. It performs RPCs over HTTP using JSON
 // request and responses. A Client must be configured with a secret token
 // to authenticate with other Cores on the network.
 type WalletClient struct {
+	seq                    uint64 //JSON-RPC请求id，原子递增
 	WalletAPI, ExplorerAPI string
 	Debug                  bool
+	Timeout                time.Duration //单次请求超时时限
+	MaxRetries             int           //幂等请求失败后的最多重试次数
+	RetryBackoff           time.Duration //首次重试前的等待时间，之后每次翻倍
+	MaxBatchAddressCount   uint64        //批量创建地址的最大数量，0不限制
+	MaxBatchAddressWorker  uint64        //批量创建地址的最大并行线程数，0不限制
+	auth                   WalletAuth    //认证信息
 	client                 *req.Req
 }
 
@@ -23,122 +45,178 @@ func NewWalletClient(walletAPI, explorerAPI string, debug bool) *WalletClient {
 	walletAPI = strings.TrimSuffix(walletAPI, "/")
 	explorerAPI = strings.TrimSuffix(explorerAPI, "/")
 	c := WalletClient{
-		WalletAPI:   walletAPI,
-		ExplorerAPI: explorerAPI,
-		Debug:       debug,
+		WalletAPI:    walletAPI,
+		ExplorerAPI:  explorerAPI,
+		Debug:        debug,
+		Timeout:      DefaultRPCTimeout,
+		MaxRetries:   DefaultRPCMaxRetries,
+		RetryBackoff: DefaultRPCRetryBackoff,
+
+		MaxBatchAddressCount:  DefaultMaxBatchAddressCount,
+		MaxBatchAddressWorker: DefaultMaxBatchAddressWorker,
 	}
 
 	api := req.New()
-	//trans, _ := api.Client().Transport.(*http.Transport)
-	//trans.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	c.client = api
 
 	return &c
 }
 
 // Call calls a remote procedure on another node, specified by the path.
-func (c *WalletClient) call(method string, request interface{}) (*gjson.Result, error) {
+func (c *WalletClient) call(ctx context.Context, method string, request interface{}) (*gjson.Result, error) {
 
 	var (
-		body = make(map[string]interface{}, 0)
+		body    = make(map[string]interface{}, 0)
+		retries = 0
 	)
 
 	if c.client == nil {
 		return nil, fmt.Errorf("API url is not setup. ")
 	}
 
-	authHeader := req.Header{
-		"Accept":       "application/json",
-		"Content-Type": "application/json",
-	}
+	authHeader := c.header()
+	authHeader["Accept"] = "application/json"
+	authHeader["Content-Type"] = "application/json"
 
 	//json-rpc
 	body["jsonrpc"] = "2.0"
-	body["id"] = 1
+	id := atomic.AddUint64(&c.seq, 1)
+	body["id"] = id
 	body["method"] = method
 	body["params"] = request
 
-	if c.Debug {
-		log.Std.Info("Start Request API...")
+	if idempotentMethods[method] {
+		retries = c.MaxRetries
 	}
 
-	r, err := c.client.Post(c.WalletAPI, req.BodyJSON(&body), authHeader)
+	r, err := c.do(ctx, c.WalletAPI, retries, func(ctx context.Context) (*req.Resp, error) {
+		return c.client.Post(c.WalletAPI, req.BodyJSON(&body), authHeader, ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if c.Debug {
-		log.Std.Info("Request API Completed")
+	resp := gjson.ParseBytes(r.Bytes())
+	err = c.isError(resp)
+	if err != nil {
+		rpcErr := err.(*RPCError)
+		rpcErr.Method = method
+		rpcErr.ID = id
+		return nil, rpcErr
 	}
 
-	if c.Debug {
-		log.Std.Info("%+v", r)
+	result := resp.Get("result")
+
+	return &result, nil
+}
+
+// GET
+func (c *WalletClient) get(ctx context.Context, path string) (*gjson.Result, error) {
+
+	if c.client == nil {
+		return nil, fmt.Errorf("API url is not setup. ")
 	}
 
+	path = c.ExplorerAPI + "/" + path
+
+	r, err := c.do(ctx, path, c.MaxRetries, func(ctx context.Context) (*req.Resp, error) {
+		return c.client.Get(path, c.header(), ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	resp := gjson.ParseBytes(r.Bytes())
-	err = c.isError(r)
+	err = c.isError(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	result := resp.Get("result")
+	return &resp, nil
+}
 
-	return &result, nil
+//do 发送请求，网络错误和服务端错误最多重试retries次，每次重试前的等待时间翻倍
+func (c *WalletClient) do(ctx context.Context, url string, retries int, send func(ctx context.Context) (*req.Resp, error)) (*req.Resp, error) {
+
+	backoff := c.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+
+		r, err := c.send(ctx, url, send)
+		if err == nil {
+			return r, nil
+		}
+
+		if attempt >= retries || !isRetryableError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		log.Std.Warn("Request API failed, retry after %v: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
 }
 
-// GET
-func (c *WalletClient) get(path string) (*gjson.Result, error) {
+//send 按单次请求超时时限发送一次请求，并读取完整的响应
+func (c *WalletClient) send(ctx context.Context, url string, send func(ctx context.Context) (*req.Resp, error)) (*req.Resp, error) {
 
-	if c.client == nil {
-		return nil, fmt.Errorf("API url is not setup. ")
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
 
 	if c.Debug {
 		log.Std.Info("Start Request API...")
 	}
 
-	path = c.ExplorerAPI + "/" + path
-
-	r, err := c.client.Get(path)
+	r, err := send(ctx)
+	if err == nil {
+		//超时取消前读取响应内容
+		_, err = r.ToBytes()
+	}
 
 	if c.Debug {
 		log.Std.Info("Request API Completed")
 	}
 
-	if c.Debug {
-		log.Std.Info("%+v", r)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, &TransportError{URL: url, Err: err}
 	}
 
-	if err != nil {
-		return nil, err
+	//只记录响应，请求头中有Authorization凭证
+	if c.Debug {
+		log.Std.Info("Response: [%d] %s", r.Response().StatusCode, r.String())
 	}
 
-	resp := gjson.ParseBytes(r.Bytes())
-	err = c.isError(r)
-	if err != nil {
-		return nil, err
+	if r.Response().StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{
+			URL:        url,
+			StatusCode: r.Response().StatusCode,
+			Status:     r.Response().Status,
+		}
 	}
 
-	return &resp, nil
+	return r, nil
 }
 
 //isError 是否报错
-func (c *WalletClient) isError(r *req.Resp) error {
-
-	if r.Response().StatusCode != http.StatusOK {
-		message := r.Response().Status
-		status := r.Response().StatusCode
-		return fmt.Errorf("[%d]%s", status, message)
-	}
-
-	result := gjson.ParseBytes(r.Bytes())
+func (c *WalletClient) isError(result gjson.Result) error {
 
 	if result.Get("error").IsObject() {
 
-		return fmt.Errorf("[%d]%s",
-			result.Get("error.code").Int(),
-			result.Get("error.message").String())
+		return &RPCError{
+			Code:    result.Get("error.code").Int(),
+			Message: result.Get("error.message").String(),
+		}
 
 	}
 
@@ -147,165 +225,271 @@ func (c *WalletClient) isError(r *req.Resp) error {
 }
 
 //CreateAddress
-func (c *WalletClient) CreateAddress() (string, error) {
+func (c *WalletClient) CreateAddress(ctx context.Context) (string, error) {
+	return c.CreateAddressWithComment(ctx, "", AddressExpirationNever)
+}
+
+//CreateAddressWithComment 创建带备注的地址
+//@expiration 有效期：AddressExpirationNever，AddressExpiration24h
+func (c *WalletClient) CreateAddressWithComment(ctx context.Context, comment, expiration string) (string, error) {
 
 	request := map[string]interface{}{
-		"expiration": "never",
+		"expiration": expiration,
+	}
+	if len(comment) > 0 {
+		request["comment"] = comment
 	}
 
-	r, err := c.call("create_address", request)
+	r, err := c.call(ctx, "create_address", request)
 	if err != nil {
 		return "", err
 	}
 	return r.String(), nil
 }
 
-// CreateBatchAddress 批量创建地址
+// CreateBatchAddress 批量创建地址，部分地址创建失败时返回已创建的地址和*BatchAddressError
 // @count 连续创建数量
 // @workerSize 并行线程数。建议20条。
-func (c *WalletClient) CreateBatchAddress(count, workerSize uint64) ([]string, error) {
+func (c *WalletClient) CreateBatchAddress(ctx context.Context, count, workerSize uint64) ([]string, error) {
+	result, err := c.createBatchAddress(ctx, count, workerSize, c.CreateAddress)
+	if err != nil {
+		return nil, err
+	}
+	return result.Addresses, result.Err()
+}
+
+//createBatchAddress 使用create创建每个地址。
+//网络错误和服务端错误最多重试MaxRetries次，钱包返回空地址或重复地址时重新创建，
+//ctx取消后不再创建剩余的地址。参数错误才返回error，各地址的创建结果见BatchAddressResult
+func (c *WalletClient) createBatchAddress(ctx context.Context, count, workerSize uint64, create func(ctx context.Context) (string, error)) (*BatchAddressResult, error) {
+
+	if count == 0 {
+		return nil, fmt.Errorf("create address count is zero")
+	}
+
+	if c.MaxBatchAddressCount > 0 && count > c.MaxBatchAddressCount {
+		return nil, fmt.Errorf("create address count %d exceeds the maximum %d", count, c.MaxBatchAddressCount)
+	}
+
+	if c.MaxBatchAddressWorker > 0 && workerSize > c.MaxBatchAddressWorker {
+		workerSize = c.MaxBatchAddressWorker
+	}
+	if workerSize > count {
+		workerSize = count
+	}
+	if workerSize == 0 {
+		workerSize = 1
+	}
 
 	var (
-		quit         = make(chan struct{})
-		done         = uint64(0) //完成标记
-		failed       = uint64(0)
-		shouldDone   = count //需要完成的总数
-		addressArr   = make([]string, 0)
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		created      = make(map[string]bool) //已创建的地址，用于去重
+		results      = make([]*AddressCreateResult, count)
 		workPermitCH = make(chan struct{}, workerSize) //工作令牌
-		producer     = make(chan AddressCreateResult)  //生产通道
-		worker       = make(chan AddressCreateResult)  //消费通道
 	)
 
-	defer func() {
-		close(workPermitCH)
-		close(producer)
-		close(worker)
-	}()
+	//accept 登记新创建的地址，空地址或重复地址返回错误
+	accept := func(addr string) error {
+		mu.Lock()
+		defer mu.Unlock()
 
-	if count == 0 {
-		return nil, fmt.Errorf("create address count is zero")
+		if len(addr) == 0 {
+			return fmt.Errorf("wallet returned an empty address")
+		}
+		if created[addr] {
+			return fmt.Errorf("wallet returned a duplicate address: %s", addr)
+		}
+		created[addr] = true
+		return nil
 	}
 
-	//消费工作
-	consumeWork := func(result chan AddressCreateResult) {
-		//回收创建的地址
-		for gets := range result {
+	//createOne 创建第index个地址
+	createOne := func(index uint64) *AddressCreateResult {
 
-			if gets.Success {
-				addressArr = append(addressArr, gets.Address)
-			} else {
-				failed++ //标记生成失败数
+		result := &AddressCreateResult{Index: index}
+		backoff := c.RetryBackoff
+
+		for {
+			result.Attempts++
+
+			addr, err := create(ctx)
+			retryable := isRetryableError(err)
+			if err == nil {
+				err = accept(addr)
+				retryable = true
 			}
 
-			//累计完成的线程数
-			done++
-			if done == shouldDone {
-				//bs.wm.Log.Std.Info("done = %d, shouldDone = %d ", done, len(txs))
-				close(quit) //关闭通道，等于给通道传入nil
+			if err == nil {
+				result.Success = true
+				result.Address = addr
+				result.Err = nil
+				result.Error = ""
+				return result
 			}
+
+			result.Err = err
+			result.Error = err.Error()
+
+			if result.Attempts > c.MaxRetries || !retryable || ctx.Err() != nil {
+				return result
+			}
+
+			log.Std.Warn("Create address failed, retry after %v: %v", backoff, err)
+
+			select {
+			case <-ctx.Done():
+				return result
+			case <-time.After(backoff):
+			}
+			backoff *= 2
 		}
 	}
 
-	//生产工作
-	produceWork := func(eCount uint64, eProducer chan AddressCreateResult) {
-		for i := uint64(0); i < uint64(eCount); i++ {
-			workPermitCH <- struct{}{}
-			go func(end chan struct{}, mProducer chan<- AddressCreateResult) {
+	for i := uint64(0); i < count; i++ {
 
-				//生成地址
-				addr, createErr := c.CreateAddress()
-				result := AddressCreateResult{
-					Success: true,
-					Address: addr,
-					Err:     createErr,
-				}
-				mProducer <- result
-				//释放
-				<-end
+		select {
+		case <-ctx.Done():
+		case workPermitCH <- struct{}{}:
+		}
 
-			}(workPermitCH, eProducer)
+		if ctx.Err() != nil {
+			//取消后剩余的地址不再创建
+			for j := i; j < count; j++ {
+				results[j] = &AddressCreateResult{
+					Index: j,
+					Err:   ctx.Err(),
+					Error: ctx.Err().Error(),
+				}
+			}
+			break
 		}
+
+		wg.Add(1)
+		go func(index uint64) {
+			defer wg.Done()
+			results[index] = createOne(index)
+			//释放
+			<-workPermitCH
+		}(i)
 	}
 
-	//独立线程运行消费
-	go consumeWork(worker)
+	wg.Wait()
 
-	//独立线程运行生产
-	go produceWork(count, producer)
+	batch := &BatchAddressResult{
+		Count:     count,
+		Addresses: make([]string, 0, count),
+		Failed:    make([]*AddressCreateResult, 0),
+		Canceled:  ctx.Err() != nil,
+	}
 
-	//以下使用生产消费模式
-	batchCreateAddressRuntime(producer, worker, quit)
+	for _, r := range results {
+		if r.Success {
+			batch.Addresses = append(batch.Addresses, r.Address)
+		} else {
+			batch.Failed = append(batch.Failed, r)
+		}
+	}
 
-	if failed > 0 {
-		log.Debugf("create address failed: %d", failed)
+	if len(batch.Failed) > 0 {
+		log.Std.Warn("create address failed: %d of %d", len(batch.Failed), count)
 	}
 
-	return addressArr, nil
+	return batch, nil
 }
 
-//batchCreateAddressRuntime 运行时
-func batchCreateAddressRuntime(producer chan AddressCreateResult, worker chan AddressCreateResult, quit chan struct{}) {
+//GetAddressList 钱包中未过期的自有地址
+func (c *WalletClient) GetAddressList(ctx context.Context) ([]string, error) {
 
-	var (
-		values = make([]AddressCreateResult, 0)
-	)
+	list, err := c.GetAddresses(ctx, true)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
+	addrs := make([]string, 0)
+	for _, a := range list {
+		if a.Own && a.Expired == false {
+			addrs = append(addrs, a.Address)
+		}
+	}
 
-		var activeWorker chan<- AddressCreateResult
-		var activeValue AddressCreateResult
+	return addrs, nil
+}
 
-		//当数据队列有数据时，释放顶部，传输给消费者
-		if len(values) > 0 {
-			activeWorker = worker
-			activeValue = values[0]
+//GetAddresses 地址簿中的地址，own为true时只返回自有地址，否则只返回联系人地址
+func (c *WalletClient) GetAddresses(ctx context.Context, own bool) ([]*WalletAddress, error) {
 
-		}
+	request := map[string]interface{}{
+		"own": own,
+	}
 
-		select {
+	r, err := c.call(ctx, "addr_list", request)
+	if err != nil {
+		return nil, err
+	}
 
-		//生成者不断生成数据，插入到数据队列尾部
-		case pa := <-producer:
-			values = append(values, pa)
-		case <-quit:
-			//退出
-			return
-		case activeWorker <- activeValue:
-			values = values[1:]
+	addrs := make([]*WalletAddress, 0)
+	if r.IsArray() {
+		for _, a := range r.Array() {
+			addrs = append(addrs, NewWalletAddress(&a))
 		}
 	}
 
+	return addrs, nil
 }
 
-//GetAddressList
-func (c *WalletClient) GetAddressList() ([]string, error) {
+//ValidateAddress 校验地址格式，并检查是否为钱包自有地址
+func (c *WalletClient) ValidateAddress(ctx context.Context, address string) (*AddressValidation, error) {
 
 	request := map[string]interface{}{
-		"own": true,
+		"address": address,
 	}
 
-	r, err := c.call("addr_list", request)
+	r, err := c.call(ctx, "validate_address", request)
 	if err != nil {
 		return nil, err
 	}
+	return NewAddressValidation(r), nil
+}
 
-	addrs := make([]string, 0)
-	if r.IsArray() {
-		for _, a := range r.Array() {
-			own := a.Get("own").Bool()
-			expired := a.Get("expired").Bool()
-			if own && expired == false {
-				addrs = append(addrs, a.Get("address").String())
-			}
+//EditAddress 修改地址备注或有效期
+//@comment 新的备注，为空时不修改
+//@expiration 新的有效期：AddressExpirationExpired，AddressExpirationNever，AddressExpiration24h，为空时不修改
+func (c *WalletClient) EditAddress(ctx context.Context, address, comment, expiration string) error {
 
-		}
+	request := map[string]interface{}{
+		"address": address,
+	}
+	if len(comment) > 0 {
+		request["comment"] = comment
+	}
+	if len(expiration) > 0 {
+		request["expiration"] = expiration
 	}
 
-	return addrs, nil
+	_, err := c.call(ctx, "edit_address", request)
+	return err
+}
+
+//DeleteAddress 从地址簿中删除地址
+func (c *WalletClient) DeleteAddress(ctx context.Context, address string) error {
+
+	request := map[string]interface{}{
+		"address": address,
+	}
+
+	_, err := c.call(ctx, "delete_address", request)
+	return err
 }
 
 //SendTransaction
-func (c *WalletClient) SendTransaction(from, to string, value, fee uint64, comment string) (string, error) {
+func (c *WalletClient) SendTransaction(ctx context.Context, from, to string, value, fee uint64, comment string) (string, error) {
+	return c.SendTransactionWithTxID(ctx, from, to, value, fee, comment, "")
+}
+
+//SendTransactionWithTxID 使用generate_tx_id生成的交易单号发送交易，txid为空时由钱包生成。
+//相同txid的交易钱包不会重复发送
+func (c *WalletClient) SendTransactionWithTxID(ctx context.Context, from, to string, value, fee uint64, comment, txid string) (string, error) {
 
 	request := map[string]interface{}{
 		"value":   value,
@@ -315,17 +499,49 @@ func (c *WalletClient) SendTransaction(from, to string, value, fee uint64, comme
 		"comment": comment,
 	}
 
-	r, err := c.call("tx_send", request)
+	if len(txid) > 0 {
+		request["txId"] = txid
+	}
+
+	r, err := c.call(ctx, "tx_send", request)
+	if err != nil {
+		return "", err
+	}
+	if sent := r.Get("txId").String(); len(sent) > 0 {
+		return sent, nil
+	}
+	return txid, nil
+}
+
+//SplitCoins 把钱包余额拆分成指定面额的币，返回交易单号
+func (c *WalletClient) SplitCoins(ctx context.Context, coins []uint64, fee uint64) (string, error) {
+
+	request := map[string]interface{}{
+		"coins": coins,
+		"fee":   fee,
+	}
+
+	r, err := c.call(ctx, "tx_split", request)
 	if err != nil {
 		return "", err
 	}
 	return r.Get("txId").String(), nil
 }
 
+//GenerateTxID 生成新的交易单号
+func (c *WalletClient) GenerateTxID(ctx context.Context) (string, error) {
+
+	r, err := c.call(ctx, "generate_tx_id", nil)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
 //GetBlockchainInfo
-func (c *WalletClient) GetBlockchainInfo() (*BlockchainInfo, error) {
+func (c *WalletClient) GetBlockchainInfo(ctx context.Context) (*BlockchainInfo, error) {
 
-	r, err := c.get("status")
+	r, err := c.get(ctx, "status")
 	if err != nil {
 		return nil, err
 	}
@@ -334,9 +550,9 @@ func (c *WalletClient) GetBlockchainInfo() (*BlockchainInfo, error) {
 }
 
 //GetBlockByHeight
-func (c *WalletClient) GetBlockByHeight(height uint64) (*Block, error) {
+func (c *WalletClient) GetBlockByHeight(ctx context.Context, height uint64) (*Block, error) {
 	path := fmt.Sprintf("block?height=%d", height)
-	r, err := c.get(path)
+	r, err := c.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -345,9 +561,9 @@ func (c *WalletClient) GetBlockByHeight(height uint64) (*Block, error) {
 }
 
 //GetBlockByHash
-func (c *WalletClient) GetBlockByHash(hash string) (*Block, error) {
+func (c *WalletClient) GetBlockByHash(ctx context.Context, hash string) (*Block, error) {
 	path := fmt.Sprintf("block?hash=%s", hash)
-	r, err := c.get(path)
+	r, err := c.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -356,9 +572,9 @@ func (c *WalletClient) GetBlockByHash(hash string) (*Block, error) {
 }
 
 //GetBlockByKernel
-func (c *WalletClient) GetBlockByKernel(kernel string) (*Block, error) {
+func (c *WalletClient) GetBlockByKernel(ctx context.Context, kernel string) (*Block, error) {
 	path := fmt.Sprintf("block?kernel=%s", kernel)
-	r, err := c.get(path)
+	r, err := c.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -367,12 +583,12 @@ func (c *WalletClient) GetBlockByKernel(kernel string) (*Block, error) {
 }
 
 //GetTransaction
-func (c *WalletClient) GetTransaction(txid string) (*Transaction, error) {
+func (c *WalletClient) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
 	request := map[string]interface{}{
 		"txId": txid,
 	}
 
-	r, err := c.call("tx_status", request)
+	r, err := c.call(ctx, "tx_status", request)
 	if err != nil {
 		return nil, err
 	}
@@ -380,42 +596,42 @@ func (c *WalletClient) GetTransaction(txid string) (*Transaction, error) {
 }
 
 //GetTransactionsByHeight
-func (c *WalletClient) GetTransactionsByHeight(height uint64) ([]*Transaction, error) {
-	request := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"status": 3,
-			"height": height,
-		},
-		//"skip":  0,
-		//"count": 10,
-	}
+func (c *WalletClient) GetTransactionsByHeight(ctx context.Context, height uint64) ([]*Transaction, error) {
+	return c.ListTransactions(ctx, TxListFilter{
+		Status: TxStatusCompleted,
+		Height: height,
+	})
+}
 
-	r, err := c.call("tx_list", request)
-	if err != nil {
-		return nil, err
-	}
+//GetTransactionsByStatus
+func (c *WalletClient) GetTransactionsByStatus(ctx context.Context, status int) ([]*Transaction, error) {
+	return c.ListTransactions(ctx, TxListFilter{
+		Status: status,
+	})
+}
 
-	txs := make([]*Transaction, 0)
-	if r.IsArray() {
-		for _, obj := range r.Array() {
-			tx := NewTransaction(&obj)
-			txs = append(txs, tx)
+//ListTransactions 按条件分页查询交易单，新的交易排在前面
+func (c *WalletClient) ListTransactions(ctx context.Context, filter TxListFilter) ([]*Transaction, error) {
 
-		}
+	conditions := make(map[string]interface{})
+	if filter.Status != TxStatusAny {
+		conditions["status"] = filter.Status
+	}
+	if filter.Height > 0 {
+		conditions["height"] = filter.Height
 	}
 
-	return txs, nil
-}
-
-//GetTransactionsByStatus
-func (c *WalletClient) GetTransactionsByStatus(status int) ([]*Transaction, error) {
 	request := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"status": status,
-		},
+		"filter": conditions,
+	}
+	if filter.Skip > 0 {
+		request["skip"] = filter.Skip
+	}
+	if filter.Count > 0 {
+		request["count"] = filter.Count
 	}
 
-	r, err := c.call("tx_list", request)
+	r, err := c.call(ctx, "tx_list", request)
 	if err != nil {
 		return nil, err
 	}
@@ -433,9 +649,9 @@ func (c *WalletClient) GetTransactionsByStatus(status int) ([]*Transaction, erro
 }
 
 //GetWalletStatus
-func (c *WalletClient) GetWalletStatus() (*WalletStatus, error) {
+func (c *WalletClient) GetWalletStatus(ctx context.Context) (*WalletStatus, error) {
 
-	r, err := c.call("wallet_status", nil)
+	r, err := c.call(ctx, "wallet_status", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -443,15 +659,51 @@ func (c *WalletClient) GetWalletStatus() (*WalletStatus, error) {
 }
 
 //CancelTx 取消交易
-func (c *WalletClient) CancelTx(txid string) (bool, error) {
+func (c *WalletClient) CancelTx(ctx context.Context, txid string) (bool, error) {
 	request := map[string]interface{}{
 		"txId": txid,
 	}
 
-	r, err := c.call("tx_cancel", request)
+	r, err := c.call(ctx, "tx_cancel", request)
 	if err != nil {
 		return false, err
 	}
 
 	return r.Bool(), nil
+}
+
+//DeleteTx 删除已完成、已取消或失败的交易单
+func (c *WalletClient) DeleteTx(ctx context.Context, txid string) error {
+	request := map[string]interface{}{
+		"txId": txid,
+	}
+
+	_, err := c.call(ctx, "tx_delete", request)
+	return err
+}
+
+//GetUTXO 分页查询钱包中的币
+//@count 返回的最多记录数，0不限制
+func (c *WalletClient) GetUTXO(ctx context.Context, skip, count uint64) ([]*UTXO, error) {
+	request := map[string]interface{}{}
+	if skip > 0 {
+		request["skip"] = skip
+	}
+	if count > 0 {
+		request["count"] = count
+	}
+
+	r, err := c.call(ctx, "get_utxo", request)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := make([]*UTXO, 0)
+	if r.IsArray() {
+		for _, obj := range r.Array() {
+			utxos = append(utxos, NewUTXO(&obj))
+		}
+	}
+
+	return utxos, nil
 }
\ No newline at end of file
@@ -0,0 +1,542 @@
+package beam
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestWalletClient_Mock_Blocks(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(5)
+	tip := srv.Tip()
+
+	info, err := wm.walletClient.GetBlockchainInfo(context.Background())
+	if err != nil {
+		t.Fatalf("GetBlockchainInfo failed unexpected error: %v", err)
+	}
+	if info.Height != tip.Height || info.Hash != tip.Hash {
+		t.Errorf("GetBlockchainInfo = %d:%s, want %d:%s", info.Height, info.Hash, tip.Height, tip.Hash)
+	}
+
+	block, err := wm.walletClient.GetBlockByHeight(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("GetBlockByHeight failed unexpected error: %v", err)
+	}
+	if !block.Found || block.PrevBlockHash != srv.BlockByHeight(2).Hash {
+		t.Errorf("GetBlockByHeight = %+v", block)
+	}
+
+	byHash, err := wm.walletClient.GetBlockByHash(context.Background(), block.Hash)
+	if err != nil {
+		t.Fatalf("GetBlockByHash failed unexpected error: %v", err)
+	}
+	if byHash.Height != 3 {
+		t.Errorf("GetBlockByHash height = %d, want 3", byHash.Height)
+	}
+
+	missing, err := wm.walletClient.GetBlockByHeight(context.Background(), tip.Height+1)
+	if err != nil {
+		t.Fatalf("GetBlockByHeight failed unexpected error: %v", err)
+	}
+	if missing.Found {
+		t.Errorf("block above the tip should not be found")
+	}
+
+	tx := srv.AddTransaction(&beamtest.Tx{Value: 100, Height: 4, Income: true})
+	byKernel, err := wm.walletClient.GetBlockByKernel(context.Background(), tx.Kernel)
+	if err != nil {
+		t.Fatalf("GetBlockByKernel failed unexpected error: %v", err)
+	}
+	if byKernel.Height != 4 {
+		t.Errorf("GetBlockByKernel height = %d, want 4", byKernel.Height)
+	}
+}
+
+func TestWalletClient_Mock_SendAndCancel(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 1000})
+
+	addr, err := wm.walletClient.CreateAddress(context.Background())
+	if err != nil {
+		t.Fatalf("CreateAddress failed unexpected error: %v", err)
+	}
+
+	addrs, err := wm.walletClient.GetAddressList(context.Background())
+	if err != nil {
+		t.Fatalf("GetAddressList failed unexpected error: %v", err)
+	}
+	if len(addrs) != 2 || addrs[1] != addr {
+		t.Errorf("GetAddressList = %v, want created address %s", addrs, addr)
+	}
+
+	txid, err := wm.walletClient.SendTransaction(context.Background(), addr, "receiver", 300, 1, "withdraw")
+	if err != nil {
+		t.Fatalf("SendTransaction failed unexpected error: %v", err)
+	}
+
+	tx, err := wm.walletClient.GetTransaction(context.Background(), txid)
+	if err != nil {
+		t.Fatalf("GetTransaction failed unexpected error: %v", err)
+	}
+	if tx.Status != TxStatusInProgress || tx.Value != 300 || tx.Receiver != "receiver" {
+		t.Errorf("GetTransaction = %+v", tx)
+	}
+
+	status, err := wm.walletClient.GetWalletStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetWalletStatus failed unexpected error: %v", err)
+	}
+	if status.Available != 699 || status.Sending != 300 {
+		t.Errorf("GetWalletStatus = %+v", status)
+	}
+
+	inProgress, err := wm.walletClient.GetTransactionsByStatus(context.Background(), TxStatusInProgress)
+	if err != nil {
+		t.Fatalf("GetTransactionsByStatus failed unexpected error: %v", err)
+	}
+	if len(inProgress) != 1 || inProgress[0].TxID != txid {
+		t.Errorf("GetTransactionsByStatus = %v", inProgress)
+	}
+
+	flag, err := wm.walletClient.CancelTx(context.Background(), txid)
+	if err != nil || !flag {
+		t.Fatalf("CancelTx = %v, %v", flag, err)
+	}
+
+	if _, err = wm.walletClient.CancelTx(context.Background(), txid); err == nil {
+		t.Errorf("cancel a cancelled tx should fail")
+	}
+}
+
+func TestWalletClient_Mock_Errors(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+
+	if _, err := wm.walletClient.GetTransaction(context.Background(), "unknown"); err == nil {
+		t.Errorf("GetTransaction of unknown tx should fail")
+	}
+
+	srv.FailRPC("wallet_status", -32603, "Internal JSON-RPC error.", 1)
+	_, err := wm.walletClient.GetWalletStatus(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "[-32603]") {
+		t.Errorf("GetWalletStatus error = %v, want JSON-RPC error", err)
+	}
+	if _, ok := err.(*RPCError); !ok {
+		t.Errorf("GetWalletStatus error type = %T, want *RPCError", err)
+	}
+	if _, err = wm.walletClient.GetWalletStatus(context.Background()); err != nil {
+		t.Errorf("GetWalletStatus failed unexpected error: %v", err)
+	}
+
+	//重试次数用完仍然失败
+	srv.FailHTTP("status", 502, wm.walletClient.MaxRetries+1)
+	_, err = wm.walletClient.GetBlockchainInfo(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "[502]") {
+		t.Errorf("GetBlockchainInfo error = %v, want http status error", err)
+	}
+	if e, ok := err.(*HTTPStatusError); !ok || e.StatusCode != 502 {
+		t.Errorf("GetBlockchainInfo error type = %T, want *HTTPStatusError", err)
+	}
+}
+
+func TestWalletClient_Mock_RPCError(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	ctx := context.Background()
+
+	_, err := wm.walletClient.GetTransaction(ctx, "unknown")
+	rpcErr, ok := err.(*RPCError)
+	if !ok || !IsTxNotFound(err) || rpcErr.Method != "tx_status" || rpcErr.ID == 0 {
+		t.Errorf("GetTransaction error = %#v, want tx not found", err)
+	}
+
+	_, err = wm.walletClient.SendTransaction(ctx, "", "", 100, 1, "")
+	if !IsInvalidAddress(err) {
+		t.Errorf("SendTransaction error = %v, want invalid address", err)
+	}
+	if owErr := openwallet.ConvertError(OpenwalletError(err, openwallet.ErrSubmitRawTransactionFailed)); owErr.Code() != openwallet.ErrAdressDecodeFailed {
+		t.Errorf("invalid address openwallet code = %d", owErr.Code())
+	}
+
+	_, err = wm.walletClient.SendTransaction(ctx, "", "receiver", 100, 1, "")
+	if !IsInsufficientFunds(err) {
+		t.Errorf("SendTransaction error = %v, want insufficient funds", err)
+	}
+
+	tx := srv.AddTransaction(&beamtest.Tx{Value: 100, Height: 1})
+	_, err = wm.walletClient.CancelTx(ctx, tx.TxID)
+	if !IsInvalidTxStatus(err) || IsTxNotFound(err) {
+		t.Errorf("CancelTx error = %v, want invalid tx status", err)
+	}
+
+	srv.FailHTTP("wallet_status", 502, wm.walletClient.MaxRetries+1)
+	_, err = wm.walletClient.GetWalletStatus(ctx)
+	if owErr := openwallet.ConvertError(OpenwalletError(err, openwallet.ErrUnknownException)); owErr.Code() != openwallet.ErrCallFullNodeAPIFailed {
+		t.Errorf("unavailable openwallet code = %d", owErr.Code())
+	}
+	if OpenwalletError(nil, openwallet.ErrUnknownException) != nil {
+		t.Errorf("nil error should stay nil")
+	}
+}
+
+func TestWalletClient_Mock_Retry(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	ctx := context.Background()
+
+	//幂等请求遇到服务端错误重试
+	srv.FailHTTP("wallet_status", 502, 2)
+	if _, err := wm.walletClient.GetWalletStatus(ctx); err != nil {
+		t.Errorf("GetWalletStatus should succeed after retry, got %v", err)
+	}
+	if n := srv.Calls("wallet_status"); n != 3 {
+		t.Errorf("wallet_status calls = %d, want 3", n)
+	}
+
+	srv.FailHTTP("block", 503, 1)
+	if _, err := wm.walletClient.GetBlockByHeight(ctx, 1); err != nil {
+		t.Errorf("GetBlockByHeight should succeed after retry, got %v", err)
+	}
+
+	//JSON-RPC错误对象不重试
+	srv.FailRPC("tx_list", -32603, "Internal JSON-RPC error.", 1)
+	if _, err := wm.walletClient.GetTransactionsByStatus(ctx, TxStatusInProgress); err == nil {
+		t.Errorf("GetTransactionsByStatus should return JSON-RPC error")
+	}
+	if n := srv.Calls("tx_list"); n != 1 {
+		t.Errorf("tx_list calls = %d, want 1", n)
+	}
+
+	//非幂等请求不重试，避免重复发送交易
+	srv.FailHTTP("tx_send", 502, 1)
+	if _, err := wm.walletClient.SendTransaction(ctx, "", "receiver", 100, 1, ""); err == nil {
+		t.Errorf("SendTransaction should fail without retry")
+	}
+	if n := srv.Calls("tx_send"); n != 1 {
+		t.Errorf("tx_send calls = %d, want 1", n)
+	}
+}
+
+func TestWalletClient_Mock_Timeout(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.walletClient.Timeout = 50 * time.Millisecond
+	wm.walletClient.MaxRetries = 0
+
+	srv.Delay("wallet_status", 5*time.Second, 1)
+	start := time.Now()
+	_, err := wm.walletClient.GetWalletStatus(context.Background())
+	if e, ok := err.(*TransportError); !ok || !e.Timeout() {
+		t.Errorf("GetWalletStatus error = %v, want timeout transport error", err)
+	}
+	if cost := time.Since(start); cost > 2*time.Second {
+		t.Errorf("GetWalletStatus should time out quickly, cost %v", cost)
+	}
+
+	//上下文取消后不再重试
+	wm.walletClient.Timeout = 0
+	wm.walletClient.MaxRetries = 3
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	srv.Delay("status", 5*time.Second, 4)
+	_, err = wm.walletClient.GetBlockchainInfo(ctx)
+	if _, ok := err.(*TransportError); !ok {
+		t.Errorf("GetBlockchainInfo error = %v, want transport error", err)
+	}
+	if n := srv.Calls("status"); n != 1 {
+		t.Errorf("status calls = %d, want 1", n)
+	}
+}
+
+func TestWalletClient_Mock_GetTransactionsByHeight(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(3)
+
+	tx := srv.AddTransaction(&beamtest.Tx{Value: 100, Height: 2, Income: true})
+	srv.AddTransaction(&beamtest.Tx{Value: 200, Height: 3, Income: true})
+	srv.AddTransaction(&beamtest.Tx{Value: 300, Status: beamtest.TxStatusInProgress})
+
+	txs, err := wm.walletClient.GetTransactionsByHeight(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("GetTransactionsByHeight failed unexpected error: %v", err)
+	}
+	if len(txs) != 1 || txs[0].TxID != tx.TxID || txs[0].Confirmations != 3 {
+		t.Errorf("GetTransactionsByHeight = %+v", txs)
+	}
+}
+
+func TestWalletClient_Mock_Addresses(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	ctx := context.Background()
+
+	addr, err := wm.walletClient.CreateAddress(ctx)
+	if err != nil {
+		t.Fatalf("CreateAddress failed unexpected error: %v", err)
+	}
+
+	valid, err := wm.walletClient.ValidateAddress(ctx, addr)
+	if err != nil {
+		t.Fatalf("ValidateAddress failed unexpected error: %v", err)
+	}
+	if !valid.IsValid || !valid.IsMine {
+		t.Errorf("ValidateAddress = %+v, want valid own address", valid)
+	}
+	if valid, _ = wm.walletClient.ValidateAddress(ctx, "not an address"); valid == nil || valid.IsValid {
+		t.Errorf("ValidateAddress = %+v, want invalid", valid)
+	}
+
+	if err = wm.walletClient.EditAddress(ctx, addr, "deposit", AddressExpiration24h); err != nil {
+		t.Fatalf("EditAddress failed unexpected error: %v", err)
+	}
+	addrs, err := wm.walletClient.GetAddresses(ctx, true)
+	if err != nil {
+		t.Fatalf("GetAddresses failed unexpected error: %v", err)
+	}
+	var edited *WalletAddress
+	for _, a := range addrs {
+		if a.Address == addr {
+			edited = a
+		}
+	}
+	if edited == nil || edited.Comment != "deposit" || edited.Duration != 24*60*60 || !edited.Own || edited.CreateTime == 0 {
+		t.Errorf("GetAddresses edited address = %+v", edited)
+	}
+
+	//过期地址不再出现在可用地址列表中
+	if err = wm.walletClient.EditAddress(ctx, addr, "", AddressExpirationExpired); err != nil {
+		t.Fatalf("EditAddress failed unexpected error: %v", err)
+	}
+	list, err := wm.walletClient.GetAddressList(ctx)
+	if err != nil {
+		t.Fatalf("GetAddressList failed unexpected error: %v", err)
+	}
+	for _, a := range list {
+		if a == addr {
+			t.Errorf("expired address %s should not be listed", addr)
+		}
+	}
+	if a := srv.Addresses()[1]; a.Comment != "deposit" || !a.Expired {
+		t.Errorf("EditAddress with empty comment should keep it, got %+v", a)
+	}
+
+	if err = wm.walletClient.DeleteAddress(ctx, addr); err != nil {
+		t.Fatalf("DeleteAddress failed unexpected error: %v", err)
+	}
+	if err = wm.walletClient.DeleteAddress(ctx, addr); !IsInvalidAddress(err) {
+		t.Errorf("DeleteAddress error = %v, want invalid address", err)
+	}
+	if n := len(srv.Addresses()); n != 1 {
+		t.Errorf("address count = %d, want 1", n)
+	}
+}
+
+func TestWalletClient_Mock_TransactionPaging(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	ctx := context.Background()
+	srv.MineBlocks(2)
+
+	for i := 0; i < 5; i++ {
+		srv.AddTransaction(&beamtest.Tx{Value: uint64(100 + i), Height: 2, Income: true, CreateTime: int64(1000 + i)})
+	}
+	pending := srv.AddTransaction(&beamtest.Tx{Value: 1, Status: beamtest.TxStatusPending, CreateTime: 2000})
+
+	all, err := wm.walletClient.ListTransactions(ctx, TxListFilter{Status: TxStatusAny})
+	if err != nil {
+		t.Fatalf("ListTransactions failed unexpected error: %v", err)
+	}
+	if len(all) != 6 || all[0].TxID != pending.TxID {
+		t.Errorf("ListTransactions = %d txs, want 6 with the newest first", len(all))
+	}
+
+	page, err := wm.walletClient.ListTransactions(ctx, TxListFilter{Status: TxStatusCompleted, Height: 2, Skip: 1, Count: 2})
+	if err != nil {
+		t.Fatalf("ListTransactions failed unexpected error: %v", err)
+	}
+	if len(page) != 2 || page[0].Value != 103 || page[1].Value != 102 {
+		t.Errorf("ListTransactions page = %+v", page)
+	}
+
+	//交易单状态为0时也能按状态过滤
+	pendings, err := wm.walletClient.ListTransactions(ctx, TxListFilter{Status: TxStatusPending})
+	if err != nil {
+		t.Fatalf("ListTransactions failed unexpected error: %v", err)
+	}
+	if len(pendings) != 1 || pendings[0].TxID != pending.TxID {
+		t.Errorf("ListTransactions pending = %+v", pendings)
+	}
+
+	if err = wm.walletClient.DeleteTx(ctx, pending.TxID); !IsInvalidTxStatus(err) {
+		t.Errorf("DeleteTx error = %v, want invalid tx status", err)
+	}
+	if err = wm.walletClient.DeleteTx(ctx, page[0].TxID); err != nil {
+		t.Errorf("DeleteTx failed unexpected error: %v", err)
+	}
+	if srv.Transaction(page[0].TxID) != nil {
+		t.Errorf("deleted tx should be removed")
+	}
+
+	txid, err := wm.walletClient.GenerateTxID(ctx)
+	if err != nil || len(txid) != 32 {
+		t.Errorf("GenerateTxID = %s, %v", txid, err)
+	}
+}
+
+func TestWalletClient_Mock_Coins(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	ctx := context.Background()
+	srv.SetBalance(beamtest.WalletBalance{Available: 1000})
+
+	txid, err := wm.walletClient.SplitCoins(ctx, []uint64{200, 300}, 10)
+	if err != nil {
+		t.Fatalf("SplitCoins failed unexpected error: %v", err)
+	}
+	if tx := srv.Transaction(txid); tx == nil || tx.Value != 500 || tx.Fee != 10 {
+		t.Errorf("SplitCoins tx = %+v", tx)
+	}
+	if b := srv.Balance(); b.Available != 490 {
+		t.Errorf("balance after split = %+v", b)
+	}
+	if _, err = wm.walletClient.SplitCoins(ctx, []uint64{1000}, 10); !IsInsufficientFunds(err) {
+		t.Errorf("SplitCoins error = %v, want insufficient funds", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		srv.AddUTXO(&beamtest.UTXO{Amount: uint64(100 * (i + 1)), Maturity: 60, Status: beamtest.UTXOStatusAvailable})
+	}
+	maturing := srv.AddUTXO(&beamtest.UTXO{Amount: 50, Type: "mine", CreateTxID: txid, Status: beamtest.UTXOStatusMaturing})
+
+	utxos, err := wm.walletClient.GetUTXO(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("GetUTXO failed unexpected error: %v", err)
+	}
+	if len(utxos) != 4 {
+		t.Fatalf("GetUTXO = %d utxos, want 4", len(utxos))
+	}
+	last := utxos[3]
+	if last.ID != maturing.ID || last.Amount != 50 || last.Type != "mine" || last.CreateTxID != txid ||
+		last.Status != UTXOStatusMaturing || last.StatusString != "maturing" {
+		t.Errorf("GetUTXO = %+v", last)
+	}
+
+	page, err := wm.walletClient.GetUTXO(ctx, 1, 2)
+	if err != nil {
+		t.Fatalf("GetUTXO failed unexpected error: %v", err)
+	}
+	if len(page) != 2 || page[0].Amount != 200 || page[1].Amount != 300 {
+		t.Errorf("GetUTXO page = %+v", page)
+	}
+
+	status, err := wm.walletClient.GetWalletStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetWalletStatus failed unexpected error: %v", err)
+	}
+	if status.Difficulty != srv.Tip().Difficulty || status.Difficulty == 0 {
+		t.Errorf("GetWalletStatus difficulty = %v", status.Difficulty)
+	}
+}
+
+func TestWalletClient_Mock_CreateBatchAddress(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	ctx := context.Background()
+
+	//网络错误和服务端错误重试后创建成功
+	srv.FailHTTP("create_address", 502, 2)
+	addrs, err := wm.walletClient.CreateBatchAddress(ctx, 5, 2)
+	if err != nil {
+		t.Fatalf("CreateBatchAddress failed unexpected error: %v", err)
+	}
+	if len(addrs) != 5 {
+		t.Fatalf("CreateBatchAddress = %d addresses, want 5", len(addrs))
+	}
+	if n := srv.Calls("create_address"); n != 7 {
+		t.Errorf("create_address calls = %d, want 7", n)
+	}
+
+	//JSON-RPC错误对象不重试，返回已创建的地址和失败原因
+	srv.FailRPC("create_address", -32603, "Internal JSON-RPC error.", 2)
+	addrs, err = wm.walletClient.CreateBatchAddress(ctx, 5, 5)
+	batchErr, ok := err.(*BatchAddressError)
+	if !ok {
+		t.Fatalf("CreateBatchAddress error = %v, want *BatchAddressError", err)
+	}
+	if len(addrs) != 3 || len(batchErr.Result.Failed) != 2 || batchErr.Result.Count != 5 || batchErr.Result.Canceled {
+		t.Errorf("CreateBatchAddress = %v, result = %+v", addrs, batchErr.Result)
+	}
+	for _, f := range batchErr.Result.Failed {
+		if f.Success || f.Attempts != 1 || !IsRPCError(f.Err, ErrCodeInternalError) || !strings.Contains(f.Error, "Internal JSON-RPC error.") {
+			t.Errorf("failed result = %+v", f)
+		}
+	}
+	for _, a := range addrs {
+		if len(a) == 0 {
+			t.Errorf("CreateBatchAddress returned an empty address")
+		}
+	}
+
+	//超过最大数量
+	if _, err = wm.walletClient.CreateBatchAddress(ctx, wm.walletClient.MaxBatchAddressCount+1, 1); err == nil {
+		t.Errorf("CreateBatchAddress over the maximum count should fail")
+	}
+	if _, err = wm.walletClient.CreateBatchAddress(ctx, 0, 1); err == nil {
+		t.Errorf("CreateBatchAddress with zero count should fail")
+	}
+
+	//线程数为0时仍能完成
+	addrs, err = wm.walletClient.CreateBatchAddress(ctx, 2, 0)
+	if err != nil || len(addrs) != 2 {
+		t.Errorf("CreateBatchAddress with zero worker = %v, %v", addrs, err)
+	}
+}
+
+func TestWalletClient_createBatchAddress_Dedupe(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	//钱包返回重复地址和空地址时重新创建
+	var (
+		mu   sync.Mutex
+		seq  int
+		resp = []string{"a", "a", "", "b", "c"}
+	)
+	create := func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		addr := resp[seq]
+		seq++
+		return addr, nil
+	}
+
+	result, err := wm.walletClient.createBatchAddress(context.Background(), 3, 1, create)
+	if err != nil {
+		t.Fatalf("createBatchAddress failed unexpected error: %v", err)
+	}
+	if result.Err() != nil || strings.Join(result.Addresses, ",") != "a,b,c" {
+		t.Errorf("createBatchAddress = %+v", result)
+	}
+}
+
+func TestWalletClient_createBatchAddress_Cancel(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	create := func(ctx context.Context) (string, error) {
+		//第一个地址创建后取消
+		cancel()
+		return testReceiver, nil
+	}
+
+	result, err := wm.walletClient.createBatchAddress(ctx, 10, 1, create)
+	if err != nil {
+		t.Fatalf("createBatchAddress failed unexpected error: %v", err)
+	}
+	if !result.Canceled || len(result.Addresses) != 1 || len(result.Failed) != 9 {
+		t.Fatalf("createBatchAddress = %+v", result)
+	}
+	if result.Failed[0].Err != context.Canceled || result.Failed[0].Attempts != 0 {
+		t.Errorf("canceled result = %+v", result.Failed[0])
+	}
+	if err := result.Err(); err == nil || !strings.Contains(err.Error(), "created 1 of 10 addresses, 9 failed, canceled") {
+		t.Errorf("result error = %v", err)
+	}
+}
@@ -1,12 +1,16 @@
+//go:build integration
+// +build integration
+
 package beam
 
 import (
+	"context"
 	"github.com/blocktree/openwallet/log"
 	"testing"
 )
 
 func TestWalletClient_GetBlockchainInfo(t *testing.T) {
-	b, err := tw.walletClient.GetBlockchainInfo()
+	b, err := tw.walletClient.GetBlockchainInfo(context.Background())
 	if err != nil {
 		t.Errorf("GetBlockchainInfo failed unexpected error: %v\n", err)
 	} else {
@@ -15,7 +19,7 @@ func TestWalletClient_GetBlockchainInfo(t *testing.T) {
 }
 
 func TestWalletClient_CreateAddress(t *testing.T) {
-	addr, err := tw.walletClient.CreateAddress()
+	addr, err := tw.walletClient.CreateAddress(context.Background())
 	if err != nil {
 		t.Errorf("CreateAddress failed unexpected error: %v\n", err)
 	} else {
@@ -24,7 +28,7 @@ func TestWalletClient_CreateAddress(t *testing.T) {
 }
 
 func TestWalletClient_CreateBatchAddress(t *testing.T) {
-	addrs, err := tw.walletClient.CreateBatchAddress(2000, 20)
+	addrs, err := tw.walletClient.CreateBatchAddress(context.Background(), 2000, 20)
 	if err != nil {
 		t.Errorf("CreateBatchAddress failed unexpected error: %v\n", err)
 		return
@@ -37,7 +41,7 @@ func TestWalletClient_CreateBatchAddress(t *testing.T) {
 
 func TestWalletClient_GetBlockByHeight(t *testing.T) {
 
-	block, err := tw.walletClient.GetBlockByHeight(161025)
+	block, err := tw.walletClient.GetBlockByHeight(context.Background(), 161025)
 	if err != nil {
 		t.Errorf("GetBlockByHeight failed unexpected error: %v\n", err)
 	} else {
@@ -47,7 +51,7 @@ func TestWalletClient_GetBlockByHeight(t *testing.T) {
 
 func TestWalletClient_GetBlockByHash(t *testing.T) {
 
-	block, err := tw.walletClient.GetBlockByHash("c9b4584d7a8eda016c26b4c8cb6f55775c415eaf36c460b9180df00f0cd3bbf3")
+	block, err := tw.walletClient.GetBlockByHash(context.Background(), "c9b4584d7a8eda016c26b4c8cb6f55775c415eaf36c460b9180df00f0cd3bbf3")
 	if err != nil {
 		t.Errorf("GetBlockByHash failed unexpected error: %v\n", err)
 	} else {
@@ -57,7 +61,7 @@ func TestWalletClient_GetBlockByHash(t *testing.T) {
 
 func TestWalletClient_GetBlockByKernel(t *testing.T) {
 
-	block, err := tw.walletClient.GetBlockByKernel("22abe54b476951179f58ff8da9f06332fc138e9f33f35c3f04b7ea3c71d45fd6")
+	block, err := tw.walletClient.GetBlockByKernel(context.Background(), "22abe54b476951179f58ff8da9f06332fc138e9f33f35c3f04b7ea3c71d45fd6")
 	if err != nil {
 		t.Errorf("GetBlockByKernel failed unexpected error: %v\n", err)
 	} else {
@@ -68,7 +72,7 @@ func TestWalletClient_GetBlockByKernel(t *testing.T) {
 func TestWalletClient_GetTransaction(t *testing.T) {
 	//d2ebe998cdce4506a9901ea0e060f811
 	//c6248e52ab2a409887572d59b741d9a7
-	tx, err := tw.walletClient.GetTransaction("c6248e52ab2a409887572d59b741d9a7")
+	tx, err := tw.walletClient.GetTransaction(context.Background(), "c6248e52ab2a409887572d59b741d9a7")
 	if err != nil {
 		t.Errorf("GetTransaction failed unexpected error: %v\n", err)
 	} else {
@@ -77,7 +81,7 @@ func TestWalletClient_GetTransaction(t *testing.T) {
 }
 
 func TestWalletClient_GetTransactionsByHeight(t *testing.T) {
-	txs, err := tw.walletClient.GetTransactionsByHeight(741737)
+	txs, err := tw.walletClient.GetTransactionsByHeight(context.Background(), 741737)
 	if err != nil {
 		t.Errorf("GetTransactionsByHeight failed unexpected error: %v\n", err)
 		return
@@ -89,7 +93,7 @@ func TestWalletClient_GetTransactionsByHeight(t *testing.T) {
 }
 
 func TestWalletClient_GetAddressList(t *testing.T) {
-	addrs, err := tw.walletClient.GetAddressList()
+	addrs, err := tw.walletClient.GetAddressList(context.Background())
 	if err != nil {
 		t.Errorf("GetAddressList failed unexpected error: %v\n", err)
 		return
@@ -101,7 +105,7 @@ func TestWalletClient_GetAddressList(t *testing.T) {
 }
 
 func TestWalletClient_GetWalletStatus(t *testing.T) {
-	wallet, err := tw.walletClient.GetWalletStatus()
+	wallet, err := tw.walletClient.GetWalletStatus(context.Background())
 	if err != nil {
 		t.Errorf("GetWalletStatus failed unexpected error: %v\n", err)
 		return
@@ -115,7 +119,7 @@ func TestWalletClient_SendTransaction(t *testing.T) {
 	to := "19179fae58832b5a59129cd866905646d7547d1dddd1f97c3663affb924a01fa65c"
 	amount := uint64(45738)
 	fee := uint64(1)
-	txid, err := tw.walletClient.SendTransaction(from, to, amount, fee, "")
+	txid, err := tw.walletClient.SendTransaction(context.Background(), from, to, amount, fee, "")
 	if err != nil {
 		t.Errorf("GetWalletStatus failed unexpected error: %v\n", err)
 		return
@@ -125,7 +129,7 @@ func TestWalletClient_SendTransaction(t *testing.T) {
 }
 
 func TestWalletClient_GetTransactionsByStatus(t *testing.T) {
-	txs, err := tw.walletClient.GetTransactionsByStatus(TxStatusInProgress)
+	txs, err := tw.walletClient.GetTransactionsByStatus(context.Background(), TxStatusInProgress)
 	if err != nil {
 		t.Errorf("GetTransactionsByStatus failed unexpected error: %v\n", err)
 		return
@@ -138,7 +142,7 @@ func TestWalletClient_GetTransactionsByStatus(t *testing.T) {
 }
 
 func TestWalletClient_CancelTx(t *testing.T) {
-	flag, err := tw.walletClient.CancelTx("46bf4426eb8142f58898ba9ccf9b351b")
+	flag, err := tw.walletClient.CancelTx(context.Background(), "46bf4426eb8142f58898ba9ccf9b351b")
 	if err != nil {
 		t.Errorf("CancelTx failed unexpected error: %v\n", err)
 		return
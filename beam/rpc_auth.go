@@ -0,0 +1,108 @@
+package beam
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"github.com/imroc/req"
+	"io/ioutil"
+	"net/http"
+)
+
+//WalletAuth 钱包API认证信息，Token和用户名密码只能二选一
+type WalletAuth struct {
+	Username string //HTTP Basic认证用户名
+	Password string //HTTP Basic认证密码
+	Token    string //Bearer Token
+}
+
+//authorization Authorization请求头，没有配置返回空
+func (auth WalletAuth) authorization() string {
+	if len(auth.Token) > 0 {
+		return "Bearer " + auth.Token
+	}
+	if len(auth.Username) > 0 || len(auth.Password) > 0 {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Password))
+	}
+	return ""
+}
+
+//WalletTLSOptions 钱包API的TLS配置
+type WalletTLSOptions struct {
+	CAFile             string //自定义CA证书文件，PEM格式
+	CertFile           string //客户端证书文件，PEM格式
+	KeyFile            string //客户端证书私钥文件，PEM格式
+	InsecureSkipVerify bool   //不验证服务端证书，仅用于测试
+}
+
+//tlsConfig 生成tls.Config，没有任何配置返回nil
+func (opts WalletTLSOptions) tlsConfig() (*tls.Config, error) {
+
+	if len(opts.CAFile) == 0 && len(opts.CertFile) == 0 && len(opts.KeyFile) == 0 && !opts.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if len(opts.CAFile) > 0 {
+		data, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %s failed, unexpected error: %v", opts.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA file: %s has no valid certificate", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(opts.CertFile) > 0 || len(opts.KeyFile) > 0 {
+		if len(opts.CertFile) == 0 || len(opts.KeyFile) == 0 {
+			return nil, fmt.Errorf("client certificate and key file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed, unexpected error: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+//SetAuth 设置钱包API和浏览器API请求的认证信息
+func (c *WalletClient) SetAuth(auth WalletAuth) error {
+	if len(auth.Token) > 0 && (len(auth.Username) > 0 || len(auth.Password) > 0) {
+		return fmt.Errorf("wallet API token and basic auth can not be both set")
+	}
+	c.auth = auth
+	return nil
+}
+
+//SetTLS 设置钱包API和浏览器API请求的TLS配置
+func (c *WalletClient) SetTLS(opts WalletTLSOptions) error {
+
+	config, err := opts.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	trans, ok := c.client.Client().Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("wallet API client has no http transport")
+	}
+	trans.TLSClientConfig = config
+	return nil
+}
+
+//header 每个请求都带上的请求头
+func (c *WalletClient) header() req.Header {
+	header := req.Header{}
+	if authorization := c.auth.authorization(); len(authorization) > 0 {
+		header["Authorization"] = authorization
+	}
+	return header
+}
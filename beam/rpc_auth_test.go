@@ -0,0 +1,149 @@
+package beam
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/astaxie/beego/config"
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+)
+
+func TestWalletClient_Mock_Auth(t *testing.T) {
+	srv := beamtest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := NewWalletClient(srv.WalletAPI(), srv.ExplorerAPI(), false)
+	client.RetryBackoff = 0
+
+	srv.SetAuthorization("Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass")))
+	_, err := client.GetWalletStatus(ctx)
+	if e, ok := err.(*HTTPStatusError); !ok || e.StatusCode != 401 {
+		t.Errorf("GetWalletStatus without auth error = %v, want 401", err)
+	}
+	if isRetryableError(err) {
+		t.Errorf("unauthorized request should not be retried")
+	}
+
+	if err = client.SetAuth(WalletAuth{Username: "user", Password: "pass"}); err != nil {
+		t.Fatalf("SetAuth failed unexpected error: %v", err)
+	}
+	if _, err = client.GetWalletStatus(ctx); err != nil {
+		t.Errorf("GetWalletStatus with basic auth failed unexpected error: %v", err)
+	}
+	if _, err = client.GetBlockchainInfo(ctx); err != nil {
+		t.Errorf("GetBlockchainInfo with basic auth failed unexpected error: %v", err)
+	}
+
+	srv.SetAuthorization("Bearer secret")
+	if err = client.SetAuth(WalletAuth{Token: "secret"}); err != nil {
+		t.Fatalf("SetAuth failed unexpected error: %v", err)
+	}
+	if _, err = client.GetWalletStatus(ctx); err != nil {
+		t.Errorf("GetWalletStatus with token failed unexpected error: %v", err)
+	}
+	if _, err = client.GetBlockchainInfo(ctx); err != nil {
+		t.Errorf("GetBlockchainInfo with token failed unexpected error: %v", err)
+	}
+
+	if err = client.SetAuth(WalletAuth{Username: "user", Token: "secret"}); err == nil {
+		t.Errorf("SetAuth with both token and basic auth should fail")
+	}
+}
+
+func TestWalletClient_Mock_TLS(t *testing.T) {
+	srv := beamtest.NewTLSServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := NewWalletClient(srv.WalletAPI(), srv.ExplorerAPI(), false)
+	client.MaxRetries = 0
+
+	if _, err := client.GetWalletStatus(ctx); err == nil {
+		t.Errorf("GetWalletStatus should fail with unknown certificate authority")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, srv.CertificatePEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetTLS(WalletTLSOptions{CAFile: caFile}); err != nil {
+		t.Fatalf("SetTLS failed unexpected error: %v", err)
+	}
+	if _, err := client.GetWalletStatus(ctx); err != nil {
+		t.Errorf("GetWalletStatus with CA file failed unexpected error: %v", err)
+	}
+	if _, err := client.GetBlockchainInfo(ctx); err != nil {
+		t.Errorf("GetBlockchainInfo with CA file failed unexpected error: %v", err)
+	}
+
+	insecure := NewWalletClient(srv.WalletAPI(), srv.ExplorerAPI(), false)
+	if err := insecure.SetTLS(WalletTLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("SetTLS failed unexpected error: %v", err)
+	}
+	if _, err := insecure.GetWalletStatus(ctx); err != nil {
+		t.Errorf("GetWalletStatus with insecure skip verify failed unexpected error: %v", err)
+	}
+}
+
+func TestWalletClient_TLSOptionsError(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.pem")
+	ioutil.WriteFile(invalid, []byte("not a certificate"), 0600)
+
+	client := NewWalletClient("https://127.0.0.1", "https://127.0.0.1", false)
+	tests := []WalletTLSOptions{
+		{CAFile: filepath.Join(dir, "missing.pem")},
+		{CAFile: invalid},
+		{CertFile: invalid},
+		{CertFile: invalid, KeyFile: invalid},
+	}
+	for i, opts := range tests {
+		if err := client.SetTLS(opts); err == nil {
+			t.Errorf("case %d: SetTLS should fail", i)
+		}
+	}
+}
+
+func TestWalletManager_LoadAssetsConfig_WalletAPIAuth(t *testing.T) {
+	srv := beamtest.NewTLSServer()
+	defer srv.Close()
+	srv.SetAuthorization("Bearer secret")
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, srv.CertificatePEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ini := fmt.Sprintf(testMockConfig, srv.WalletAPI(), srv.ExplorerAPI(), "summary", dir, dir) +
+		fmt.Sprintf("rpctoken = \"secret\"\nrpccafile = \"%s\"\n", caFile)
+	c, err := config.NewConfigData("ini", []byte(ini))
+	if err != nil {
+		t.Fatalf("load config failed unexpected error: %v", err)
+	}
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	defer wm.CloseDB()
+	if err = wm.LoadAssetsConfig(c); err != nil {
+		t.Fatalf("LoadAssetsConfig failed unexpected error: %v", err)
+	}
+
+	if _, err = wm.GetLocalWalletBalance(); err != nil {
+		t.Errorf("GetLocalWalletBalance failed unexpected error: %v", err)
+	}
+	if _, err = wm.Blockscanner.GetBlockHeight(); err != nil {
+		t.Errorf("GetBlockHeight failed unexpected error: %v", err)
+	}
+
+	//同时配置token和用户名密码
+	c, _ = config.NewConfigData("ini", []byte(ini+"rpcuser = \"user\"\n"))
+	if err = NewWalletManager().LoadAssetsConfig(c); err == nil {
+		t.Errorf("LoadAssetsConfig with both token and basic auth should fail")
+	}
+}
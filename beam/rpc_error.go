@@ -0,0 +1,183 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"github.com/blocktree/openwallet/openwallet"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	//Beam钱包API的JSON-RPC错误码
+	ErrCodeInvalidJSONRPC          = -32600 //Invalid JSON-RPC.
+	ErrCodeMethodNotFound          = -32601 //Procedure not found.
+	ErrCodeInvalidParams           = -32602 //Invalid parameters.
+	ErrCodeInternalError           = -32603 //Internal JSON-RPC error.
+	ErrCodeInvalidTxStatus         = -32001 //Invalid TX status.
+	ErrCodeUnknownAPIKey           = -32002 //Unknown API key.
+	ErrCodeInvalidAddress          = -32003 //Invalid address.
+	ErrCodeInvalidTxID             = -32004 //Invalid transaction ID.
+	ErrCodeNotSupported            = -32005 //Feature is not supported.
+	ErrCodeInvalidPaymentProof     = -32006 //Invalid payment proof provided.
+	ErrCodePaymentProofExportError = -32007 //Cannot export payment proof.
+	ErrCodeDatabaseError           = -32012 //Database error.
+	ErrCodeDatabaseNotFound        = -32013 //Database not found.
+
+	//旧版本钱包查询不到交易时的错误码
+	ErrCodeNoTxInformation = -5 //No information available about transaction
+)
+
+//TransportError 请求没有得到HTTP响应，如连接失败、超时
+type TransportError struct {
+	URL string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("request %s failed: %v", e.URL, e.Err)
+}
+
+//Unwrap 原始错误
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+//Timeout 是否请求超时
+func (e *TransportError) Timeout() bool {
+	if e.Err == context.DeadlineExceeded {
+		return true
+	}
+	if netErr, ok := e.Err.(net.Error); ok {
+		return netErr.Timeout()
+	}
+	return false
+}
+
+//HTTPStatusError 服务返回非200的HTTP状态码
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("[%d]%s", e.StatusCode, e.Status)
+}
+
+//RPCError 钱包JSON-RPC接口返回的错误对象
+type RPCError struct {
+	Code    int64
+	Message string
+	Method  string //请求的方法
+	ID      uint64 //请求的id
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("[%d]%s", e.Code, e.Message)
+}
+
+//isRetryableError 网络错误和服务端5xx、429错误可以重试，JSON-RPC错误对象不重试
+func isRetryableError(err error) bool {
+	switch e := err.(type) {
+	case *TransportError:
+		return true
+	case *HTTPStatusError:
+		return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+	default:
+		return false
+	}
+}
+
+//rpcErrorCode 钱包JSON-RPC错误码，不是JSON-RPC错误对象返回false
+func rpcErrorCode(err error) (int64, bool) {
+	e, ok := err.(*RPCError)
+	if !ok {
+		return 0, false
+	}
+	return e.Code, true
+}
+
+//IsRPCError 是否钱包JSON-RPC接口返回的指定错误码
+func IsRPCError(err error, code int64) bool {
+	c, ok := rpcErrorCode(err)
+	return ok && c == code
+}
+
+//IsTxNotFound 钱包中查询不到交易
+func IsTxNotFound(err error) bool {
+	return IsRPCError(err, ErrCodeInvalidTxID) || IsRPCError(err, ErrCodeNoTxInformation)
+}
+
+//IsInvalidAddress 地址格式不正确
+func IsInvalidAddress(err error) bool {
+	return IsRPCError(err, ErrCodeInvalidAddress)
+}
+
+//IsInvalidTxStatus 交易当前状态不允许该操作，如取消已完成的交易
+func IsInvalidTxStatus(err error) bool {
+	return IsRPCError(err, ErrCodeInvalidTxStatus)
+}
+
+//IsInsufficientFunds 钱包余额不足，钱包以Internal JSON-RPC error返回
+func IsInsufficientFunds(err error) bool {
+	e, ok := err.(*RPCError)
+	return ok && e.Code == ErrCodeInternalError && strings.Contains(strings.ToLower(e.Message), "not enough")
+}
+
+//IsUnavailable 钱包API无法访问，包括网络错误和HTTP状态错误
+func IsUnavailable(err error) bool {
+	switch err.(type) {
+	case *TransportError, *HTTPStatusError:
+		return true
+	default:
+		return false
+	}
+}
+
+//OpenwalletError 把钱包API错误转换为openwallet错误码，无法识别的错误使用defaultCode
+func OpenwalletError(err error, defaultCode uint64) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if owErr, ok := err.(*openwallet.Error); ok {
+		return owErr
+	}
+
+	code := defaultCode
+	switch {
+	case IsUnavailable(err):
+		code = openwallet.ErrCallFullNodeAPIFailed
+	case IsInvalidAddress(err):
+		code = openwallet.ErrAdressDecodeFailed
+	case IsInsufficientFunds(err):
+		code = openwallet.ErrInsufficientBalanceOfAccount
+	}
+
+	return openwallet.NewError(code, err.Error())
+}
+
+//rpcErrorReasonPrefix 以JSON-RPC错误码记录的失败原因前缀，与RPCError.Error()一致
+func rpcErrorReasonPrefix(code int64) string {
+	return (&RPCError{Code: code}).Error()
+}
+
+//BatchAddressError 批量创建地址未全部成功，Result包含已创建的地址和各地址的失败原因
+type BatchAddressError struct {
+	Result *BatchAddressResult
+}
+
+func (e *BatchAddressError) Error() string {
+	r := e.Result
+	msg := fmt.Sprintf("created %d of %d addresses, %d failed", len(r.Addresses), r.Count, len(r.Failed))
+	if r.Canceled {
+		msg += ", canceled"
+	}
+	if len(r.Failed) > 0 {
+		msg += ": " + r.Failed[0].Error
+	}
+	return msg
+}
@@ -0,0 +1,97 @@
+package beam
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	//区块扫描状态存储方式
+	ScannerStorageStorm  = "storm"  //storm/bolt文件，默认
+	ScannerStorageMemory = "memory" //内存，重启后丢失，用于测试
+	ScannerStorageSQLite = "sqlite" //SQLite文件，方便运维直接查询
+)
+
+var (
+	//ErrScannerStorageNotFound 存储中没有找到记录
+	ErrScannerStorageNotFound = fmt.Errorf("not found")
+)
+
+//ScannerStorage 区块扫描状态存储，保存扫描进度、本地区块、未扫记录和已通知的提取结果
+type ScannerStorage interface {
+
+	//GetLocalNewBlock 获取本地记录的区块高度和hash，没有记录返回0
+	GetLocalNewBlock() (uint64, string, error)
+
+	//SaveLocalNewBlock 记录区块高度和hash
+	SaveLocalNewBlock(blockHeight uint64, blockHash string) error
+
+	//SaveLocalBlock 记录本地区块
+	SaveLocalBlock(block *Block) error
+
+	//SaveScannedBlock 在同一事务中记录本地区块并推进本地区块高度
+	SaveScannedBlock(block *Block) error
+
+	//GetLocalBlock 获取本地区块
+	GetLocalBlock(height uint64) (*Block, error)
+
+	//SaveUnscanRecord 记录未扫记录
+	SaveUnscanRecord(record *UnscanRecord) error
+
+	//GetUnscanRecords 获取全部未扫记录，按高度排序
+	GetUnscanRecords() ([]*UnscanRecord, error)
+
+	//DeleteUnscanRecord 删除指定高度的未扫记录
+	DeleteUnscanRecord(height uint64) error
+
+	//DeleteUnscanRecordsByReason 删除原因以reason开头的未扫记录
+	DeleteUnscanRecordsByReason(reason string) error
+
+	//SaveBlockExtractDataRecords 记录已通知的提取结果
+	SaveBlockExtractDataRecords(records []*BlockExtractDataRecord) error
+
+	//GetBlockExtractDataRecords 获取大于等于指定高度的已通知提取结果，按高度排序
+	GetBlockExtractDataRecords(fromHeight uint64) ([]*BlockExtractDataRecord, error)
+
+	//MarkBlockExtractDataRetracting 把大于等于指定高度的已通知提取结果标记为等待撤回
+	MarkBlockExtractDataRetracting(fromHeight uint64) error
+
+	//GetRetractingBlockExtractDataRecords 获取等待撤回的提取结果，按高度排序
+	GetRetractingBlockExtractDataRecords() ([]*BlockExtractDataRecord, error)
+
+	//GetPendingBlockExtractDataRecords 获取小于等于指定高度的待确认提取结果，按高度排序
+	GetPendingBlockExtractDataRecords(maxHeight uint64) ([]*BlockExtractDataRecord, error)
+
+	//DeleteBlockExtractDataRecord 删除已通知的提取结果
+	DeleteBlockExtractDataRecord(record *BlockExtractDataRecord) error
+
+	//DeleteLocalBlockDataBelow 删除低于指定高度的本地区块和已确认的提取结果
+	DeleteLocalBlockDataBelow(height uint64) error
+
+	//Close 关闭存储
+	Close() error
+}
+
+//newScannerStorage 按配置创建区块扫描状态存储
+func (wm *WalletManager) newScannerStorage() (ScannerStorage, error) {
+	switch wm.Config.scannerstorage {
+	case "", ScannerStorageStorm:
+		return newStormScannerStorage(wm.storage, filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile)), nil
+	case ScannerStorageMemory:
+		return NewMemoryScannerStorage(), nil
+	case ScannerStorageSQLite:
+		return NewSQLiteScannerStorage(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainSQLiteFile))
+	default:
+		return nil, fmt.Errorf("unknown scanner storage: %s", wm.Config.scannerstorage)
+	}
+}
+
+//ScannerStorage 区块扫描状态存储，首次使用时按配置创建
+func (wm *WalletManager) ScannerStorage() (ScannerStorage, error) {
+	return wm.storage.scannerStorage(wm.newScannerStorage)
+}
+
+//SetScannerStorage 设置自定义的区块扫描状态存储
+func (wm *WalletManager) SetScannerStorage(storage ScannerStorage) {
+	wm.storage.setScannerStorage(storage)
+}
@@ -0,0 +1,241 @@
+package beam
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//MemoryScannerStorage 内存存储的区块扫描状态，重启后丢失，用于测试
+type MemoryScannerStorage struct {
+	mu            sync.RWMutex
+	blockHeight   uint64
+	blockHash     string
+	blocks        map[uint64]*Block
+	unscanRecords map[string]*UnscanRecord
+	extractData   map[string]*BlockExtractDataRecord
+}
+
+//NewMemoryScannerStorage 创建内存存储
+func NewMemoryScannerStorage() *MemoryScannerStorage {
+	return &MemoryScannerStorage{
+		blocks:        make(map[uint64]*Block),
+		unscanRecords: make(map[string]*UnscanRecord),
+		extractData:   make(map[string]*BlockExtractDataRecord),
+	}
+}
+
+//GetLocalNewBlock 获取本地记录的区块高度和hash
+func (s *MemoryScannerStorage) GetLocalNewBlock() (uint64, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blockHeight, s.blockHash, nil
+}
+
+//SaveLocalNewBlock 记录区块高度和hash
+func (s *MemoryScannerStorage) SaveLocalNewBlock(blockHeight uint64, blockHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blockHeight = blockHeight
+	s.blockHash = blockHash
+	return nil
+}
+
+//SaveLocalBlock 记录本地区块
+func (s *MemoryScannerStorage) SaveLocalBlock(block *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := *block
+	s.blocks[block.Height] = &b
+	return nil
+}
+
+//SaveScannedBlock 记录本地区块并推进本地区块高度
+func (s *MemoryScannerStorage) SaveScannedBlock(block *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := *block
+	s.blocks[block.Height] = &b
+	s.blockHeight = block.Height
+	s.blockHash = block.Hash
+	return nil
+}
+
+//GetLocalBlock 获取本地区块
+func (s *MemoryScannerStorage) GetLocalBlock(height uint64) (*Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	block, exist := s.blocks[height]
+	if !exist {
+		return nil, ErrScannerStorageNotFound
+	}
+	b := *block
+	return &b, nil
+}
+
+//SaveUnscanRecord 记录未扫记录
+func (s *MemoryScannerStorage) SaveUnscanRecord(record *UnscanRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := *record
+	s.unscanRecords[record.ID] = &r
+	return nil
+}
+
+//GetUnscanRecords 获取全部未扫记录
+func (s *MemoryScannerStorage) GetUnscanRecords() ([]*UnscanRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*UnscanRecord, 0, len(s.unscanRecords))
+	for _, record := range s.unscanRecords {
+		r := *record
+		list = append(list, &r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].BlockHeight < list[j].BlockHeight
+	})
+	return list, nil
+}
+
+//DeleteUnscanRecord 删除指定高度的未扫记录
+func (s *MemoryScannerStorage) DeleteUnscanRecord(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, r := range s.unscanRecords {
+		if r.BlockHeight == height {
+			delete(s.unscanRecords, id)
+		}
+	}
+	return nil
+}
+
+//DeleteUnscanRecordsByReason 删除原因以reason开头的未扫记录
+func (s *MemoryScannerStorage) DeleteUnscanRecordsByReason(reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, r := range s.unscanRecords {
+		if strings.HasPrefix(r.Reason, reason) {
+			delete(s.unscanRecords, id)
+		}
+	}
+	return nil
+}
+
+//SaveBlockExtractDataRecords 记录已通知的提取结果
+func (s *MemoryScannerStorage) SaveBlockExtractDataRecords(records []*BlockExtractDataRecord) error {
+	copies := make([]*BlockExtractDataRecord, 0, len(records))
+	for _, r := range records {
+		c, err := copyBlockExtractDataRecord(r)
+		if err != nil {
+			return err
+		}
+		copies = append(copies, c)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range copies {
+		s.extractData[c.ID] = c
+	}
+	return nil
+}
+
+//GetBlockExtractDataRecords 获取大于等于指定高度的已通知提取结果
+func (s *MemoryScannerStorage) GetBlockExtractDataRecords(fromHeight uint64) ([]*BlockExtractDataRecord, error) {
+	return s.findBlockExtractDataRecords(func(r *BlockExtractDataRecord) bool {
+		return r.BlockHeight >= fromHeight
+	})
+}
+
+//MarkBlockExtractDataRetracting 把大于等于指定高度的已通知提取结果标记为等待撤回
+func (s *MemoryScannerStorage) MarkBlockExtractDataRetracting(fromHeight uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.extractData {
+		if r.BlockHeight >= fromHeight {
+			r.Retracting = true
+		}
+	}
+	return nil
+}
+
+//GetRetractingBlockExtractDataRecords 获取等待撤回的提取结果
+func (s *MemoryScannerStorage) GetRetractingBlockExtractDataRecords() ([]*BlockExtractDataRecord, error) {
+	return s.findBlockExtractDataRecords(func(r *BlockExtractDataRecord) bool {
+		return r.Retracting
+	})
+}
+
+//GetPendingBlockExtractDataRecords 获取小于等于指定高度的待确认提取结果
+func (s *MemoryScannerStorage) GetPendingBlockExtractDataRecords(maxHeight uint64) ([]*BlockExtractDataRecord, error) {
+	return s.findBlockExtractDataRecords(func(r *BlockExtractDataRecord) bool {
+		return r.BlockHeight <= maxHeight && !r.Confirmed && !r.Retracting
+	})
+}
+
+//DeleteBlockExtractDataRecord 删除已通知的提取结果
+func (s *MemoryScannerStorage) DeleteBlockExtractDataRecord(record *BlockExtractDataRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.extractData, record.ID)
+	return nil
+}
+
+//DeleteLocalBlockDataBelow 删除低于指定高度的本地区块和已确认的提取结果
+func (s *MemoryScannerStorage) DeleteLocalBlockDataBelow(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h := range s.blocks {
+		if h < height {
+			delete(s.blocks, h)
+		}
+	}
+	for id, r := range s.extractData {
+		if r.BlockHeight < height && r.Confirmed && !r.Retracting {
+			delete(s.extractData, id)
+		}
+	}
+	return nil
+}
+
+//Close 内存存储无需关闭
+func (s *MemoryScannerStorage) Close() error {
+	return nil
+}
+
+//findBlockExtractDataRecords 查找满足条件的提取结果，按高度排序
+func (s *MemoryScannerStorage) findBlockExtractDataRecords(match func(r *BlockExtractDataRecord) bool) ([]*BlockExtractDataRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*BlockExtractDataRecord, 0)
+	for _, r := range s.extractData {
+		if !match(r) {
+			continue
+		}
+		c, err := copyBlockExtractDataRecord(r)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].BlockHeight < list[j].BlockHeight
+	})
+	return list, nil
+}
+
+//copyBlockExtractDataRecord 深拷贝提取结果，避免调用方修改存储中的数据
+func copyBlockExtractDataRecord(record *BlockExtractDataRecord) (*BlockExtractDataRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var c BlockExtractDataRecord
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,320 @@
+package beam
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//sqliteScannerSchema 区块扫描状态表结构
+var sqliteScannerSchema = []string{
+	`CREATE TABLE IF NOT EXISTS scanner_state (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS blocks (
+		height          INTEGER PRIMARY KEY,
+		hash            TEXT NOT NULL,
+		prev_block_hash TEXT NOT NULL,
+		chainwork       TEXT NOT NULL,
+		found           INTEGER NOT NULL,
+		time            INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS unscan_records (
+		id           TEXT PRIMARY KEY,
+		block_height INTEGER NOT NULL,
+		tx_id        TEXT NOT NULL,
+		reason       TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS unscan_records_block_height ON unscan_records (block_height)`,
+	`CREATE TABLE IF NOT EXISTS extract_data_records (
+		id           TEXT PRIMARY KEY,
+		block_height INTEGER NOT NULL,
+		block_hash   TEXT NOT NULL,
+		source_key   TEXT NOT NULL,
+		tx_id        TEXT NOT NULL,
+		data         TEXT NOT NULL,
+		retracting   INTEGER NOT NULL,
+		confirmed    INTEGER NOT NULL,
+		notify_at    INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS extract_data_records_block_height ON extract_data_records (block_height)`,
+}
+
+const sqliteExtractDataColumns = "id, block_height, block_hash, source_key, tx_id, data, retracting, confirmed, notify_at"
+
+//SQLiteScannerStorage SQLite文件存储的区块扫描状态，运维可以直接用SQL查询
+type SQLiteScannerStorage struct {
+	db *sql.DB
+}
+
+//NewSQLiteScannerStorage 打开SQLite文件，不存在则创建表
+func NewSQLiteScannerStorage(path string) (*SQLiteScannerStorage, error) {
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	//SQLite同一时间只允许一个写连接
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range sqliteScannerSchema {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &SQLiteScannerStorage{db: db}, nil
+}
+
+//GetLocalNewBlock 获取本地记录的区块高度和hash
+func (s *SQLiteScannerStorage) GetLocalNewBlock() (uint64, string, error) {
+
+	var (
+		blockHeight uint64 = 0
+		blockHash   string = ""
+	)
+
+	rows, err := s.db.Query("SELECT key, value FROM scanner_state WHERE key IN ('blockHeight', 'blockHash')")
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return 0, "", err
+		}
+		if key == "blockHash" {
+			blockHash = value
+		} else {
+			err = json.Unmarshal([]byte(value), &blockHeight)
+			if err != nil {
+				return 0, "", err
+			}
+		}
+	}
+
+	return blockHeight, blockHash, rows.Err()
+}
+
+//SaveLocalNewBlock 记录区块高度和hash
+func (s *SQLiteScannerStorage) SaveLocalNewBlock(blockHeight uint64, blockHash string) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		return sqliteSaveLocalNewBlock(tx, blockHeight, blockHash)
+	})
+}
+
+//SaveLocalBlock 记录本地区块
+func (s *SQLiteScannerStorage) SaveLocalBlock(block *Block) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		return sqliteSaveBlock(tx, block)
+	})
+}
+
+//SaveScannedBlock 在同一事务中记录本地区块并推进本地区块高度
+func (s *SQLiteScannerStorage) SaveScannedBlock(block *Block) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		err := sqliteSaveBlock(tx, block)
+		if err != nil {
+			return err
+		}
+		return sqliteSaveLocalNewBlock(tx, block.Height, block.Hash)
+	})
+}
+
+//GetLocalBlock 获取本地区块
+func (s *SQLiteScannerStorage) GetLocalBlock(height uint64) (*Block, error) {
+
+	var (
+		block Block
+		found int
+	)
+
+	row := s.db.QueryRow("SELECT height, hash, prev_block_hash, chainwork, found, time FROM blocks WHERE height = ?", height)
+	err := row.Scan(&block.Height, &block.Hash, &block.PrevBlockHash, &block.Chainwork, &found, &block.Time)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrScannerStorageNotFound
+		}
+		return nil, err
+	}
+	block.Found = found != 0
+
+	return &block, nil
+}
+
+//SaveUnscanRecord 记录未扫记录
+func (s *SQLiteScannerStorage) SaveUnscanRecord(record *UnscanRecord) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO unscan_records (id, block_height, tx_id, reason) VALUES (?, ?, ?, ?)",
+		record.ID, record.BlockHeight, record.TxID, record.Reason)
+	return err
+}
+
+//GetUnscanRecords 获取全部未扫记录
+func (s *SQLiteScannerStorage) GetUnscanRecords() ([]*UnscanRecord, error) {
+
+	rows, err := s.db.Query("SELECT id, block_height, tx_id, reason FROM unscan_records ORDER BY block_height")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*UnscanRecord, 0)
+	for rows.Next() {
+		var r UnscanRecord
+		err = rows.Scan(&r.ID, &r.BlockHeight, &r.TxID, &r.Reason)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &r)
+	}
+
+	return list, rows.Err()
+}
+
+//DeleteUnscanRecord 删除指定高度的未扫记录
+func (s *SQLiteScannerStorage) DeleteUnscanRecord(height uint64) error {
+	_, err := s.db.Exec("DELETE FROM unscan_records WHERE block_height = ?", height)
+	return err
+}
+
+//DeleteUnscanRecordsByReason 删除原因以reason开头的未扫记录
+func (s *SQLiteScannerStorage) DeleteUnscanRecordsByReason(reason string) error {
+	_, err := s.db.Exec("DELETE FROM unscan_records WHERE substr(reason, 1, ?) = ?", len(reason), reason)
+	return err
+}
+
+//SaveBlockExtractDataRecords 记录已通知的提取结果
+func (s *SQLiteScannerStorage) SaveBlockExtractDataRecords(records []*BlockExtractDataRecord) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		for _, r := range records {
+			data, err := json.Marshal(r.Data)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT OR REPLACE INTO extract_data_records ("+sqliteExtractDataColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				r.ID, r.BlockHeight, r.BlockHash, r.SourceKey, r.TxID, string(data), r.Retracting, r.Confirmed, r.NotifyAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//GetBlockExtractDataRecords 获取大于等于指定高度的已通知提取结果
+func (s *SQLiteScannerStorage) GetBlockExtractDataRecords(fromHeight uint64) ([]*BlockExtractDataRecord, error) {
+	return s.findBlockExtractDataRecords("block_height >= ?", fromHeight)
+}
+
+//MarkBlockExtractDataRetracting 把大于等于指定高度的已通知提取结果标记为等待撤回
+func (s *SQLiteScannerStorage) MarkBlockExtractDataRetracting(fromHeight uint64) error {
+	_, err := s.db.Exec("UPDATE extract_data_records SET retracting = 1 WHERE block_height >= ?", fromHeight)
+	return err
+}
+
+//GetRetractingBlockExtractDataRecords 获取等待撤回的提取结果
+func (s *SQLiteScannerStorage) GetRetractingBlockExtractDataRecords() ([]*BlockExtractDataRecord, error) {
+	return s.findBlockExtractDataRecords("retracting = 1")
+}
+
+//GetPendingBlockExtractDataRecords 获取小于等于指定高度的待确认提取结果
+func (s *SQLiteScannerStorage) GetPendingBlockExtractDataRecords(maxHeight uint64) ([]*BlockExtractDataRecord, error) {
+	return s.findBlockExtractDataRecords("block_height <= ? AND confirmed = 0 AND retracting = 0", maxHeight)
+}
+
+//DeleteBlockExtractDataRecord 删除已通知的提取结果
+func (s *SQLiteScannerStorage) DeleteBlockExtractDataRecord(record *BlockExtractDataRecord) error {
+	_, err := s.db.Exec("DELETE FROM extract_data_records WHERE id = ?", record.ID)
+	return err
+}
+
+//DeleteLocalBlockDataBelow 删除低于指定高度的本地区块和已确认的提取结果
+func (s *SQLiteScannerStorage) DeleteLocalBlockDataBelow(height uint64) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM blocks WHERE height < ?", height)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM extract_data_records WHERE block_height < ? AND confirmed = 1 AND retracting = 0", height)
+		return err
+	})
+}
+
+//Close 关闭数据库连接
+func (s *SQLiteScannerStorage) Close() error {
+	return s.db.Close()
+}
+
+//transaction 在事务中执行，出错回滚
+func (s *SQLiteScannerStorage) transaction(f func(tx *sql.Tx) error) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//findBlockExtractDataRecords 按条件查询提取结果，按高度排序
+func (s *SQLiteScannerStorage) findBlockExtractDataRecords(where string, args ...interface{}) ([]*BlockExtractDataRecord, error) {
+
+	rows, err := s.db.Query("SELECT "+sqliteExtractDataColumns+" FROM extract_data_records WHERE "+where+" ORDER BY block_height", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*BlockExtractDataRecord, 0)
+	for rows.Next() {
+		var (
+			r    BlockExtractDataRecord
+			data string
+		)
+		err = rows.Scan(&r.ID, &r.BlockHeight, &r.BlockHash, &r.SourceKey, &r.TxID, &data, &r.Retracting, &r.Confirmed, &r.NotifyAt)
+		if err != nil {
+			return nil, err
+		}
+		err = json.NewDecoder(strings.NewReader(data)).Decode(&r.Data)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &r)
+	}
+
+	return list, rows.Err()
+}
+
+//sqliteSaveLocalNewBlock 在事务中记录区块高度和hash
+func sqliteSaveLocalNewBlock(tx *sql.Tx, blockHeight uint64, blockHash string) error {
+
+	height, err := json.Marshal(blockHeight)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO scanner_state (key, value) VALUES ('blockHeight', ?), ('blockHash', ?)", string(height), blockHash)
+	return err
+}
+
+//sqliteSaveBlock 在事务中记录区块
+func sqliteSaveBlock(tx *sql.Tx, block *Block) error {
+	_, err := tx.Exec("INSERT OR REPLACE INTO blocks (height, hash, prev_block_hash, chainwork, found, time) VALUES (?, ?, ?, ?, ?, ?)",
+		block.Height, block.Hash, block.PrevBlockHash, block.Chainwork, block.Found, block.Time)
+	return err
+}
@@ -0,0 +1,366 @@
+package beam
+
+import (
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"strings"
+)
+
+//stormScannerStorage storm/bolt文件存储的区块扫描状态
+type stormScannerStorage struct {
+	storage *walletStorage
+	path    string
+}
+
+func newStormScannerStorage(storage *walletStorage, path string) *stormScannerStorage {
+	return &stormScannerStorage{
+		storage: storage,
+		path:    path,
+	}
+}
+
+//db 共享的数据库连接
+func (s *stormScannerStorage) db() (*storm.DB, error) {
+	return s.storage.open(s.path)
+}
+
+//Close 关闭数据库文件
+func (s *stormScannerStorage) Close() error {
+	return s.storage.closeFile(s.path)
+}
+
+//GetLocalNewBlock 获取本地记录的区块高度和hash
+func (s *stormScannerStorage) GetLocalNewBlock() (uint64, string, error) {
+
+	var (
+		blockHeight uint64 = 0
+		blockHash   string = ""
+	)
+
+	db, err := s.db()
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = db.Get(blockchainBucket, "blockHeight", &blockHeight)
+	if err != nil && err != storm.ErrNotFound {
+		return 0, "", err
+	}
+	err = db.Get(blockchainBucket, "blockHash", &blockHash)
+	if err != nil && err != storm.ErrNotFound {
+		return 0, "", err
+	}
+
+	return blockHeight, blockHash, nil
+}
+
+//SaveLocalNewBlock 记录区块高度和hash到本地
+func (s *stormScannerStorage) SaveLocalNewBlock(blockHeight uint64, blockHash string) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = saveLocalNewBlock(tx, blockHeight, blockHash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//SaveLocalBlock 记录本地新区块
+func (s *stormScannerStorage) SaveLocalBlock(block *Block) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	return db.Save(block)
+}
+
+//SaveScannedBlock 在同一事务中记录本地新区块并推进本地区块高度
+func (s *stormScannerStorage) SaveScannedBlock(block *Block) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.Save(block)
+	if err != nil {
+		return err
+	}
+
+	err = saveLocalNewBlock(tx, block.Height, block.Hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//saveLocalNewBlock 在事务中记录区块高度和hash
+func saveLocalNewBlock(tx storm.Node, blockHeight uint64, blockHash string) error {
+
+	err := tx.Set(blockchainBucket, "blockHeight", &blockHeight)
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(blockchainBucket, "blockHash", &blockHash)
+}
+
+//GetLocalBlock 获取本地区块数据
+func (s *stormScannerStorage) GetLocalBlock(height uint64) (*Block, error) {
+
+	var (
+		block Block
+	)
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.One("Height", height, &block)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return nil, ErrScannerStorageNotFound
+		}
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+//DeleteUnscanRecord 删除指定高度的未扫记录
+func (s *stormScannerStorage) DeleteUnscanRecord(height uint64) error {
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	var list []*UnscanRecord
+	err = db.Find("BlockHeight", height, &list)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	for _, r := range list {
+		db.DeleteStruct(r)
+	}
+
+	return nil
+}
+
+//SaveUnscanRecord 记录未扫记录
+func (s *stormScannerStorage) SaveUnscanRecord(record *UnscanRecord) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	return db.Save(record)
+}
+
+//GetUnscanRecords 获取全部未扫记录
+func (s *stormScannerStorage) GetUnscanRecords() ([]*UnscanRecord, error) {
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*UnscanRecord
+	err = db.Select().OrderBy("BlockHeight").Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+//DeleteUnscanRecordsByReason 删除原因以reason开头的未扫记录
+func (s *stormScannerStorage) DeleteUnscanRecordsByReason(reason string) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	var list []*UnscanRecord
+	err = db.All(&list)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range list {
+		if strings.HasPrefix(r.Reason, reason) {
+			tx.DeleteStruct(r)
+		}
+	}
+	return tx.Commit()
+}
+
+//SaveBlockExtractDataRecords 记录已通知的区块提取结果
+func (s *stormScannerStorage) SaveBlockExtractDataRecords(records []*BlockExtractDataRecord) error {
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range records {
+		err = tx.Save(r)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//GetBlockExtractDataRecords 获取大于等于指定高度的已通知提取结果
+func (s *stormScannerStorage) GetBlockExtractDataRecords(fromHeight uint64) ([]*BlockExtractDataRecord, error) {
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*BlockExtractDataRecord
+	err = db.Select(q.Gte("BlockHeight", fromHeight)).OrderBy("BlockHeight").Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+//MarkBlockExtractDataRetracting 把大于等于指定高度的已通知提取结果标记为等待撤回
+func (s *stormScannerStorage) MarkBlockExtractDataRetracting(fromHeight uint64) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	var list []*BlockExtractDataRecord
+	err = db.Select(q.Gte("BlockHeight", fromHeight), q.Eq("Retracting", false)).Find(&list)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range list {
+		r.Retracting = true
+		err = tx.Save(r)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//GetRetractingBlockExtractDataRecords 获取等待撤回的提取结果
+func (s *stormScannerStorage) GetRetractingBlockExtractDataRecords() ([]*BlockExtractDataRecord, error) {
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*BlockExtractDataRecord
+	err = db.Select(q.Eq("Retracting", true)).OrderBy("BlockHeight").Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+//GetPendingBlockExtractDataRecords 获取小于等于指定高度的待确认提取结果
+func (s *stormScannerStorage) GetPendingBlockExtractDataRecords(maxHeight uint64) ([]*BlockExtractDataRecord, error) {
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*BlockExtractDataRecord
+	err = db.Select(q.Lte("BlockHeight", maxHeight), q.Eq("Confirmed", false), q.Eq("Retracting", false)).OrderBy("BlockHeight").Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+//DeleteBlockExtractDataRecord 删除已通知的提取结果
+func (s *stormScannerStorage) DeleteBlockExtractDataRecord(record *BlockExtractDataRecord) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	return db.DeleteStruct(record)
+}
+
+//DeleteLocalBlockDataBelow 删除低于指定高度的本地区块和已通知的提取结果，待确认和等待撤回的记录保留
+func (s *stormScannerStorage) DeleteLocalBlockDataBelow(height uint64) error {
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	err = db.Select(q.Lt("Height", height)).Delete(&Block{})
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	err = db.Select(q.Lt("BlockHeight", height), q.Eq("Confirmed", true), q.Eq("Retracting", false)).Delete(&BlockExtractDataRecord{})
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	return nil
+}
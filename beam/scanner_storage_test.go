@@ -0,0 +1,217 @@
+package beam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//testScannerStorages 各种存储实现，同一套用例验证行为一致
+func testScannerStorages(t *testing.T) map[string]ScannerStorage {
+	dir := t.TempDir()
+
+	sqlite, err := NewSQLiteScannerStorage(filepath.Join(dir, "blockchain.sqlite"))
+	if err != nil {
+		t.Fatalf("NewSQLiteScannerStorage failed unexpected error: %v", err)
+	}
+
+	storages := map[string]ScannerStorage{
+		ScannerStorageStorm:  newStormScannerStorage(newWalletStorage(), filepath.Join(dir, "blockchain.db")),
+		ScannerStorageMemory: NewMemoryScannerStorage(),
+		ScannerStorageSQLite: sqlite,
+	}
+	t.Cleanup(func() {
+		for name, s := range storages {
+			if err := s.Close(); err != nil {
+				t.Errorf("%s: Close failed unexpected error: %v", name, err)
+			}
+		}
+	})
+	return storages
+}
+
+func testExtractDataRecord(height uint64, txid string) *BlockExtractDataRecord {
+	data := &openwallet.TxExtractData{
+		Transaction: &openwallet.Transaction{TxID: txid, BlockHeight: height},
+	}
+	return NewBlockExtractDataRecord(height, "source", data)
+}
+
+func TestScannerStorage_Blocks(t *testing.T) {
+	for name, s := range testScannerStorages(t) {
+		height, hash, err := s.GetLocalNewBlock()
+		if err != nil || height != 0 || hash != "" {
+			t.Errorf("%s: empty local new block = %d:%s, %v", name, height, hash, err)
+		}
+
+		if _, err = s.GetLocalBlock(1); err == nil {
+			t.Errorf("%s: GetLocalBlock should return not found", name)
+		}
+
+		for i := uint64(1); i <= 5; i++ {
+			block := &Block{Height: i, Hash: "hash", PrevBlockHash: "prev", Chainwork: "work", Time: int64(100 + i)}
+			if err = s.SaveScannedBlock(block); err != nil {
+				t.Fatalf("%s: SaveScannedBlock failed unexpected error: %v", name, err)
+			}
+		}
+
+		height, hash, err = s.GetLocalNewBlock()
+		if err != nil || height != 5 || hash != "hash" {
+			t.Errorf("%s: local new block = %d:%s, %v", name, height, hash, err)
+		}
+
+		block, err := s.GetLocalBlock(3)
+		if err != nil || block.Height != 3 || block.PrevBlockHash != "prev" || block.Chainwork != "work" || block.Time != 103 {
+			t.Errorf("%s: local block = %+v, %v", name, block, err)
+		}
+
+		//回退扫描高度不删除已记录区块
+		if err = s.SaveLocalNewBlock(2, "hash-2"); err != nil {
+			t.Fatalf("%s: SaveLocalNewBlock failed unexpected error: %v", name, err)
+		}
+		height, hash, _ = s.GetLocalNewBlock()
+		if height != 2 || hash != "hash-2" {
+			t.Errorf("%s: local new block = %d:%s", name, height, hash)
+		}
+	}
+}
+
+func TestScannerStorage_UnscanRecords(t *testing.T) {
+	for name, s := range testScannerStorages(t) {
+		records := []*UnscanRecord{
+			NewUnscanRecord(3, "tx3", "[-5]No information available about transaction"),
+			NewUnscanRecord(1, "tx1", "timeout"),
+			NewUnscanRecord(2, "tx2", "timeout"),
+		}
+		for _, r := range records {
+			if err := s.SaveUnscanRecord(r); err != nil {
+				t.Fatalf("%s: SaveUnscanRecord failed unexpected error: %v", name, err)
+			}
+		}
+
+		list, err := s.GetUnscanRecords()
+		if err != nil || len(list) != 3 || list[0].BlockHeight != 1 || list[2].TxID != "tx3" {
+			t.Fatalf("%s: unscan records = %+v, %v", name, list, err)
+		}
+
+		if err = s.DeleteUnscanRecord(2); err != nil {
+			t.Errorf("%s: DeleteUnscanRecord failed unexpected error: %v", name, err)
+		}
+		if err = s.DeleteUnscanRecord(9); err != nil {
+			t.Errorf("%s: DeleteUnscanRecord missing height failed unexpected error: %v", name, err)
+		}
+		if err = s.DeleteUnscanRecordsByReason("[-5]"); err != nil {
+			t.Errorf("%s: DeleteUnscanRecordsByReason failed unexpected error: %v", name, err)
+		}
+
+		list, err = s.GetUnscanRecords()
+		if err != nil || len(list) != 1 || list[0].TxID != "tx1" {
+			t.Errorf("%s: unscan records = %+v, %v", name, list, err)
+		}
+	}
+}
+
+func TestScannerStorage_ExtractDataRecords(t *testing.T) {
+	for name, s := range testScannerStorages(t) {
+		records := []*BlockExtractDataRecord{
+			testExtractDataRecord(3, "tx3"),
+			testExtractDataRecord(1, "tx1"),
+			testExtractDataRecord(2, "tx2"),
+			testExtractDataRecord(4, "tx4"),
+		}
+		records[1].Confirmed = true
+		if err := s.SaveBlockExtractDataRecords(records); err != nil {
+			t.Fatalf("%s: SaveBlockExtractDataRecords failed unexpected error: %v", name, err)
+		}
+
+		list, err := s.GetBlockExtractDataRecords(2)
+		if err != nil || len(list) != 3 || list[0].TxID != "tx2" || list[2].TxID != "tx4" {
+			t.Fatalf("%s: records from 2 = %d, %v", name, len(list), err)
+		}
+		if list[0].Data == nil || list[0].Data.Transaction.TxID != "tx2" || list[0].SourceKey != "source" {
+			t.Errorf("%s: record data = %+v", name, list[0].Data)
+		}
+
+		pending, err := s.GetPendingBlockExtractDataRecords(3)
+		if err != nil || len(pending) != 2 || pending[0].TxID != "tx2" || pending[1].TxID != "tx3" {
+			t.Errorf("%s: pending records = %d, %v", name, len(pending), err)
+		}
+
+		if err = s.MarkBlockExtractDataRetracting(4); err != nil {
+			t.Fatalf("%s: MarkBlockExtractDataRetracting failed unexpected error: %v", name, err)
+		}
+		retracting, err := s.GetRetractingBlockExtractDataRecords()
+		if err != nil || len(retracting) != 1 || retracting[0].TxID != "tx4" || !retracting[0].Retracting {
+			t.Fatalf("%s: retracting records = %d, %v", name, len(retracting), err)
+		}
+		pending, _ = s.GetPendingBlockExtractDataRecords(10)
+		if len(pending) != 2 {
+			t.Errorf("%s: retracting record should not be pending, got %d", name, len(pending))
+		}
+
+		if err = s.DeleteBlockExtractDataRecord(retracting[0]); err != nil {
+			t.Errorf("%s: DeleteBlockExtractDataRecord failed unexpected error: %v", name, err)
+		}
+		retracting, _ = s.GetRetractingBlockExtractDataRecords()
+		if len(retracting) != 0 {
+			t.Errorf("%s: retracting records after delete = %d", name, len(retracting))
+		}
+	}
+}
+
+func TestScannerStorage_DeleteLocalBlockDataBelow(t *testing.T) {
+	for name, s := range testScannerStorages(t) {
+		for i := uint64(1); i <= 4; i++ {
+			s.SaveLocalBlock(&Block{Height: i, Hash: "hash"})
+		}
+		confirmed := testExtractDataRecord(1, "tx1")
+		confirmed.Confirmed = true
+		retracting := testExtractDataRecord(1, "tx1-retracting")
+		retracting.Confirmed = true
+		retracting.Retracting = true
+		s.SaveBlockExtractDataRecords([]*BlockExtractDataRecord{confirmed, retracting, testExtractDataRecord(2, "tx2")})
+
+		if err := s.DeleteLocalBlockDataBelow(3); err != nil {
+			t.Fatalf("%s: DeleteLocalBlockDataBelow failed unexpected error: %v", name, err)
+		}
+
+		if _, err := s.GetLocalBlock(2); err == nil {
+			t.Errorf("%s: block 2 should be pruned", name)
+		}
+		if _, err := s.GetLocalBlock(3); err != nil {
+			t.Errorf("%s: block 3 should be kept, %v", name, err)
+		}
+
+		//待确认和等待撤回的记录保留
+		list, _ := s.GetBlockExtractDataRecords(0)
+		if len(list) != 2 || list[0].TxID == "tx1" || list[1].TxID == "tx1" {
+			t.Errorf("%s: records after prune = %d", name, len(list))
+		}
+	}
+}
+
+func TestWalletManager_ScannerStorageConfig(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Config.dbPath = t.TempDir()
+	defer wm.CloseDB()
+
+	wm.Config.scannerstorage = ScannerStorageSQLite
+	if err := wm.SaveLocalNewBlock(7, "hash-7"); err != nil {
+		t.Fatalf("SaveLocalNewBlock failed unexpected error: %v", err)
+	}
+	if err := wm.CloseDB(); err != nil {
+		t.Fatalf("CloseDB failed unexpected error: %v", err)
+	}
+
+	height, hash, err := wm.GetLocalNewBlock()
+	if err != nil || height != 7 || hash != "hash-7" {
+		t.Errorf("sqlite local new block = %d:%s, %v", height, hash, err)
+	}
+
+	wm.CloseDB()
+	wm.Config.scannerstorage = "unknown"
+	if _, _, err = wm.GetLocalNewBlock(); err == nil {
+		t.Errorf("unknown scanner storage should return error")
+	}
+}
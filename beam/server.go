@@ -2,22 +2,55 @@ package beam
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/blocktree/openwallet/log"
+	"github.com/blocktree/openwallet/openwallet"
 	"github.com/blocktree/openwallet/owtp"
+	"sync"
+	"time"
 )
 
+const (
+	//服务端方法需要的权限，授信节点的permissions中配置
+	CapabilityRead    = "read"    //查询交易、余额、区块和地址登记信息
+	CapabilityAddress = "address" //创建和分配地址
+)
+
+//serverRoute 服务端路由，Capability为调用需要的权限，为空时授信节点都可以调用
+type serverRoute struct {
+	Method       string
+	Capability   string
+	WalletCall   bool //是否调用钱包API，受同时调用钱包API的请求数限制
+	AddressCount bool //参数count是否为创建地址的数量，受创建地址数量限制
+	Handler      owtp.HandlerFunc
+}
+
 type Server struct {
 	wm                *WalletManager
 	node              *owtp.OWTPNode
 	config            *WalletConfig
 	disconnectHandler func(node *Server, nodeID string)           //托管节点断开连接后的通知
 	connectHandler    func(node *Server, nodeInfo *TrustNodeInfo) //托管节点连接成功的通知
+	trustNodes        *TrustNodeList                              //授信节点
+	auditLog          *AuditLog                                   //审计日志，未开启时为nil
+	limiter           *serverLimiter                              //限流
+	pusher            *EventPusher                                //事件推送，未开启时为nil
+	closeOnce         sync.Once
 }
 
 func NewServer(wm *WalletManager) (*Server, error) {
 
 	config := wm.Config
 
+	trustNodes, err := NewTrustNodeList(config.trustnodes, config.trustnodefile)
+	if err != nil {
+		return nil, err
+	}
+
+	if !trustNodes.Enabled() {
+		wm.Log.Warn("No trust node is configured, any node can connect to the server")
+	}
+
 	cert := owtp.NewRandomCertificate()
 
 	connectCfg := owtp.ConnectConfig{}
@@ -30,20 +63,32 @@ func NewServer(wm *WalletManager) (*Server, error) {
 	})
 
 	t := &Server{
-		node:   node,
-		config: config,
-		wm:     wm,
+		node:       node,
+		config:     config,
+		wm:         wm,
+		trustNodes: trustNodes,
+		limiter:    newServerLimiter(config),
 	}
 
-	node.HandleFunc("newNodeJoin", t.newNodeJoin)
-	node.HandleFunc("getTransactionsByHeight", t.getTransactionsByHeight)
-	node.HandleFunc("getTransaction", t.getTransaction)
-	node.HandleFunc("createBatchAddress", t.createBatchAddress)
-	node.HandleFunc("getWalletBalance", t.getWalletBalance)
-	node.HandleFunc("getWalletAddress", t.getWalletAddress)
-	node.HandleFunc("getBlockByHeight", t.getBlockByHeight)
+	if config.enableauditlog {
+		t.auditLog, err = OpenAuditLog(config.auditlogfile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.enablepush {
+		t.pusher = NewEventPusher(wm, t.pushEvents)
+	}
+
+	for _, route := range t.routes() {
+		node.HandleFunc(route.Method, t.authorize(route))
+	}
 
 	node.SetCloseHandler(func(n *owtp.OWTPNode, peer owtp.PeerInfo) {
+		if t.pusher != nil {
+			t.pusher.Unsubscribe(peer.ID)
+		}
 		if t.disconnectHandler != nil {
 			t.disconnectHandler(t, peer.ID)
 		}
@@ -64,9 +109,16 @@ func (server *Server) Listen() {
 	})
 }
 
-//Close 关闭监听
+//Close 关闭监听和审计日志
 func (server *Server) Close() {
-	server.node.Close()
+	server.closeOnce.Do(func() {
+		server.node.Close()
+		if server.auditLog != nil {
+			if err := server.auditLog.Close(); err != nil {
+				server.wm.Log.Errorf("close audit log failed unexpected error: %v", err)
+			}
+		}
+	})
 }
 
 //SetConnectHandler 设置托管节点断开连接后的通知
@@ -79,29 +131,153 @@ func (server *Server) SetDisconnectHandler(h func(node *Server, nodeID string))
 	server.disconnectHandler = h
 }
 
-//checkTrustNode 检查是否授信节点
-func (server *Server) checkTrustNode(nodeID string) bool {
-	//判断连接的客户端NodeID是否授信
-	trustNodeID := server.wm.Config.trustnodeid
-	if len(trustNodeID) > 0 {
-		if trustNodeID != nodeID {
-			log.Warningf("The Joining Node: %s is not trusted", nodeID)
-			server.node.ClosePeer(nodeID)
-			return false
-		}
+//ReloadTrustNodes 重新加载授信节点文件
+func (server *Server) ReloadTrustNodes() error {
+	return server.trustNodes.Reload()
+}
+
+//TrustNodes 当前的授信节点
+func (server *Server) TrustNodes() []*TrustNode {
+	return server.trustNodes.Nodes()
+}
+
+//Pusher 事件推送，未开启enablepush时为nil
+func (server *Server) Pusher() *EventPusher {
+	return server.pusher
+}
+
+//pushEvents 向节点推送事件，返回节点确认的最大事件ID
+func (server *Server) pushEvents(nodeID string, events []*PushEvent) (uint64, error) {
+
+	var (
+		acked  uint64
+		retErr error
+	)
+
+	if !server.node.IsConnectPeer(nodeID) {
+		return 0, fmt.Errorf("node had disconnected: %s", nodeID)
+	}
+
+	params := map[string]interface{}{
+		"events": events,
 	}
 
-	return true
+	err := server.node.Call(nodeID, "pushEvents", params,
+		true, func(resp owtp.Response) {
+			//处理失败时，节点确认之前已处理的事件
+			acked = resp.JsonData().Get("acked").Uint()
+			if resp.Status != owtp.StatusSuccess {
+				retErr = openwallet.Errorf(resp.Status, resp.Msg)
+			}
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	return acked, retErr
 }
-/*********** 本地路由方法实现 ***********/
 
-func (server *Server) newNodeJoin(ctx *owtp.Context) {
+//routes 服务端的路由，每个方法声明调用需要的权限和限制
+func (server *Server) routes() []serverRoute {
+	return []serverRoute{
+		{Method: "newNodeJoin", Handler: server.newNodeJoin},
+		{Method: "getTransactionsByHeight", Capability: CapabilityRead, WalletCall: true, Handler: server.getTransactionsByHeight},
+		{Method: "getTransaction", Capability: CapabilityRead, WalletCall: true, Handler: server.getTransaction},
+		{Method: "createBatchAddress", Capability: CapabilityAddress, WalletCall: true, AddressCount: true, Handler: server.createBatchAddress},
+		{Method: "getWalletBalance", Capability: CapabilityRead, WalletCall: true, Handler: server.getWalletBalance},
+		{Method: "getWalletAddress", Capability: CapabilityRead, WalletCall: true, Handler: server.getWalletAddress},
+		{Method: "getBlockByHeight", Capability: CapabilityRead, WalletCall: true, Handler: server.getBlockByHeight},
+		{Method: "queryTransactions", Capability: CapabilityRead, WalletCall: true, Handler: server.queryTransactions},
+		{Method: "createAccountAddress", Capability: CapabilityAddress, WalletCall: true, AddressCount: true, Handler: server.createAccountAddress},
+		{Method: "allocateAccountAddress", Capability: CapabilityAddress, WalletCall: true, AddressCount: true, Handler: server.allocateAccountAddress},
+		{Method: "getAddressRecord", Capability: CapabilityRead, Handler: server.getAddressRecord},
+		{Method: "listAddressRecords", Capability: CapabilityRead, Handler: server.listAddressRecords},
+		{Method: "subscribeEvents", Capability: CapabilityRead, Handler: server.subscribeEvents},
+	}
+}
+
+//authorize 检查授信、权限和限流后再执行路由方法，并记录审计日志
+func (server *Server) authorize(route serverRoute) owtp.HandlerFunc {
+	return func(ctx *owtp.Context) {
+		start := time.Now()
+		defer server.audit(ctx, start)
 
-	if !server.checkTrustNode(ctx.PID) {
-		ctx.Response(nil, owtp.ErrDenialOfService, "the node is not trusted")
+		if err := server.checkTrustNode(ctx, route); err != nil {
+			ctx.Response(nil, owtp.ErrDenialOfService, err.Error())
+			return
+		}
+
+		permit, status, err := server.limiter.acquire(ctx, route)
+		if err != nil {
+			server.wm.Log.Warningf("The Node: %s call [%s] is limited: %v", ctx.PID, route.Method, err)
+			ctx.Response(nil, status, err.Error())
+			return
+		}
+		defer permit.release(ctx)
+
+		route.Handler(ctx)
+	}
+}
+
+//audit 记录请求的审计日志
+func (server *Server) audit(ctx *owtp.Context, start time.Time) {
+
+	if server.auditLog == nil {
 		return
 	}
 
+	entry := &AuditEntry{
+		Time:    start.Unix(),
+		NodeID:  ctx.PID,
+		Method:  ctx.Method,
+		Params:  ctx.Params().Raw,
+		Status:  ctx.Resp.Status,
+		Latency: int64(time.Since(start) / time.Millisecond),
+	}
+
+	if node, ok := server.trustNodes.Lookup(ctx.PID); ok {
+		entry.NodeName = node.Name
+	}
+
+	if ctx.Resp.Status == owtp.StatusSuccess {
+		entry.Result = auditResultSummary(ctx.Resp.Result)
+	} else {
+		entry.Error = ctx.Resp.Msg
+	}
+
+	err := server.auditLog.Append(entry)
+	if err != nil {
+		server.wm.Log.Errorf("append audit log failed unexpected error: %v", err)
+	}
+}
+
+//checkTrustNode 检查请求的节点是否授信节点，并拥有调用路由方法的权限
+func (server *Server) checkTrustNode(ctx *owtp.Context, route serverRoute) error {
+	//未配置授信节点时，任何节点都可以连接
+	if !server.trustNodes.Enabled() {
+		return nil
+	}
+
+	//判断连接的客户端NodeID是否授信
+	node, ok := server.trustNodes.Lookup(ctx.PID)
+	if !ok {
+		log.Warningf("The Joining Node: %s is not trusted", ctx.PID)
+		server.node.ClosePeer(ctx.PID)
+		return fmt.Errorf("the node is not trusted")
+	}
+
+	//权限可以是路由声明的权限，也可以是方法名
+	if len(route.Capability) > 0 && !node.HasPermission(route.Capability) && !node.HasPermission(route.Method) {
+		log.Warningf("The Node: %s [%s] has no permission [%s] to call [%s]", ctx.PID, node.Name, route.Capability, route.Method)
+		return fmt.Errorf("the node has no permission to call %s", route.Method)
+	}
+
+	return nil
+}
+/*********** 本地路由方法实现 ***********/
+
+func (server *Server) newNodeJoin(ctx *owtp.Context) {
+
 	if server.connectHandler != nil {
 		var nodeInfo TrustNodeInfo
 		err := json.Unmarshal([]byte(ctx.Params().Get("nodeInfo").Raw), &nodeInfo)
@@ -119,13 +295,8 @@ func (server *Server) getTransactionsByHeight(ctx *owtp.Context) {
 
 	//server.wm.Log.Infof("Client call [getTransactionsByHeight]")
 
-	if !server.checkTrustNode(ctx.PID) {
-		ctx.Response(nil, owtp.ErrDenialOfService, "the node is not trusted")
-		return
-	}
-
 	height := ctx.Params().Get("height").Uint()
-	txs, err := server.wm.walletClient.GetTransactionsByHeight(height)
+	txs, err := server.wm.walletClient.GetTransactionsByHeight(server.wm.context(), height)
 	if err != nil {
 		ctx.Response(nil, owtp.ErrCustomError, err.Error())
 		return
@@ -140,13 +311,8 @@ func (server *Server) getTransaction(ctx *owtp.Context) {
 
 	server.wm.Log.Infof("Client call [getTransaction]")
 
-	if !server.checkTrustNode(ctx.PID) {
-		ctx.Response(nil, owtp.ErrDenialOfService, "the node is not trusted")
-		return
-	}
-
 	txid := ctx.Params().Get("txid").String()
-	tx, err := server.wm.walletClient.GetTransaction(txid)
+	tx, err := server.wm.walletClient.GetTransaction(server.wm.context(), txid)
 	if err != nil {
 		ctx.Response(nil, owtp.ErrCustomError, err.Error())
 		return
@@ -166,6 +332,12 @@ func (server *Server) createBatchAddress(ctx *owtp.Context) {
 
 	addrs, err := server.wm.CreateLocalWalletAddress(count, workerSize)
 	if err != nil {
+		//部分地址创建失败时，返回已创建的地址和各地址的失败原因
+		if batchErr, ok := err.(*BatchAddressError); ok {
+			server.wm.Log.Errorf("createBatchAddress incomplete: %v", batchErr)
+			ctx.Response(batchErr.Result, owtp.ErrCustomError, err.Error())
+			return
+		}
 		ctx.Response(nil, owtp.ErrCustomError, err.Error())
 		return
 	}
@@ -178,11 +350,6 @@ func (server *Server) createBatchAddress(ctx *owtp.Context) {
 func (server *Server) getWalletBalance(ctx *owtp.Context) {
 	server.wm.Log.Infof("Client call [getWalletBalance]")
 
-	if !server.checkTrustNode(ctx.PID) {
-		ctx.Response(nil, owtp.ErrDenialOfService, "the node is not trusted")
-		return
-	}
-
 	balance, err := server.wm.GetLocalWalletBalance()
 	if err != nil {
 		ctx.Response(nil, owtp.ErrCustomError, err.Error())
@@ -203,11 +370,6 @@ func (server *Server) getWalletBalance(ctx *owtp.Context) {
 func (server *Server) getWalletAddress(ctx *owtp.Context) {
 	server.wm.Log.Infof("Client call [getWalletAddress]")
 
-	if !server.checkTrustNode(ctx.PID) {
-		ctx.Response(nil, owtp.ErrDenialOfService, "the node is not trusted")
-		return
-	}
-
 	addrs, err := server.wm.GetLocalWalletAddress()
 	if err != nil {
 		ctx.Response(nil, owtp.ErrCustomError, err.Error())
@@ -224,13 +386,8 @@ func (server *Server) getBlockByHeight(ctx *owtp.Context) {
 
 	//server.wm.Log.Infof("Client call [getTransactionsByHeight]")
 
-	if !server.checkTrustNode(ctx.PID) {
-		ctx.Response(nil, owtp.ErrDenialOfService, "the node is not trusted")
-		return
-	}
-
 	height := ctx.Params().Get("height").Uint()
-	block, err := server.wm.walletClient.GetBlockByHeight(height)
+	block, err := server.wm.walletClient.GetBlockByHeight(server.wm.context(), height)
 	if err != nil {
 		ctx.Response(nil, owtp.ErrCustomError, err.Error())
 		return
@@ -239,4 +396,123 @@ func (server *Server) getBlockByHeight(ctx *owtp.Context) {
 	ctx.Response(block, owtp.StatusSuccess, "success")
 
 	//server.wm.Log.Infof("---------------------------------------")
+}
+
+func (server *Server) queryTransactions(ctx *owtp.Context) {
+
+	var query TxQuery
+	if raw := ctx.Params().Get("query"); raw.Exists() {
+		err := json.Unmarshal([]byte(raw.Raw), &query)
+		if err != nil {
+			ctx.Response(nil, owtp.ErrCustomError, err.Error())
+			return
+		}
+	}
+
+	result, err := server.wm.QueryTransactions(&query)
+	if err != nil {
+		ctx.Response(nil, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	ctx.Response(result, owtp.StatusSuccess, "success")
+}
+
+func (server *Server) createAccountAddress(ctx *owtp.Context) {
+
+	accountID := ctx.Params().Get("accountID").String()
+	comment := ctx.Params().Get("comment").String()
+	expiration := ctx.Params().Get("expiration").String()
+	count := ctx.Params().Get("count").Uint()
+	workerSize := ctx.Params().Get("workerSize").Uint()
+	server.wm.Log.Infof("Client call [createAccountAddress]")
+	server.wm.Log.Infof("accountID: %s, count: %d", accountID, count)
+
+	records, err := server.wm.CreateAccountAddress(accountID, comment, expiration, count, workerSize)
+	if err != nil {
+		//部分地址创建失败时，返回已登记的地址和各地址的失败原因
+		if batchErr, ok := err.(*BatchAddressError); ok {
+			server.wm.Log.Errorf("createAccountAddress incomplete: %v", batchErr)
+			ctx.Response(&AccountAddressResult{Records: records, Result: batchErr.Result}, owtp.ErrCustomError, err.Error())
+			return
+		}
+		ctx.Response(nil, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	ctx.Response(records, owtp.StatusSuccess, "success")
+
+	server.wm.Log.Infof("---------------------------------------")
+}
+
+func (server *Server) allocateAccountAddress(ctx *owtp.Context) {
+
+	accountID := ctx.Params().Get("accountID").String()
+	comment := ctx.Params().Get("comment").String()
+	expiration := ctx.Params().Get("expiration").String()
+	count := ctx.Params().Get("count").Uint()
+	server.wm.Log.Infof("Client call [allocateAccountAddress]")
+	server.wm.Log.Infof("accountID: %s, count: %d", accountID, count)
+
+	records, err := server.wm.AllocateAccountAddress(accountID, comment, expiration, count)
+	if err != nil {
+		//部分地址创建失败时，返回已登记的地址和各地址的失败原因
+		if batchErr, ok := err.(*BatchAddressError); ok {
+			server.wm.Log.Errorf("allocateAccountAddress incomplete: %v", batchErr)
+			ctx.Response(&AccountAddressResult{Records: records, Result: batchErr.Result}, owtp.ErrCustomError, err.Error())
+			return
+		}
+		ctx.Response(nil, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	ctx.Response(records, owtp.StatusSuccess, "success")
+
+	server.wm.Log.Infof("---------------------------------------")
+}
+
+func (server *Server) getAddressRecord(ctx *owtp.Context) {
+
+	address := ctx.Params().Get("address").String()
+	record, err := server.wm.GetAddressRecord(address)
+	if err != nil {
+		ctx.Response(nil, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	ctx.Response(record, owtp.StatusSuccess, "success")
+}
+
+func (server *Server) listAddressRecords(ctx *owtp.Context) {
+
+	accountID := ctx.Params().Get("accountID").String()
+	offset := ctx.Params().Get("offset").Int()
+	limit := ctx.Params().Get("limit").Int()
+	records, err := server.wm.ListAddressRecords(accountID, int(offset), int(limit))
+	if err != nil {
+		ctx.Response(nil, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	ctx.Response(records, owtp.StatusSuccess, "success")
+}
+
+func (server *Server) subscribeEvents(ctx *owtp.Context) {
+
+	if server.pusher == nil {
+		ctx.Response(nil, owtp.ErrCustomError, "server push is not enabled")
+		return
+	}
+
+	acked := ctx.Params().Get("acked").Uint()
+	cursor, err := server.pusher.Subscribe(ctx.PID, acked)
+	if err != nil {
+		ctx.Response(nil, owtp.ErrCustomError, err.Error())
+		return
+	}
+
+	ctx.Response(map[string]interface{}{"acked": cursor.Acked}, owtp.StatusSuccess, "success")
+
+	//重发节点断开前未确认的事件
+	go server.pusher.Deliver(ctx.PID)
 }
\ No newline at end of file
@@ -0,0 +1,328 @@
+package beam
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/owtp"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//服务端限流的OWTP错误码
+	ErrRateLimitExceeded uint64 = 601 //请求频率超过限制
+	ErrQuotaExceeded     uint64 = 602 //创建地址数量超过限制
+	ErrServerBusy        uint64 = 603 //同时调用钱包API的请求数超过限制
+
+	//每次创建地址的最大数量
+	DefaultMaxAddressPerCall = 1000
+
+	//限流桶数量超过该值时，清理空闲的桶
+	rateBucketPruneSize = 1024
+)
+
+//MethodRateLimit 方法的限流配置
+type MethodRateLimit struct {
+	Method string
+	Rate   float64 //每秒请求数
+	Burst  float64 //突发请求数
+}
+
+//parseMethodRateLimits 解析方法的限流配置，格式：method:rate[:burst], ...
+func parseMethodRateLimits(value string) ([]*MethodRateLimit, error) {
+
+	limits := make([]*MethodRateLimit, 0)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		if len(fields) < 2 || len(fields) > 3 || len(strings.TrimSpace(fields[0])) == 0 {
+			return nil, fmt.Errorf("invalid method rate limit: %s", entry)
+		}
+
+		limit := &MethodRateLimit{Method: strings.TrimSpace(fields[0])}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid method rate limit: %s", entry)
+		}
+		limit.Rate = rate
+		limit.Burst = math.Max(1, math.Ceil(rate))
+
+		if len(fields) == 3 {
+			burst, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+			if err != nil || burst < 1 {
+				return nil, fmt.Errorf("invalid method rate limit: %s", entry)
+			}
+			limit.Burst = burst
+		}
+
+		limits = append(limits, limit)
+	}
+
+	return limits, nil
+}
+
+//tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//rateLimiter 按key限流，每个key一个令牌桶
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+//allow 取出一个令牌，没有令牌时返回false
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= rateBucketPruneSize {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+//prune 清理已经装满的桶，装满的桶和新建的桶等价
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+//addressQuota 每个节点每天创建地址的数量，服务重启后重新计数
+type addressQuota struct {
+	mu   sync.Mutex
+	max  uint64
+	day  string
+	used map[string]uint64
+}
+
+func newAddressQuota(max uint64) *addressQuota {
+	return &addressQuota{
+		max:  max,
+		used: make(map[string]uint64),
+	}
+}
+
+//reserve 预留当天的地址数量
+func (q *addressQuota) reserve(nodeID string, count uint64, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if day := now.Format("2006-01-02"); day != q.day {
+		q.day = day
+		q.used = make(map[string]uint64)
+	}
+
+	if q.used[nodeID]+count > q.max {
+		return fmt.Errorf("daily address quota exceeded: used %d, request %d, max %d", q.used[nodeID], count, q.max)
+	}
+	q.used[nodeID] += count
+	return nil
+}
+
+//refund 退回没有创建的地址数量
+func (q *addressQuota) refund(nodeID string, count uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.used[nodeID] < count {
+		count = q.used[nodeID]
+	}
+	q.used[nodeID] -= count
+}
+
+//serverLimiter 服务端的限流和数量限制，在调用钱包API前检查
+type serverLimiter struct {
+	node              *rateLimiter            //每个节点的请求频率，nil不限制
+	methods           map[string]*rateLimiter //每个节点调用方法的频率
+	maxAddressPerCall uint64                  //每次创建地址的最大数量，0不限制
+	addressQuota      *addressQuota           //每个节点每天创建地址的数量，nil不限制
+	walletCalls       chan struct{}           //同时调用钱包API的请求，nil不限制
+	maxAddressWorker  uint64                  //批量创建地址的最大并行线程数，每个线程占用一个钱包API调用
+}
+
+func newServerLimiter(config *WalletConfig) *serverLimiter {
+
+	l := &serverLimiter{
+		methods:           make(map[string]*rateLimiter),
+		maxAddressPerCall: config.maxaddresspercall,
+		maxAddressWorker:  config.maxbatchaddressworker,
+	}
+
+	if config.noderatelimit > 0 {
+		l.node = newRateLimiter(config.noderatelimit, config.noderateburst)
+	}
+
+	for _, m := range config.methodratelimits {
+		l.methods[m.Method] = newRateLimiter(m.Rate, m.Burst)
+	}
+
+	if config.maxaddressperday > 0 {
+		l.addressQuota = newAddressQuota(config.maxaddressperday)
+	}
+
+	if config.maxconcurrentwalletcalls > 0 {
+		l.walletCalls = make(chan struct{}, config.maxconcurrentwalletcalls)
+	}
+
+	return l
+}
+
+//serverPermit 通过限流检查的请求，处理完成后释放
+type serverPermit struct {
+	limiter     *serverLimiter
+	nodeID      string
+	walletCalls int    //占用的钱包API调用数
+	addresses   uint64 //预留的地址数量
+}
+
+//acquire 检查请求频率和数量限制，超过时返回OWTP错误码
+func (l *serverLimiter) acquire(ctx *owtp.Context, route serverRoute) (*serverPermit, uint64, error) {
+
+	now := time.Now()
+	permit := &serverPermit{limiter: l, nodeID: ctx.PID}
+
+	if l.node != nil && !l.node.allow(ctx.PID, now) {
+		return nil, ErrRateLimitExceeded, fmt.Errorf("rate limit exceeded for node %s", ctx.PID)
+	}
+
+	if m, ok := l.methods[route.Method]; ok && !m.allow(ctx.PID, now) {
+		return nil, ErrRateLimitExceeded, fmt.Errorf("rate limit exceeded for method %s", route.Method)
+	}
+
+	if route.AddressCount {
+		count := ctx.Params().Get("count").Uint()
+		if l.maxAddressPerCall > 0 && count > l.maxAddressPerCall {
+			return nil, ErrQuotaExceeded, fmt.Errorf("address count %d exceeds the maximum %d per call", count, l.maxAddressPerCall)
+		}
+		if l.addressQuota != nil {
+			if err := l.addressQuota.reserve(ctx.PID, count, now); err != nil {
+				return nil, ErrQuotaExceeded, err
+			}
+			permit.addresses = count
+		}
+	}
+
+	if route.WalletCall && l.walletCalls != nil {
+		calls := l.walletCallCount(ctx, route)
+		for i := 0; i < calls; i++ {
+			select {
+			case l.walletCalls <- struct{}{}:
+				permit.walletCalls++
+			default:
+				permit.releaseWalletCalls()
+				permit.refund(permit.addresses)
+				return nil, ErrServerBusy, fmt.Errorf("too many concurrent wallet requests, try again later")
+			}
+		}
+	}
+
+	return permit, owtp.StatusSuccess, nil
+}
+
+//walletCallCount 请求同时调用钱包API的数量，批量创建地址按并行线程数计算，不超过总的限制
+func (l *serverLimiter) walletCallCount(ctx *owtp.Context, route serverRoute) int {
+
+	if !route.AddressCount {
+		return 1
+	}
+
+	count := ctx.Params().Get("count").Uint()
+	workers := count
+	if workerSize := ctx.Params().Get("workerSize"); workerSize.Exists() {
+		workers = workerSize.Uint()
+	}
+	if l.maxAddressWorker > 0 && workers > l.maxAddressWorker {
+		workers = l.maxAddressWorker
+	}
+	if workers > count {
+		workers = count
+	}
+	if workers == 0 {
+		workers = 1
+	}
+	if workers > uint64(cap(l.walletCalls)) {
+		workers = uint64(cap(l.walletCalls))
+	}
+	return int(workers)
+}
+
+//releaseWalletCalls 释放占用的钱包API调用
+func (p *serverPermit) releaseWalletCalls() {
+	for ; p.walletCalls > 0; p.walletCalls-- {
+		<-p.limiter.walletCalls
+	}
+}
+
+//release 释放钱包API调用，请求失败时退回没有创建的地址数量
+func (p *serverPermit) release(ctx *owtp.Context) {
+
+	p.releaseWalletCalls()
+
+	if p.addresses > 0 {
+		created := addressResultCount(ctx.Resp.Result)
+		if created < p.addresses {
+			p.refund(p.addresses - created)
+		}
+	}
+}
+
+//addressResultCount 响应中实际创建或分配的地址数量，包括部分失败时返回的结果
+func addressResultCount(result interface{}) uint64 {
+	switch r := result.(type) {
+	case []string:
+		return uint64(len(r))
+	case []*AddressRecord:
+		return uint64(len(r))
+	case *BatchAddressResult:
+		return uint64(len(r.Addresses))
+	case *AccountAddressResult:
+		return uint64(len(r.Records))
+	}
+	return 0
+}
+
+//refund 退回预留的地址数量
+func (p *serverPermit) refund(count uint64) {
+	if p.limiter.addressQuota != nil && count > 0 {
+		p.limiter.addressQuota.refund(p.nodeID, count)
+	}
+}
@@ -0,0 +1,295 @@
+package beam
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/owtp"
+)
+
+func TestParseMethodRateLimits(t *testing.T) {
+	limits, err := parseMethodRateLimits("createBatchAddress:0.1, getTransactionsByHeight:50:100")
+	if err != nil {
+		t.Fatalf("parseMethodRateLimits failed unexpected error: %v", err)
+	}
+	if len(limits) != 2 {
+		t.Fatalf("parseMethodRateLimits = %d limits, want 2", len(limits))
+	}
+	if limits[0].Method != "createBatchAddress" || limits[0].Rate != 0.1 || limits[0].Burst != 1 {
+		t.Errorf("limit = %+v", limits[0])
+	}
+	if limits[1].Method != "getTransactionsByHeight" || limits[1].Rate != 50 || limits[1].Burst != 100 {
+		t.Errorf("limit = %+v", limits[1])
+	}
+	for _, invalid := range []string{"createBatchAddress", "createBatchAddress:0", "createBatchAddress:x", ":1", "a:1:0", "a:1:2:3"} {
+		if _, err = parseMethodRateLimits(invalid); err == nil {
+			t.Errorf("parseMethodRateLimits(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !l.allow("a", now) {
+			t.Fatalf("request %d within burst should be allowed", i)
+		}
+	}
+	if l.allow("a", now) {
+		t.Errorf("request over burst should be limited")
+	}
+	if !l.allow("b", now) {
+		t.Errorf("another key should not be limited")
+	}
+
+	//每秒补充2个令牌
+	now = now.Add(500 * time.Millisecond)
+	if !l.allow("a", now) || l.allow("a", now) {
+		t.Errorf("one token should be refilled after 500ms")
+	}
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !l.allow("a", now) {
+			t.Fatalf("tokens should be refilled up to burst")
+		}
+	}
+	if l.allow("a", now) {
+		t.Errorf("tokens should not exceed burst")
+	}
+}
+
+func TestAddressQuota(t *testing.T) {
+	q := newAddressQuota(10)
+	day := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+
+	if err := q.reserve("a", 8, day); err != nil {
+		t.Fatalf("reserve failed unexpected error: %v", err)
+	}
+	if err := q.reserve("a", 3, day); err == nil {
+		t.Errorf("reserve over quota should fail")
+	}
+	if err := q.reserve("b", 10, day); err != nil {
+		t.Errorf("quota should be per node, got %v", err)
+	}
+	q.refund("a", 5)
+	if err := q.reserve("a", 7, day); err != nil {
+		t.Errorf("reserve after refund failed unexpected error: %v", err)
+	}
+
+	//第二天重新计数
+	if err := q.reserve("a", 10, day.AddDate(0, 0, 1)); err != nil {
+		t.Errorf("quota should reset next day, got %v", err)
+	}
+}
+
+func TestServer_Limit(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.Config.noderatelimit = 0
+	wm.Config.methodratelimits, _ = parseMethodRateLimits("getWalletAddress:0.001:2")
+	wm.Config.maxaddresspercall = 5
+	wm.Config.maxaddressperday = 8
+	wm.Config.maxconcurrentwalletcalls = 1
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	call := func(nodeID, method, params string) owtp.Response {
+		ctx := owtp.NewContext(1, 1, nodeID, method, []byte(params))
+		server.authorize(testServerRoute(t, server, method))(ctx)
+		return ctx.Resp
+	}
+
+	//方法频率限制
+	for i := 0; i < 2; i++ {
+		if resp := call("11111", "getWalletAddress", `{}`); resp.Status != owtp.StatusSuccess {
+			t.Fatalf("getWalletAddress = %+v", resp)
+		}
+	}
+	if resp := call("11111", "getWalletAddress", `{}`); resp.Status != ErrRateLimitExceeded {
+		t.Errorf("getWalletAddress over rate limit = %+v", resp)
+	}
+	if resp := call("22222", "getWalletAddress", `{}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("rate limit should be per node, got %+v", resp)
+	}
+
+	//每次和每天的地址数量限制
+	before := srv.Calls("create_address")
+	if resp := call("11111", "createBatchAddress", `{"count":6,"workerSize":1}`); resp.Status != ErrQuotaExceeded {
+		t.Errorf("createBatchAddress over max per call = %+v", resp)
+	}
+	if resp := call("11111", "createBatchAddress", `{"count":5,"workerSize":1}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("createBatchAddress = %+v", resp)
+	}
+	if resp := call("11111", "createBatchAddress", `{"count":4,"workerSize":1}`); resp.Status != ErrQuotaExceeded {
+		t.Errorf("createBatchAddress over daily quota = %+v", resp)
+	}
+	if n := srv.Calls("create_address") - before; n != 5 {
+		t.Errorf("create_address calls = %d, want 5", n)
+	}
+
+	//创建失败的地址退回每日数量
+	srv.FailRPC("create_address", -32603, "Internal JSON-RPC error.", 3)
+	if resp := call("11111", "createBatchAddress", `{"count":3,"workerSize":1}`); resp.Status != owtp.ErrCustomError {
+		t.Errorf("createBatchAddress with wallet error = %+v", resp)
+	}
+	if resp := call("11111", "createBatchAddress", `{"count":3,"workerSize":1}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("createBatchAddress after refund = %+v", resp)
+	}
+
+	//同时调用钱包API的请求数限制，不调用钱包API的方法不受限制
+	server.limiter.walletCalls <- struct{}{}
+	if resp := call("22222", "getWalletBalance", `{}`); resp.Status != ErrServerBusy {
+		t.Errorf("getWalletBalance when busy = %+v", resp)
+	}
+	if resp := call("22222", "listAddressRecords", `{}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("listAddressRecords when busy = %+v", resp)
+	}
+	<-server.limiter.walletCalls
+	if resp := call("22222", "getWalletBalance", `{}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("getWalletBalance = %+v", resp)
+	}
+	if len(server.limiter.walletCalls) != 0 {
+		t.Errorf("wallet call slot is not released")
+	}
+}
+
+func TestServer_LimitPartialRefund(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.Config.noderatelimit = 0
+	wm.Config.maxaddressperday = 5
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	call := func(method, params string) owtp.Response {
+		ctx := owtp.NewContext(1, 1, "11111", method, []byte(params))
+		server.authorize(testServerRoute(t, server, method))(ctx)
+		return ctx.Resp
+	}
+
+	//部分地址创建失败时，只退回未创建的数量
+	srv.FailRPC("create_address", -32603, "Internal JSON-RPC error.", 1)
+	if resp := call("createAccountAddress", `{"accountID":"user-1","count":3,"workerSize":1}`); resp.Status != owtp.ErrCustomError {
+		t.Fatalf("createAccountAddress with wallet error = %+v", resp)
+	}
+	if resp := call("allocateAccountAddress", `{"accountID":"user-1","count":3}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("allocateAccountAddress = %+v", resp)
+	}
+	if resp := call("createBatchAddress", `{"count":1,"workerSize":1}`); resp.Status != ErrQuotaExceeded {
+		t.Errorf("createBatchAddress over daily quota = %+v", resp)
+	}
+}
+
+func TestServer_LimitAddressWorkers(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+	wm.Config.maxconcurrentwalletcalls = 4
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	call := func(params string) owtp.Response {
+		ctx := owtp.NewContext(1, 1, "11111", "createBatchAddress", []byte(params))
+		server.authorize(testServerRoute(t, server, "createBatchAddress"))(ctx)
+		return ctx.Resp
+	}
+
+	//批量创建地址按并行线程数占用钱包API调用
+	server.limiter.walletCalls <- struct{}{}
+	server.limiter.walletCalls <- struct{}{}
+	if resp := call(`{"count":5,"workerSize":3}`); resp.Status != ErrServerBusy {
+		t.Errorf("createBatchAddress with 3 workers when 2 calls are free = %+v", resp)
+	}
+	if len(server.limiter.walletCalls) != 2 {
+		t.Errorf("wallet calls = %d, want 2 after busy", len(server.limiter.walletCalls))
+	}
+	if resp := call(`{"count":5,"workerSize":2}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("createBatchAddress with 2 workers = %+v", resp)
+	}
+	<-server.limiter.walletCalls
+	<-server.limiter.walletCalls
+
+	//线程数超过总的限制时占用全部钱包API调用
+	if resp := call(`{"count":8,"workerSize":8}`); resp.Status != owtp.StatusSuccess {
+		t.Errorf("createBatchAddress with more workers than the limit = %+v", resp)
+	}
+	if len(server.limiter.walletCalls) != 0 {
+		t.Errorf("wallet calls are not released")
+	}
+}
+
+func TestServer_DefaultLimitsCatchUp(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(100)
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	//按客户端追块的方式，每次并发预取一个窗口的区块和交易单
+	tip := srv.Tip().Height
+	for from := uint64(1); from <= tip; from += maxScanningWindow {
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			failed []owtp.Response
+		)
+		for height := from; height < from+maxScanningWindow && height <= tip; height++ {
+			for _, method := range []string{"getBlockByHeight", "getTransactionsByHeight"} {
+				wg.Add(1)
+				go func(method string, height uint64) {
+					defer wg.Done()
+					ctx := owtp.NewContext(1, height, "11111", method, []byte(fmt.Sprintf(`{"height":%d}`, height)))
+					server.authorize(testServerRoute(t, server, method))(ctx)
+					if ctx.Resp.Status != owtp.StatusSuccess {
+						mu.Lock()
+						failed = append(failed, ctx.Resp)
+						mu.Unlock()
+					}
+				}(method, height)
+			}
+		}
+		wg.Wait()
+		if len(failed) > 0 {
+			t.Fatalf("catch up from height %d failed with default limits: %+v", from, failed[0])
+		}
+	}
+}
+
+func TestServer_NodeRateLimit(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+	wm.Config.noderatelimit = 0.001
+	wm.Config.noderateburst = 1
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	handler := server.authorize(testServerRoute(t, server, "listAddressRecords"))
+	ctx := owtp.NewContext(1, 1, "11111", "listAddressRecords", []byte(`{}`))
+	handler(ctx)
+	if ctx.Resp.Status != owtp.StatusSuccess {
+		t.Fatalf("listAddressRecords = %+v", ctx.Resp)
+	}
+	ctx = owtp.NewContext(1, 2, "11111", "getAddressRecord", []byte(`{}`))
+	server.authorize(testServerRoute(t, server, "getAddressRecord"))(ctx)
+	if ctx.Resp.Status != ErrRateLimitExceeded {
+		t.Errorf("node rate limit should apply to all methods, got %+v", ctx.Resp)
+	}
+}
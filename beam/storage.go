@@ -0,0 +1,134 @@
+package beam
+
+import (
+	"fmt"
+	"github.com/asdine/storm"
+	"go.etcd.io/bbolt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	//数据库文件被其它进程占用时，等待打开的时限
+	storageOpenTimeout = 3 * time.Second
+)
+
+//walletStorage 本地数据库，由WalletManager持有，首次使用时打开，关闭前一直复用，并发安全
+type walletStorage struct {
+	mu      sync.Mutex
+	dbs     map[string]*storm.DB
+	scanner ScannerStorage //区块扫描状态存储
+}
+
+func newWalletStorage() *walletStorage {
+	return &walletStorage{
+		dbs: make(map[string]*storm.DB),
+	}
+}
+
+//open 打开或复用数据库文件
+func (s *walletStorage) open(path string) (*storm.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if db, exist := s.dbs[path]; exist {
+		return db, nil
+	}
+
+	db, err := storm.Open(path, storm.BoltOptions(0600, &bbolt.Options{Timeout: storageOpenTimeout}))
+	if err != nil {
+		return nil, fmt.Errorf("open database: %s failed, unexpected error: %v", path, err)
+	}
+	s.dbs[path] = db
+	return db, nil
+}
+
+//closeFile 关闭指定的数据库文件
+func (s *walletStorage) closeFile(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, exist := s.dbs[path]
+	if !exist {
+		return nil
+	}
+	delete(s.dbs, path)
+
+	err := db.Close()
+	if err != nil {
+		return fmt.Errorf("close database: %s failed, unexpected error: %v", path, err)
+	}
+	return nil
+}
+
+//scannerStorage 获取区块扫描状态存储，未创建时调用create创建
+func (s *walletStorage) scannerStorage(create func() (ScannerStorage, error)) (ScannerStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scanner != nil {
+		return s.scanner, nil
+	}
+
+	scanner, err := create()
+	if err != nil {
+		return nil, err
+	}
+	s.scanner = scanner
+	return scanner, nil
+}
+
+//setScannerStorage 设置区块扫描状态存储
+func (s *walletStorage) setScannerStorage(scanner ScannerStorage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scanner = scanner
+}
+
+//close 关闭区块扫描状态存储和所有已打开的数据库文件
+func (s *walletStorage) close() error {
+
+	var closeErr error
+
+	s.mu.Lock()
+	scanner := s.scanner
+	s.scanner = nil
+	s.mu.Unlock()
+
+	if scanner != nil {
+		closeErr = scanner.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for path, db := range s.dbs {
+		err := db.Close()
+		if err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("close database: %s failed, unexpected error: %v", path, err)
+		}
+		delete(s.dbs, path)
+	}
+	return closeErr
+}
+
+//withdrawalDB 提现账本数据库
+func (wm *WalletManager) withdrawalDB() (*storm.DB, error) {
+	return wm.storage.open(filepath.Join(wm.Config.dbPath, wm.Config.WithdrawalFile))
+}
+
+//addressDB 地址登记数据库
+func (wm *WalletManager) addressDB() (*storm.DB, error) {
+	return wm.storage.open(filepath.Join(wm.Config.dbPath, wm.Config.AddressFile))
+}
+
+//pushDB 推送事件数据库
+func (wm *WalletManager) pushDB() (*storm.DB, error) {
+	return wm.storage.open(filepath.Join(wm.Config.dbPath, wm.Config.PushFile))
+}
+
+//CloseDB 关闭本地数据库，程序退出前调用
+func (wm *WalletManager) CloseDB() error {
+	return wm.storage.close()
+}
@@ -0,0 +1,111 @@
+package beam
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWalletManager_SaveScannedBlock(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Config.dbPath = t.TempDir()
+	defer wm.CloseDB()
+
+	height, hash, err := wm.GetLocalNewBlock()
+	if err != nil || height != 0 || hash != "" {
+		t.Fatalf("empty local new block = %d:%s, %v", height, hash, err)
+	}
+
+	block := &Block{Height: 10, Hash: "hash-10", PrevBlockHash: "hash-9"}
+	if err = wm.SaveScannedBlock(block); err != nil {
+		t.Fatalf("SaveScannedBlock failed unexpected error: %v", err)
+	}
+
+	//关闭后重新打开，数据已持久化
+	if err = wm.CloseDB(); err != nil {
+		t.Fatalf("CloseDB failed unexpected error: %v", err)
+	}
+
+	height, hash, err = wm.GetLocalNewBlock()
+	if err != nil || height != 10 || hash != "hash-10" {
+		t.Errorf("local new block = %d:%s, %v", height, hash, err)
+	}
+	local, err := wm.GetLocalBlock(10)
+	if err != nil || local.PrevBlockHash != "hash-9" {
+		t.Errorf("local block = %+v, %v", local, err)
+	}
+}
+
+func TestWalletManager_StorageConcurrent(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Config.dbPath = t.TempDir()
+	defer wm.CloseDB()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(height uint64) {
+			defer wg.Done()
+			errs <- wm.SaveScannedBlock(&Block{Height: height, Hash: "hash"})
+		}(uint64(i + 1))
+		go func(height uint64) {
+			defer wg.Done()
+			errs <- wm.Blockscanner.SaveUnscanRecord(NewUnscanRecord(height, "", "test"))
+		}(uint64(i + 1))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent write failed unexpected error: %v", err)
+		}
+	}
+
+	list, err := wm.GetUnscanRecords()
+	if err != nil || len(list) != 50 {
+		t.Errorf("unscan records = %d, %v", len(list), err)
+	}
+}
+
+func TestWalletManager_StorageOpenError(t *testing.T) {
+	wm := NewWalletManager()
+	dir := t.TempDir()
+	wm.Config.dbPath = filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(wm.Config.dbPath, []byte("not a directory"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := wm.GetLocalNewBlock(); err == nil {
+		t.Errorf("GetLocalNewBlock should return open error")
+	}
+	if err := wm.SaveLocalNewBlock(1, "hash"); err == nil {
+		t.Errorf("SaveLocalNewBlock should return open error")
+	}
+}
+
+func TestWalletManager_DeleteUnscanRecordNotFindTX(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Config.dbPath = t.TempDir()
+	defer wm.CloseDB()
+
+	reasons := []string{
+		(&RPCError{Code: ErrCodeInvalidTxID, Message: "Invalid transaction ID."}).Error(),
+		"[-5]No information available about transaction",
+		(&RPCError{Code: ErrCodeInternalError, Message: "Internal JSON-RPC error."}).Error(),
+	}
+	for i, reason := range reasons {
+		wm.Blockscanner.SaveUnscanRecord(NewUnscanRecord(uint64(i+1), "", reason))
+	}
+
+	if err := wm.DeleteUnscanRecordNotFindTX(); err != nil {
+		t.Fatalf("DeleteUnscanRecordNotFindTX failed unexpected error: %v", err)
+	}
+
+	list, err := wm.GetUnscanRecords()
+	if err != nil || len(list) != 1 || list[0].BlockHeight != 3 {
+		t.Errorf("unscan records = %d, %v", len(list), err)
+	}
+}
@@ -0,0 +1,230 @@
+package beam
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/blocktree/openwallet/log"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//授信节点拥有全部权限
+	TrustNodePermissionAll = "*"
+	//授信节点文件的检查周期，文件修改后重新加载
+	DefaultTrustNodeReloadPeriod = 10 * time.Second
+)
+
+//TrustNode 授信节点
+type TrustNode struct {
+	NodeID      string   `json:"nodeID"`      //@required 节点ID
+	Name        string   `json:"name"`        //节点名称，用于日志
+	Permissions []string `json:"permissions"` //权限，为空时没有任何权限
+}
+
+//HasPermission 是否拥有权限
+func (n *TrustNode) HasPermission(permission string) bool {
+	for _, p := range n.Permissions {
+		if p == TrustNodePermissionAll || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+//parseTrustNodes 解析配置文件的授信节点列表，格式：name:nodeID[:permission|permission], ...
+//兼容旧配置trustnodeid，作为拥有全部权限的default节点
+func parseTrustNodes(trustNodeID, trustNodes string) ([]*TrustNode, error) {
+
+	nodes := make([]*TrustNode, 0)
+
+	if trustNodeID = strings.TrimSpace(trustNodeID); len(trustNodeID) > 0 {
+		nodes = append(nodes, &TrustNode{NodeID: trustNodeID, Name: "default", Permissions: []string{TrustNodePermissionAll}})
+	}
+
+	for _, entry := range strings.Split(trustNodes, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		if len(fields) < 2 || len(fields) > 3 || len(strings.TrimSpace(fields[1])) == 0 {
+			return nil, fmt.Errorf("invalid trust node: %s", entry)
+		}
+
+		node := &TrustNode{
+			Name:   strings.TrimSpace(fields[0]),
+			NodeID: strings.TrimSpace(fields[1]),
+		}
+		if len(fields) == 3 {
+			for _, p := range strings.Split(fields[2], "|") {
+				if p = strings.TrimSpace(p); len(p) > 0 {
+					node.Permissions = append(node.Permissions, p)
+				}
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+//loadTrustNodeFile 读取授信节点文件，内容为TrustNode的JSON数组
+func loadTrustNodeFile(path string) ([]*TrustNode, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*TrustNode, 0)
+	err = json.Unmarshal(data, &nodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust node file %s: %v", path, err)
+	}
+
+	for _, n := range nodes {
+		if len(n.NodeID) == 0 {
+			return nil, fmt.Errorf("invalid trust node file %s: node %s has no node id", path, n.Name)
+		}
+	}
+
+	return nodes, nil
+}
+
+//TrustNodeList 授信节点列表，合并配置文件和授信节点文件中的节点。
+//授信节点文件修改后，下次检查时重新加载，用于新增节点或轮换密钥时新旧节点同时授信
+type TrustNodeList struct {
+	mu          sync.RWMutex
+	static      []*TrustNode          //配置文件中的节点
+	nodes       map[string]*TrustNode //当前的授信节点，key为节点ID
+	file        string                //授信节点文件
+	modTime     time.Time             //已加载的文件修改时间
+	checkedAt   time.Time             //上次检查文件的时间
+	checkPeriod time.Duration
+}
+
+//NewTrustNodeList 创建授信节点列表，file为空时不使用授信节点文件
+func NewTrustNodeList(static []*TrustNode, file string) (*TrustNodeList, error) {
+
+	list := &TrustNodeList{
+		static:      static,
+		file:        file,
+		checkPeriod: DefaultTrustNodeReloadPeriod,
+	}
+
+	err := list.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//Reload 重新加载授信节点文件，加载失败时保留原有的授信节点
+func (list *TrustNodeList) Reload() error {
+
+	var (
+		fileNodes []*TrustNode
+		modTime   time.Time
+	)
+
+	if len(list.file) > 0 {
+		info, err := os.Stat(list.file)
+		if err != nil {
+			return err
+		}
+		fileNodes, err = loadTrustNodeFile(list.file)
+		if err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+	}
+
+	nodes := make(map[string]*TrustNode)
+	for _, n := range list.static {
+		nodes[n.NodeID] = n
+	}
+	for _, n := range fileNodes {
+		nodes[n.NodeID] = n
+	}
+
+	list.mu.Lock()
+	list.nodes = nodes
+	list.modTime = modTime
+	list.checkedAt = time.Now()
+	list.mu.Unlock()
+
+	return nil
+}
+
+//Enabled 是否配置了授信节点，未配置时任何节点都可以连接
+func (list *TrustNodeList) Enabled() bool {
+	return len(list.static) > 0 || len(list.file) > 0
+}
+
+//Lookup 查找授信节点
+func (list *TrustNodeList) Lookup(nodeID string) (*TrustNode, bool) {
+
+	list.reloadIfChanged()
+
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	node, ok := list.nodes[nodeID]
+	return node, ok
+}
+
+//Nodes 当前的授信节点
+func (list *TrustNodeList) Nodes() []*TrustNode {
+
+	list.reloadIfChanged()
+
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	nodes := make([]*TrustNode, 0, len(list.nodes))
+	for _, n := range list.nodes {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+//reloadIfChanged 按检查周期检查授信节点文件，文件修改后重新加载
+func (list *TrustNodeList) reloadIfChanged() {
+
+	if len(list.file) == 0 {
+		return
+	}
+
+	list.mu.Lock()
+	if time.Since(list.checkedAt) < list.checkPeriod {
+		list.mu.Unlock()
+		return
+	}
+	list.checkedAt = time.Now()
+	modTime := list.modTime
+	list.mu.Unlock()
+
+	info, err := os.Stat(list.file)
+	if err != nil {
+		log.Std.Error("check trust node file failed unexpected error: %v", err)
+		return
+	}
+
+	if info.ModTime().Equal(modTime) {
+		return
+	}
+
+	err = list.Reload()
+	if err != nil {
+		log.Std.Error("reload trust node file failed unexpected error: %v", err)
+		return
+	}
+
+	log.Std.Info("trust node file %s is reloaded", list.file)
+}
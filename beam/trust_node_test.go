@@ -0,0 +1,209 @@
+package beam
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/owtp"
+)
+
+func TestParseTrustNodes(t *testing.T) {
+	nodes, err := parseTrustNodes("11111", "finance:22222:*, auditor:33333:getWalletBalance|getTransaction, guest:44444")
+	if err != nil {
+		t.Fatalf("parseTrustNodes failed unexpected error: %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("parseTrustNodes = %d nodes, want 4", len(nodes))
+	}
+	if nodes[0].NodeID != "11111" || nodes[0].Name != "default" || !nodes[0].HasPermission("createBatchAddress") {
+		t.Errorf("legacy trust node = %+v", nodes[0])
+	}
+	if nodes[1].NodeID != "22222" || nodes[1].Name != "finance" || !nodes[1].HasPermission("createBatchAddress") {
+		t.Errorf("finance trust node = %+v", nodes[1])
+	}
+	if nodes[2].Name != "auditor" || !nodes[2].HasPermission("getTransaction") || nodes[2].HasPermission("createBatchAddress") {
+		t.Errorf("auditor trust node = %+v", nodes[2])
+	}
+	//不填权限时没有任何权限
+	if nodes[3].Name != "guest" || nodes[3].HasPermission("getWalletBalance") || nodes[3].HasPermission(TrustNodePermissionAll) {
+		t.Errorf("guest trust node = %+v", nodes[3])
+	}
+
+	if nodes, err = parseTrustNodes("", ""); err != nil || len(nodes) != 0 {
+		t.Errorf("parseTrustNodes empty = %v, %v", nodes, err)
+	}
+	for _, invalid := range []string{"finance", "finance:", "a:b:c:d"} {
+		if _, err = parseTrustNodes("", invalid); err == nil {
+			t.Errorf("parseTrustNodes(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestTrustNodeList_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "trustnodes.json")
+	writeTrustNodeFile(t, file, `[{"nodeID": "old", "name": "finance"}]`)
+
+	list, err := NewTrustNodeList([]*TrustNode{{NodeID: "static", Name: "default"}}, file)
+	if err != nil {
+		t.Fatalf("NewTrustNodeList failed unexpected error: %v", err)
+	}
+	list.checkPeriod = 0
+
+	if _, ok := list.Lookup("static"); !ok {
+		t.Errorf("static node should be trusted")
+	}
+	if node, ok := list.Lookup("old"); !ok || node.Name != "finance" {
+		t.Errorf("Lookup old = %+v, %v", node, ok)
+	}
+
+	//轮换密钥，新旧节点同时授信
+	writeTrustNodeFile(t, file, `[{"nodeID": "old", "name": "finance"}, {"nodeID": "new", "name": "finance"}]`)
+	if _, ok := list.Lookup("new"); !ok {
+		t.Errorf("new node should be trusted after the file is modified")
+	}
+	if len(list.Nodes()) != 3 {
+		t.Errorf("Nodes = %d, want 3", len(list.Nodes()))
+	}
+
+	//文件格式错误时保留原有的授信节点
+	writeTrustNodeFile(t, file, `not json`)
+	if _, ok := list.Lookup("old"); !ok {
+		t.Errorf("old node should still be trusted when the file is invalid")
+	}
+	if err = list.Reload(); err == nil {
+		t.Errorf("Reload invalid file should fail")
+	}
+
+	writeTrustNodeFile(t, file, `[{"nodeID": "new", "name": "finance"}]`)
+	if _, ok := list.Lookup("old"); ok {
+		t.Errorf("old node should not be trusted after removed")
+	}
+
+	if _, err = NewTrustNodeList(nil, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("NewTrustNodeList with missing file should fail")
+	}
+	writeTrustNodeFile(t, file, `[{"name": "finance"}]`)
+	if _, err = NewTrustNodeList(nil, file); err == nil {
+		t.Errorf("NewTrustNodeList with node without id should fail")
+	}
+}
+
+func TestServer_checkTrustNode(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+	if err = server.checkTrustNode(owtp.NewContext(1, 1, "anyone", "createBatchAddress", nil), testServerRoute(t, server, "createBatchAddress")); err != nil {
+		t.Errorf("any node should be trusted without trust nodes, got %v", err)
+	}
+
+	wm.Config.trustnodes, _ = parseTrustNodes("", "finance:22222:*, auditor:33333:read, issuer:44444:address, legacy:55555:getWalletBalance, guest:77777")
+	server.Close()
+	server, err = NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		nodeID  string
+		method  string
+		allowed bool
+	}{
+		{"22222", "createBatchAddress", true},
+		{"22222", "getWalletBalance", true},
+		{"33333", "getWalletBalance", true},
+		{"33333", "queryTransactions", true},
+		{"33333", "newNodeJoin", true},
+		{"33333", "createBatchAddress", false},
+		{"33333", "allocateAccountAddress", false},
+		{"44444", "createBatchAddress", true},
+		{"44444", "createAccountAddress", true},
+		{"44444", "getWalletBalance", false},
+		{"55555", "getWalletBalance", true},
+		{"55555", "getTransaction", false},
+		{"77777", "getWalletBalance", false},
+		{"77777", "newNodeJoin", true},
+		{"66666", "getWalletBalance", false},
+		{"66666", "newNodeJoin", false},
+	}
+	for _, tt := range tests {
+		err = server.checkTrustNode(owtp.NewContext(1, 1, tt.nodeID, tt.method, nil), testServerRoute(t, server, tt.method))
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkTrustNode(%s, %s) = %v, allowed = %v", tt.nodeID, tt.method, err, tt.allowed)
+		}
+	}
+
+	//没有权限时不执行路由方法
+	called := false
+	handler := server.authorize(serverRoute{
+		Method:     "createBatchAddress",
+		Capability: CapabilityAddress,
+		Handler:    func(ctx *owtp.Context) { called = true },
+	})
+	ctx := owtp.NewContext(1, 1, "33333", "createBatchAddress", nil)
+	handler(ctx)
+	if called || ctx.Resp.Status != owtp.ErrDenialOfService {
+		t.Errorf("authorize should deny the call, response = %+v", ctx.Resp)
+	}
+	handler(owtp.NewContext(1, 2, "44444", "createBatchAddress", nil))
+	if !called {
+		t.Errorf("authorize should call the handler")
+	}
+}
+
+func TestServer_routes(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	server, err := NewServer(wm)
+	if err != nil {
+		t.Fatalf("NewServer failed unexpected error: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	//除加入节点外，每个方法都需要声明权限
+	seen := make(map[string]bool)
+	for _, route := range server.routes() {
+		if seen[route.Method] {
+			t.Errorf("route %s is registered twice", route.Method)
+		}
+		seen[route.Method] = true
+		if route.Handler == nil {
+			t.Errorf("route %s has no handler", route.Method)
+		}
+		if route.Method != "newNodeJoin" && len(route.Capability) == 0 {
+			t.Errorf("route %s has no capability", route.Method)
+		}
+	}
+}
+
+//testServerRoute 查找服务端的路由
+func testServerRoute(t *testing.T, server *Server, method string) serverRoute {
+	for _, route := range server.routes() {
+		if route.Method == method {
+			return route
+		}
+	}
+	t.Fatalf("route %s is not found", method)
+	return serverRoute{}
+}
+
+//writeTrustNodeFile 写入授信节点文件，修改时间晚于原文件确保重新加载
+func writeTrustNodeFile(t *testing.T, file, content string) {
+	modTime := time.Now()
+	if info, err := os.Stat(file); err == nil && !info.ModTime().Before(modTime) {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("write trust node file failed unexpected error: %v", err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatalf("change trust node file time failed unexpected error: %v", err)
+	}
+}
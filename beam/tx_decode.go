@@ -6,6 +6,8 @@ import (
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
 	"math/big"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -14,6 +16,15 @@ type TransactionDecoder struct {
 	wm *WalletManager //钱包管理者
 }
 
+//payout 交易单中的一个接收者
+type payout struct {
+	to     string
+	amount string //接收数量
+	value  uint64 //接收数量，最小单位
+	result *PayoutResult
+	record *WithdrawalRecord //已存在的提现记录
+}
+
 //NewTransactionDecoder 交易单解析器
 func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 	decoder := TransactionDecoder{}
@@ -25,69 +36,123 @@ func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
 	var (
-		to      string
-		amount  string
-		txFrom  []string
-		txTo    []string
-		fixFees *big.Int
+		txFrom []string
+		txTo   []string
 	)
 
-	for k, v := range rawTx.To {
-		to = k
-		amount = v
+	from, payouts, fixFees, err := decoder.preparePayouts(rawTx)
+	if err != nil {
+		return err
+	}
+
+	err = decoder.checkPayoutsBalance(payouts, fixFees)
+	if err != nil {
+		return err
 	}
 
-	amountDec, _ := decimal.NewFromString(amount)
-	amountDec = amountDec.Shift(decoder.wm.Decimal())
+	for _, p := range payouts {
+		txFrom = append(txFrom, fmt.Sprintf("%s:%s", from, p.amount))
+		txTo = append(txTo, fmt.Sprintf("%s:%s", p.to, p.amount))
+	}
+
+	rawTx.IsBuilt = true
+	rawTx.TxFrom = txFrom
+	rawTx.TxTo = txTo
+
+	return nil
+
+}
+
+//preparePayouts 解析交易单所有接收者，每个接收者独立一笔交易
+func (decoder *TransactionDecoder) preparePayouts(rawTx *openwallet.RawTransaction) (string, []*payout, *big.Int, error) {
+
+	var (
+		fixFees  *big.Int
+		decimals = decoder.wm.Decimal()
+		payouts  = make([]*payout, 0, len(rawTx.To))
+	)
+
+	if len(rawTx.To) == 0 {
+		return "", nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction has no receiver")
+	}
+
+	addressDecoder, _ := decoder.wm.Decoder.(*AddressDecoder)
+
+	for to, amount := range rawTx.To {
+		if addressDecoder != nil {
+			if err := addressDecoder.ValidateAddress(to); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		amountDec, err := decimal.NewFromString(amount)
+		if err != nil {
+			return "", nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount %s of %s", amount, to)
+		}
+		amountDec = amountDec.Shift(decimals)
+		if amountDec.Sign() <= 0 {
+			return "", nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount of %s must be greater than 0", to)
+		}
+		payouts = append(payouts, &payout{
+			to:     to,
+			amount: amount,
+			value:  uint64(amountDec.IntPart()),
+		})
+	}
+
+	//按地址排序，保证发送顺序稳定
+	sort.Slice(payouts, func(i, j int) bool {
+		return payouts[i].to < payouts[j].to
+	})
 
 	//取一个地址作为发送
-	addresses, err := decoder.wm.walletClient.GetAddressList()
+	addresses, err := decoder.wm.walletClient.GetAddressList(decoder.wm.context())
 	if err != nil {
-		return err
+		return "", nil, nil, OpenwalletError(err, openwallet.ErrCreateRawTransactionFailed)
 	}
 
 	if addresses == nil || len(addresses) == 0 {
-		return openwallet.Errorf(openwallet.ErrAccountNotAddress, "wallet address is not created")
+		return "", nil, nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "wallet address is not created")
 	}
 
 	from := addresses[0]
 
 	if len(rawTx.FeeRate) > 0 {
-		fixFees = common.StringNumToBigIntWithExp(rawTx.FeeRate, decoder.wm.Decimal())
-		rawTx.Fees = rawTx.FeeRate
+		fixFees = common.StringNumToBigIntWithExp(rawTx.FeeRate, decimals)
 	} else {
-		fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.fixfees, decoder.wm.Decimal())
+		fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.fixfees, decimals)
 		rawTx.FeeRate = decoder.wm.Config.fixfees
-		rawTx.Fees = decoder.wm.Config.fixfees
 	}
 
 	if fixFees.Cmp(big.NewInt(0)) <= 0 {
-		return openwallet.Errorf(openwallet.ErrUnknownException, "fee is lower than 0")
+		return "", nil, nil, openwallet.Errorf(openwallet.ErrUnknownException, "fee is lower than 0")
 	}
 
-	walletStatus, err := decoder.wm.walletClient.GetWalletStatus()
-	if err != nil {
-		return err
+	//每个接收者一笔交易，手续费累计
+	totalFees := new(big.Int).Mul(fixFees, big.NewInt(int64(len(payouts))))
+	rawTx.Fees = common.BigIntToDecimals(totalFees, decimals).String()
+
+	return from, payouts, fixFees, nil
+}
+
+//checkPayoutsBalance 检查钱包可用余额是否足够支付全部数量和每笔交易的手续费
+func (decoder *TransactionDecoder) checkPayoutsBalance(payouts []*payout, fixFees *big.Int) error {
+
+	total := uint64(0)
+	for _, p := range payouts {
+		total = total + p.value + fixFees.Uint64()
 	}
 
-	sendAmount := uint64(amountDec.IntPart())
+	walletStatus, err := decoder.wm.walletClient.GetWalletStatus(decoder.wm.context())
+	if err != nil {
+		return OpenwalletError(err, openwallet.ErrCreateRawTransactionFailed)
+	}
 
 	//判断钱包余额是否足够
-	if walletStatus.Available < sendAmount+fixFees.Uint64() {
+	if walletStatus.Available < total {
 		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "wallet available balance is not enough")
 	}
 
-	txFrom = []string{fmt.Sprintf("%s:%s", from, amount)}
-	txTo = []string{fmt.Sprintf("%s:%s", to, amount)}
-
-	rawTx.FeeRate = decoder.wm.Config.fixfees
-	rawTx.Fees = decoder.wm.Config.fixfees
-	rawTx.IsBuilt = true
-	rawTx.TxFrom = txFrom
-	rawTx.TxTo = txTo
-
 	return nil
-
 }
 
 //SignRawTransaction 签名交易单
@@ -106,89 +171,215 @@ func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.Walle
 }
 
 //SendRawTransaction 广播交易单
+//多个接收者时，每个接收者独立发送一笔交易，返回的交易单TxID为所有成功交易的txid，以逗号分隔，
+//ExtParam的payouts记录每个接收者的txid和失败原因
 func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) (*openwallet.Transaction, error) {
 
+	results, err := decoder.SubmitBatchRawTransaction(wrapper, rawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 1 {
+		if results[0].Err != nil {
+			return nil, results[0].Err
+		}
+		return results[0].Transaction, nil
+	}
+
 	var (
-		to      string
-		amount  string
-		fixFees *big.Int
+		txids    = make([]string, 0)
+		txTo     = make([]string, 0)
+		failures = make([]string, 0)
+		amount   = decimal.Zero
+		fees     = decimal.Zero
+		from     string
 	)
 
-	for k, v := range rawTx.To {
-		to = k
-		amount = v
+	for _, r := range results {
+		if r.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", r.Address, r.Reason))
+			continue
+		}
+		amountDec, _ := decimal.NewFromString(r.Amount)
+		feesDec, _ := decimal.NewFromString(r.Fees)
+		amount = amount.Add(amountDec)
+		fees = fees.Add(feesDec)
+		txids = append(txids, r.TxID)
+		txTo = append(txTo, fmt.Sprintf("%s:%s", r.Address, r.Amount))
+		from = r.From
 	}
 
-	amountDec, _ := decimal.NewFromString(amount)
-	amountDec = amountDec.Shift(decoder.wm.Decimal())
-
-	//取一个地址作为发送
-	addresses, err := decoder.wm.walletClient.GetAddressList()
-	if err != nil {
-		return nil, err
+	if len(txids) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "all payouts failed, %s", strings.Join(failures, "; "))
 	}
 
-	if addresses == nil || len(addresses) == 0 {
-		return nil, fmt.Errorf("wallet address is not created")
+	//记录一个批量交易单
+	tx := &openwallet.Transaction{
+		From:       []string{fmt.Sprintf("%s:%s", from, amount.String())},
+		To:         txTo,
+		Amount:     amount.String(),
+		Coin:       rawTx.Coin,
+		TxID:       rawTx.TxID,
+		Decimal:    decoder.wm.Decimal(),
+		Fees:       fees.String(),
+		SubmitTime: time.Now().Unix(),
 	}
 
-	from := addresses[0]
+	tx.SetExtParam("payouts", results)
+	tx.WxID = openwallet.GenTransactionWxID(tx)
 
-	if len(rawTx.FeeRate) > 0 {
-		fixFees = common.StringNumToBigIntWithExp(rawTx.FeeRate, decoder.wm.Decimal())
-		rawTx.Fees = rawTx.FeeRate
-	} else {
-		fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.fixfees, decoder.wm.Decimal())
-		rawTx.FeeRate = decoder.wm.Config.fixfees
-		rawTx.Fees = decoder.wm.Config.fixfees
+	if len(failures) > 0 {
+		decoder.wm.Log.Warningf("Batch payout partially failed: %s", strings.Join(failures, "; "))
 	}
 
-	if fixFees.Cmp(big.NewInt(0)) <= 0 {
-		return nil, openwallet.Errorf(openwallet.ErrUnknownException, "fee is lower than 0")
-	}
+	return tx, nil
+}
 
-	walletStatus, err := decoder.wm.walletClient.GetWalletStatus()
+//SubmitBatchRawTransaction 批量付款，交易单中每个接收者独立发送一笔交易，
+//发送前先检查钱包余额是否足够支付全部数量和手续费，返回每个接收者的发送结果。
+//rawTx.Sid作为幂等键，每笔付款都记录到本地提现账本，已提交或已完成的付款不会重复发送
+func (decoder *TransactionDecoder) SubmitBatchRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]*PayoutResult, error) {
+
+	from, payouts, fixFees, err := decoder.preparePayouts(rawTx)
 	if err != nil {
 		return nil, err
 	}
 
-	sendAmount := uint64(amountDec.IntPart())
+	var (
+		decimals = decoder.wm.Decimal()
+		fees     = common.BigIntToDecimals(fixFees, decimals).String()
+		results  = make([]*PayoutResult, 0, len(payouts))
+		pending  = make([]*payout, 0, len(payouts))
+		txids    = make([]string, 0, len(payouts))
+	)
+
+	for _, p := range payouts {
 
-	//判断钱包余额是否足够
-	if walletStatus.Available < sendAmount+fixFees.Uint64() {
-		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "wallet available balance is not enough")
+		result := &PayoutResult{
+			From:    from,
+			Address: p.to,
+			Amount:  p.amount,
+			Fees:    fees,
+		}
+		results = append(results, result)
+		p.result = result
+
+		//检查幂等键并记录为发送中，在调用钱包API前完成，拒绝重复付款
+		record, claimed, claimErr := decoder.wm.ClaimWithdrawal(rawTx.Sid, p.to, p.amount, fees)
+		if claimErr != nil {
+			//无法确认是否已付款，不能发送
+			decoder.releasePayouts(pending, claimErr.Error())
+			return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed,
+				"claim withdrawal [%s] to %s failed, unexpected error: %v", rawTx.Sid, p.to, claimErr)
+		}
+		if !claimed {
+			result.TxID = record.TxID
+			result.Err = openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed,
+				"withdrawal [%s] to %s is already %s, txid: %s", rawTx.Sid, p.to, record.Status, record.TxID)
+			result.Reason = result.Err.Error()
+			decoder.wm.Log.Warningf("Refuse duplicated withdrawal: %s", result.Reason)
+			continue
+		}
+		p.record = record
+
+		pending = append(pending, p)
 	}
 
-	txid, err := decoder.wm.walletClient.SendTransaction(from, to, sendAmount, fixFees.Uint64(), "")
+	err = decoder.checkPayoutsBalance(pending, fixFees)
 	if err != nil {
+		decoder.releasePayouts(pending, err.Error())
 		return nil, err
 	}
 
-	decoder.wm.Log.Infof("Transaction [%s] submitted to the network successfully.", txid)
+	for _, p := range pending {
 
-	rawTx.TxID = txid
-	rawTx.IsSubmit = true
+		result := p.result
 
-	txFrom := []string{fmt.Sprintf("%s:%s", from, amount)}
-	txTo := []string{fmt.Sprintf("%s:%s", to, amount)}
+		//预先生成交易单号，发送结果未知时可以按交易单号向钱包核对
+		txid, genErr := decoder.wm.walletClient.GenerateTxID(decoder.wm.context())
+		if genErr != nil {
+			genErr = OpenwalletError(genErr, openwallet.ErrSubmitRawTransactionFailed)
+			decoder.wm.Log.Errorf("Transaction to [%s] generate txid failed, unexpected error: %v", p.to, genErr)
+			result.Err = genErr
+			result.Reason = genErr.Error()
+			decoder.releasePayouts([]*payout{p}, genErr.Error())
+			continue
+		}
 
-	decimals := decoder.wm.Decimal()
+		//发送前先记录交易单号，发送中途异常退出也不会重复付款
+		record := p.record
+		record.TxID = txid
+		if saveErr := decoder.wm.SaveWithdrawal(record); saveErr != nil {
+			result.Err = saveErr
+			result.Reason = saveErr.Error()
+			continue
+		}
 
-	//记录一个交易单
-	tx := &openwallet.Transaction{
-		From:       txFrom,
-		To:         txTo,
-		Amount:     amount,
-		Coin:       rawTx.Coin,
-		TxID:       rawTx.TxID,
-		Decimal:    decimals,
-		Fees:       rawTx.Fees,
-		SubmitTime: time.Now().Unix(),
+		txid, sendErr := decoder.wm.walletClient.SendTransactionWithTxID(decoder.wm.context(), from, p.to, p.value, fixFees.Uint64(), "", txid)
+		if sendErr != nil {
+			unknown := IsUnavailable(sendErr)
+			sendErr = OpenwalletError(sendErr, openwallet.ErrSubmitRawTransactionFailed)
+			decoder.wm.Log.Errorf("Transaction to [%s] submitted failed, unexpected error: %v", p.to, sendErr)
+			result.TxID = record.TxID
+			result.Err = sendErr
+			result.Reason = sendErr.Error()
+			if unknown {
+				//请求可能已到达钱包，保持发送中不允许重试，由交易跟踪按交易单号向钱包核对
+				record.SetStatus(WithdrawalStatusSubmitting, sendErr.Error())
+			} else {
+				record.SetStatus(WithdrawalStatusFailed, sendErr.Error())
+			}
+			decoder.wm.SaveWithdrawal(record)
+			continue
+		}
+
+		decoder.wm.Log.Infof("Transaction [%s] submitted to the network successfully.", txid)
+
+		record.TxID = txid
+		record.SetStatus(WithdrawalStatusSubmitted, "")
+		if saveErr := decoder.wm.SaveWithdrawal(record); saveErr != nil {
+			decoder.wm.Log.Errorf("Withdrawal [%s] save failed, unexpected error: %v", txid, saveErr)
+		}
+
+		//记录一个交易单
+		tx := &openwallet.Transaction{
+			From:       []string{fmt.Sprintf("%s:%s", from, p.amount)},
+			To:         []string{fmt.Sprintf("%s:%s", p.to, p.amount)},
+			Amount:     p.amount,
+			Coin:       rawTx.Coin,
+			TxID:       txid,
+			Decimal:    decimals,
+			Fees:       fees,
+			SubmitTime: time.Now().Unix(),
+		}
+
+		tx.WxID = openwallet.GenTransactionWxID(tx)
+
+		result.TxID = txid
+		result.Transaction = tx
+		txids = append(txids, txid)
 	}
 
-	tx.WxID = openwallet.GenTransactionWxID(tx)
+	if len(txids) > 0 {
+		rawTx.TxID = strings.Join(txids, ",")
+		rawTx.IsSubmit = true
+	}
 
-	return tx, nil
+	return results, nil
+}
+
+//releasePayouts 付款未发送到钱包，把已记录为发送中的提现标记为失败，可以用相同的幂等键重试
+func (decoder *TransactionDecoder) releasePayouts(payouts []*payout, reason string) {
+	for _, p := range payouts {
+		if p.record == nil {
+			continue
+		}
+		p.record.SetStatus(WithdrawalStatusFailed, reason)
+		if err := decoder.wm.SaveWithdrawal(p.record); err != nil {
+			decoder.wm.Log.Errorf("Withdrawal [%s] to %s save failed, unexpected error: %v", p.record.Key, p.to, err)
+		}
+	}
 }
 
 //GetRawTransactionFeeRate 获取交易单的费率
@@ -242,9 +433,9 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithError(wrapper
 		return nil, openwallet.Errorf(openwallet.ErrUnknownException, "fee is lower than 0")
 	}
 
-	walletStatus, err := decoder.wm.walletClient.GetWalletStatus()
+	walletStatus, err := decoder.wm.walletClient.GetWalletStatus(decoder.wm.context())
 	if err != nil {
-		return nil, err
+		return nil, OpenwalletError(err, openwallet.ErrCreateRawTransactionFailed)
 	}
 
 	//检查余额是否超过最低转账
@@ -0,0 +1,381 @@
+package beam
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestTransactionDecoder_SubmitRawTransaction(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		To: map[string]string{
+			testReceiver: "0.5",
+		},
+	}
+
+	tx, err := wm.TxDecoder.SubmitRawTransaction(nil, rawTx)
+	if err != nil {
+		t.Fatalf("SubmitRawTransaction failed unexpected error: %v", err)
+	}
+
+	sent := srv.SentTransactions()
+	if len(sent) != 1 || sent[0].Address != testReceiver || sent[0].Value != 50000000 {
+		t.Fatalf("sent = %+v", sent)
+	}
+	if tx.TxID != sent[0].TxID || rawTx.TxID != sent[0].TxID || !rawTx.IsSubmit {
+		t.Errorf("submitted tx = %+v", tx)
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_InsufficientBalance(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100})
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		To: map[string]string{
+			testReceiver: "0.5",
+		},
+	}
+
+	_, err := wm.TxDecoder.SubmitRawTransaction(nil, rawTx)
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrInsufficientBalanceOfAccount {
+		t.Errorf("SubmitRawTransaction error = %v, want insufficient balance", err)
+	}
+	if len(srv.SentTransactions()) != 0 {
+		t.Errorf("no tx should be sent")
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_InvalidAddress(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+	srv.FailRPC("tx_send", beamtest.ErrCodeInvalidAddress, "Invalid address.", 1)
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		To: map[string]string{
+			testReceiver: "0.5",
+		},
+	}
+
+	_, err := wm.TxDecoder.SubmitRawTransaction(nil, rawTx)
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrAdressDecodeFailed {
+		t.Errorf("SubmitRawTransaction error = %v, want address decode failed", err)
+	}
+}
+
+func TestTransactionDecoder_CreateRawTransaction_InvalidAddress(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	for _, addr := range []string{"bad-address", testReceiver[:63], testReceiver + "0123g", "z" + testReceiver[1:]} {
+		rawTx := &openwallet.RawTransaction{
+			Coin: openwallet.Coin{Symbol: "BEAM"},
+			To: map[string]string{
+				addr: "0.5",
+			},
+		}
+
+		err := wm.TxDecoder.CreateRawTransaction(nil, rawTx)
+		if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrAdressDecodeFailed {
+			t.Errorf("CreateRawTransaction(%s) error = %v, want address decode failed", addr, err)
+		}
+		if _, err = wm.TxDecoder.SubmitRawTransaction(nil, rawTx); err == nil {
+			t.Errorf("SubmitRawTransaction(%s) should fail", addr)
+		}
+	}
+
+	if n := srv.Calls("tx_send"); n != 0 {
+		t.Errorf("tx_send calls = %d, want 0", n)
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_MultiRecipients(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		To: map[string]string{
+			testReceiverA: "0.1",
+			testReceiverB: "0.2",
+			testReceiverC: "0.3",
+		},
+	}
+
+	//第一笔发送失败，其余继续发送
+	srv.FailRPC("tx_send", -32603, "Internal JSON-RPC error.", 1)
+
+	tx, err := wm.TxDecoder.SubmitRawTransaction(nil, rawTx)
+	if err != nil {
+		t.Fatalf("SubmitRawTransaction failed unexpected error: %v", err)
+	}
+
+	sent := srv.SentTransactions()
+	if len(sent) != 2 || sent[0].Address != testReceiverB || sent[1].Address != testReceiverC {
+		t.Fatalf("sent = %+v", sent)
+	}
+
+	if tx.TxID != sent[0].TxID+","+sent[1].TxID || rawTx.TxID != tx.TxID {
+		t.Errorf("batch txid = %s", tx.TxID)
+	}
+	if tx.Amount != "0.5" || tx.Fees != "0.00000002" || len(tx.To) != 2 {
+		t.Errorf("batch tx = %+v", tx)
+	}
+
+	var ext map[string][]*PayoutResult
+	if err = json.Unmarshal([]byte(tx.ExtParam), &ext); err != nil {
+		t.Fatalf("decode ExtParam failed unexpected error: %v", err)
+	}
+	payouts := ext["payouts"]
+	if len(payouts) != 3 || len(payouts[0].Reason) == 0 || payouts[1].TxID != sent[0].TxID {
+		t.Errorf("payouts = %s", tx.ExtParam)
+	}
+}
+
+func TestTransactionDecoder_SubmitBatchRawTransaction_InsufficientBalance(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	//足够单笔，不够全部数量加手续费
+	srv.SetBalance(beamtest.WalletBalance{Available: 20000001})
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		To: map[string]string{
+			testReceiverA: "0.1",
+			testReceiverB: "0.1",
+		},
+	}
+
+	_, err := wm.TxDecoder.(*TransactionDecoder).SubmitBatchRawTransaction(nil, rawTx)
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrInsufficientBalanceOfAccount {
+		t.Errorf("SubmitBatchRawTransaction error = %v, want insufficient balance", err)
+	}
+	if len(srv.SentTransactions()) != 0 {
+		t.Errorf("no tx should be sent")
+	}
+}
+
+func TestTransactionDecoder_CreateRawTransaction_MultiRecipients(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		To: map[string]string{
+			testReceiverB: "0.2",
+			testReceiverA: "0.1",
+		},
+	}
+
+	if err := wm.TxDecoder.CreateRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+
+	if len(rawTx.TxTo) != 2 || rawTx.TxTo[0] != testReceiverA+":0.1" || rawTx.TxTo[1] != testReceiverB+":0.2" {
+		t.Errorf("TxTo = %v", rawTx.TxTo)
+	}
+	if rawTx.Fees != "0.00000002" || !rawTx.IsBuilt {
+		t.Errorf("rawTx = %+v", rawTx)
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_Idempotency(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	newRawTx := func() *openwallet.RawTransaction {
+		return &openwallet.RawTransaction{
+			Coin: openwallet.Coin{Symbol: "BEAM"},
+			Sid:  "order-1",
+			To: map[string]string{
+				testReceiver: "0.1",
+			},
+		}
+	}
+
+	//第一次发送失败，可以用相同的幂等键重试
+	srv.FailRPC("tx_send", -32603, "Internal JSON-RPC error.", 1)
+	if _, err := wm.TxDecoder.SubmitRawTransaction(nil, newRawTx()); err == nil {
+		t.Fatalf("SubmitRawTransaction should fail")
+	}
+
+	tx, err := wm.TxDecoder.SubmitRawTransaction(nil, newRawTx())
+	if err != nil {
+		t.Fatalf("SubmitRawTransaction retry failed unexpected error: %v", err)
+	}
+
+	//已提交的付款不会重复发送
+	_, err = wm.TxDecoder.SubmitRawTransaction(nil, newRawTx())
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrSubmitRawTransactionFailed {
+		t.Errorf("SubmitRawTransaction duplicated error = %v", err)
+	}
+
+	if sent := srv.SentTransactions(); len(sent) != 1 || sent[0].TxID != tx.TxID {
+		t.Errorf("sent = %+v", sent)
+	}
+
+	record, err := wm.GetWithdrawal("order-1", testReceiver)
+	if err != nil {
+		t.Fatalf("GetWithdrawal failed unexpected error: %v", err)
+	}
+	if record.TxID != tx.TxID || record.Status != WithdrawalStatusSubmitted || record.Fees != "0.00000001" {
+		t.Errorf("withdrawal record = %+v", record)
+	}
+
+	//发送中、失败、发送中、已发送
+	if len(record.History) != 4 || record.History[0].Status != WithdrawalStatusSubmitting ||
+		record.History[1].Status != WithdrawalStatusFailed {
+		t.Errorf("withdrawal history = %+v", record.History)
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_ConcurrentDuplicates(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	//放慢余额检查，拉长检查幂等键到发送之间的时间
+	const submits = 5
+	srv.Delay("wallet_status", 100*time.Millisecond, submits)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		success int
+	)
+	for i := 0; i < submits; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := wm.TxDecoder.SubmitRawTransaction(nil, &openwallet.RawTransaction{
+				Coin: openwallet.Coin{Symbol: "BEAM"},
+				Sid:  "order-1",
+				To: map[string]string{
+					testReceiver: "0.1",
+				},
+			})
+			if err == nil {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if success != 1 {
+		t.Errorf("success = %d, want 1", success)
+	}
+	if sent := srv.SentTransactions(); len(sent) != 1 {
+		t.Errorf("sent = %+v", sent)
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_ReleaseOnInsufficientBalance(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 1000})
+
+	newRawTx := func() *openwallet.RawTransaction {
+		return &openwallet.RawTransaction{
+			Coin: openwallet.Coin{Symbol: "BEAM"},
+			Sid:  "order-1",
+			To: map[string]string{
+				testReceiver: "0.1",
+			},
+		}
+	}
+
+	//余额不足时没有发送，可以用相同的幂等键重试
+	if _, err := wm.TxDecoder.SubmitRawTransaction(nil, newRawTx()); err == nil {
+		t.Fatalf("SubmitRawTransaction should fail")
+	}
+
+	record, err := wm.GetWithdrawal("order-1", testReceiver)
+	if err != nil {
+		t.Fatalf("GetWithdrawal failed unexpected error: %v", err)
+	}
+	if record.Status != WithdrawalStatusFailed || len(record.TxID) > 0 {
+		t.Errorf("withdrawal record = %+v", record)
+	}
+
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+	if _, err := wm.TxDecoder.SubmitRawTransaction(nil, newRawTx()); err != nil {
+		t.Fatalf("SubmitRawTransaction retry failed unexpected error: %v", err)
+	}
+	if sent := srv.SentTransactions(); len(sent) != 1 {
+		t.Errorf("sent = %+v", sent)
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_UnknownOutcome(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	newRawTx := func() *openwallet.RawTransaction {
+		return &openwallet.RawTransaction{
+			Coin: openwallet.Coin{Symbol: "BEAM"},
+			Sid:  "order-1",
+			To: map[string]string{
+				testReceiver: "0.1",
+			},
+		}
+	}
+
+	//钱包无响应时发送结果未知，保持发送中，不允许用相同的幂等键重试
+	srv.FailHTTP("tx_send", http.StatusBadGateway, 1)
+	if _, err := wm.TxDecoder.SubmitRawTransaction(nil, newRawTx()); err == nil {
+		t.Fatalf("SubmitRawTransaction should fail")
+	}
+
+	record, err := wm.GetWithdrawal("order-1", testReceiver)
+	if err != nil {
+		t.Fatalf("GetWithdrawal failed unexpected error: %v", err)
+	}
+	if record.Status != WithdrawalStatusSubmitting || record.Retryable() || len(record.TxID) == 0 {
+		t.Errorf("withdrawal record = %+v, want submitting with txid", record)
+	}
+
+	_, err = wm.TxDecoder.SubmitRawTransaction(nil, newRawTx())
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrSubmitRawTransactionFailed {
+		t.Errorf("SubmitRawTransaction retry error = %v, want refused", err)
+	}
+	if srv.Calls("tx_send") != 1 {
+		t.Errorf("tx_send calls = %d, want 1", srv.Calls("tx_send"))
+	}
+}
+
+func TestTransactionDecoder_SubmitRawTransaction_WithdrawalDBError(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+
+	//提现账本无法读取时不能确认是否已付款
+	wm.Config.WithdrawalFile = "withdrawal"
+	if err := os.Mkdir(filepath.Join(wm.Config.dbPath, wm.Config.WithdrawalFile), 0700); err != nil {
+		t.Fatalf("Mkdir failed unexpected error: %v", err)
+	}
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		Sid:  "order-1",
+		To: map[string]string{
+			testReceiver: "0.1",
+		},
+	}
+	if _, err := wm.TxDecoder.SubmitRawTransaction(nil, rawTx); err == nil {
+		t.Errorf("SubmitRawTransaction should fail")
+	}
+	if srv.Calls("tx_send") != 0 {
+		t.Errorf("tx_send calls = %d, want 0", srv.Calls("tx_send"))
+	}
+}
@@ -0,0 +1,238 @@
+package beam
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	//交易方向
+	TxDirectionIncome   = "income"   //收款
+	TxDirectionOutgoing = "outgoing" //付款
+
+	//交易历史每页默认数量和最大数量
+	DefaultTxQueryLimit = 100
+	MaxTxQueryLimit     = 1000
+)
+
+var (
+	//每次向钱包请求tx_list的数量
+	txQueryBatchSize uint64 = 200
+
+	//每页最多向钱包请求tx_list的次数
+	txQueryMaxBatches = 10
+)
+
+//TxQuery 交易历史查询条件，所有条件同时满足，新的交易排在前面
+type TxQuery struct {
+	FromHeight uint64 `json:"fromHeight"` //起始区块高度（含），0不限制
+	ToHeight   uint64 `json:"toHeight"`   //结束区块高度（含），0不限制，指定高度范围时不返回未上链的交易
+	Status     []int  `json:"status"`     //交易状态，为空不过滤
+	Direction  string `json:"direction"`  //交易方向：income，outgoing，为空不过滤
+	Address    string `json:"address"`    //发送或接收地址，为空不过滤
+	Cursor     string `json:"cursor"`     //上一页返回的NextCursor，为空从第一页开始，只能用于相同的查询条件
+	Limit      uint64 `json:"limit"`      //每页数量，0为DefaultTxQueryLimit
+}
+
+//TxQueryResult 交易历史查询结果
+type TxQueryResult struct {
+	Transactions []*Transaction `json:"transactions"`
+	NextCursor   string         `json:"nextCursor"` //下一页游标，为空时没有更多记录
+}
+
+//txQueryCursor 分页游标，记录上一页最后一条交易，以及它之后的交易在钱包tx_list中的位置
+type txQueryCursor struct {
+	offset uint64
+	lastTx string
+}
+
+func (c *txQueryCursor) String() string {
+	return fmt.Sprintf("%d_%s", c.offset, c.lastTx)
+}
+
+func parseTxQueryCursor(cursor string) (*txQueryCursor, error) {
+	if len(cursor) == 0 {
+		return &txQueryCursor{}, nil
+	}
+	parts := strings.SplitN(cursor, "_", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	offset, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || offset == 0 || len(parts[1]) == 0 {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	return &txQueryCursor{offset: offset, lastTx: parts[1]}, nil
+}
+
+//check 检查查询条件
+func (query *TxQuery) check() error {
+	if query.ToHeight > 0 && query.FromHeight > query.ToHeight {
+		return fmt.Errorf("fromHeight %d is greater than toHeight %d", query.FromHeight, query.ToHeight)
+	}
+	switch query.Direction {
+	case "", TxDirectionIncome, TxDirectionOutgoing:
+	default:
+		return fmt.Errorf("unknown direction: %s", query.Direction)
+	}
+	if query.Limit > MaxTxQueryLimit {
+		return fmt.Errorf("limit %d is greater than %d", query.Limit, MaxTxQueryLimit)
+	}
+	return nil
+}
+
+//walletFilter 可以交给钱包tx_list过滤的条件
+func (query *TxQuery) walletFilter() TxListFilter {
+	filter := TxListFilter{Status: TxStatusAny}
+	if len(query.Status) == 1 {
+		filter.Status = query.Status[0]
+	}
+	if query.FromHeight > 0 && query.FromHeight == query.ToHeight {
+		filter.Height = query.FromHeight
+	}
+	return filter
+}
+
+//match 交易是否满足查询条件
+func (query *TxQuery) match(tx *Transaction) bool {
+
+	if query.FromHeight > 0 || query.ToHeight > 0 {
+		if tx.BlockHeight == 0 || tx.BlockHeight < query.FromHeight {
+			return false
+		}
+		if query.ToHeight > 0 && tx.BlockHeight > query.ToHeight {
+			return false
+		}
+	}
+
+	if len(query.Status) > 0 {
+		found := false
+		for _, status := range query.Status {
+			if int64(status) == tx.Status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch query.Direction {
+	case TxDirectionIncome:
+		if !tx.Income {
+			return false
+		}
+	case TxDirectionOutgoing:
+		if tx.Income {
+			return false
+		}
+	}
+
+	if len(query.Address) > 0 && tx.Sender != query.Address && tx.Receiver != query.Address {
+		return false
+	}
+
+	return true
+}
+
+//QueryTransactions 分页查询本地钱包的交易历史。
+//钱包tx_list只支持单个状态和单个高度，其余条件在本地过滤，按批次向钱包请求直到凑满一页。
+//每页最多请求txQueryMaxBatches批，达到上限时返回已找到的交易和从下一批继续的游标，本页可能不足limit条。
+//翻页期间钱包新增的交易会使后面的交易后移，根据游标记录的最后一条交易去掉重复的记录
+func (wm *WalletManager) QueryTransactions(query *TxQuery) (*TxQueryResult, error) {
+
+	if query == nil {
+		query = &TxQuery{}
+	}
+
+	err := query.check()
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := parseTxQueryCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultTxQueryLimit
+	}
+
+	var (
+		filter     = query.walletFilter()
+		offset     = cursor.offset
+		lastOffset = uint64(0) //本页最后一条交易在tx_list中的位置
+		dedup      = len(cursor.lastTx) > 0
+		result     = &TxQueryResult{Transactions: make([]*Transaction, 0)}
+	)
+
+	//从上一页最后一条交易开始请求，用于检查交易位置是否变化
+	if dedup {
+		offset--
+	}
+
+	for batches := 1; ; batches++ {
+		filter.Skip = offset
+		filter.Count = txQueryBatchSize
+
+		txs, err := wm.walletClient.ListTransactions(wm.context(), filter)
+		if err != nil {
+			return nil, err
+		}
+
+		start := 0
+		if dedup {
+			for i, tx := range txs {
+				if tx.TxID == cursor.lastTx {
+					start = i + 1
+					break
+				}
+			}
+			dedup = false
+		}
+
+		for i := start; i < len(txs); i++ {
+			tx := txs[i]
+			if !query.match(tx) {
+				continue
+			}
+			if uint64(len(result.Transactions)) == limit {
+				//还有满足条件的交易，下一页从本页最后一条交易之后开始
+				next := &txQueryCursor{offset: lastOffset + 1, lastTx: result.Transactions[limit-1].TxID}
+				result.NextCursor = next.String()
+				return result, nil
+			}
+			result.Transactions = append(result.Transactions, tx)
+			lastOffset = offset + uint64(i)
+		}
+
+		if uint64(len(txs)) < txQueryBatchSize {
+			return result, nil
+		}
+		offset += uint64(len(txs))
+
+		if batches >= txQueryMaxBatches {
+			//本页请求次数已达上限，下一页从已检查的最后一条交易之后开始
+			next := &txQueryCursor{offset: offset, lastTx: txs[len(txs)-1].TxID}
+			result.NextCursor = next.String()
+			return result, nil
+		}
+	}
+}
+
+//QueryRemoteTransactions 分页查询服务端钱包的交易历史
+func (wm WalletManager) QueryRemoteTransactions(query *TxQuery) (*TxQueryResult, error) {
+	if wm.Config.enableserver {
+		return nil, fmt.Errorf("server mode can not query remote transactions, use query local transactions")
+	}
+
+	if wm.Config.enablesingle {
+		return wm.QueryTransactions(query)
+	}
+
+	return wm.client.QueryTransactions(query)
+}
@@ -0,0 +1,192 @@
+package beam
+
+import (
+	"testing"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+)
+
+//testQueryAll 按页查询全部交易
+func testQueryAll(t *testing.T, wm *WalletManager, query TxQuery) []*Transaction {
+	all := make([]*Transaction, 0)
+	for page := 0; ; page++ {
+		if page > 100 {
+			t.Fatalf("too many pages")
+		}
+		result, err := wm.QueryTransactions(&query)
+		if err != nil {
+			t.Fatalf("QueryTransactions failed unexpected error: %v", err)
+		}
+		if query.Limit > 0 && uint64(len(result.Transactions)) > query.Limit {
+			t.Fatalf("page size = %d, want <= %d", len(result.Transactions), query.Limit)
+		}
+		all = append(all, result.Transactions...)
+		if len(result.NextCursor) == 0 {
+			return all
+		}
+		query.Cursor = result.NextCursor
+	}
+}
+
+func TestWalletManager_QueryTransactions(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(10)
+
+	batchSize := txQueryBatchSize
+	txQueryBatchSize = 4
+	defer func() { txQueryBatchSize = batchSize }()
+
+	//高度i的交易创建时间更晚，偶数高度为收款
+	for i := 1; i <= 10; i++ {
+		tx := &beamtest.Tx{
+			Value:      uint64(i),
+			Height:     uint64(i),
+			Income:     i%2 == 0,
+			Sender:     testReceiverA,
+			Receiver:   testReceiverB,
+			CreateTime: int64(1000 + i),
+		}
+		if i%5 == 0 {
+			tx.Receiver = testReceiverC
+		}
+		srv.AddTransaction(tx)
+	}
+	srv.AddTransaction(&beamtest.Tx{Value: 11, Status: beamtest.TxStatusInProgress, Receiver: testReceiverC, CreateTime: 2000})
+	srv.AddTransaction(&beamtest.Tx{Value: 12, Status: beamtest.TxStatusFailed, Receiver: testReceiverC, CreateTime: 2001})
+
+	values := func(txs []*Transaction) []uint64 {
+		list := make([]uint64, 0, len(txs))
+		for _, tx := range txs {
+			list = append(list, tx.Value)
+		}
+		return list
+	}
+
+	tests := []struct {
+		name  string
+		query TxQuery
+		want  []uint64
+	}{
+		{"all", TxQuery{Limit: 5}, []uint64{12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1}},
+		{"height range", TxQuery{FromHeight: 3, ToHeight: 6, Limit: 3}, []uint64{6, 5, 4, 3}},
+		{"single height", TxQuery{FromHeight: 7, ToHeight: 7}, []uint64{7}},
+		{"from height", TxQuery{FromHeight: 9, Limit: 1}, []uint64{10, 9}},
+		{"status set", TxQuery{Status: []int{TxStatusInProgress, TxStatusFailed}, Limit: 1}, []uint64{12, 11}},
+		{"single status", TxQuery{Status: []int{TxStatusCompleted}, Limit: 4}, []uint64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}},
+		{"income", TxQuery{Direction: TxDirectionIncome, Limit: 2}, []uint64{10, 8, 6, 4, 2}},
+		{"outgoing in range", TxQuery{Direction: TxDirectionOutgoing, FromHeight: 2, ToHeight: 8}, []uint64{7, 5, 3}},
+		{"address", TxQuery{Address: testReceiverC, Limit: 2}, []uint64{12, 11, 10, 5}},
+		{"sender address", TxQuery{Address: testReceiverA, FromHeight: 9}, []uint64{10, 9}},
+		{"no match", TxQuery{Address: testReceiver}, []uint64{}},
+	}
+
+	for _, test := range tests {
+		got := values(testQueryAll(t, wm, test.query))
+		if len(got) != len(test.want) {
+			t.Errorf("%s: QueryTransactions = %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: QueryTransactions = %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWalletManager_QueryTransactions_NewTxBetweenPages(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(5)
+
+	for i := 1; i <= 5; i++ {
+		srv.AddTransaction(&beamtest.Tx{Value: uint64(i), Height: uint64(i), CreateTime: int64(1000 + i)})
+	}
+
+	first, err := wm.QueryTransactions(&TxQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("QueryTransactions failed unexpected error: %v", err)
+	}
+	if len(first.Transactions) != 2 || first.Transactions[0].Value != 5 || len(first.NextCursor) == 0 {
+		t.Fatalf("first page = %+v", first)
+	}
+
+	//翻页期间新增的交易排在最前面，不影响后面的页
+	srv.AddTransaction(&beamtest.Tx{Value: 6, Status: beamtest.TxStatusInProgress, CreateTime: 2000})
+	srv.AddTransaction(&beamtest.Tx{Value: 7, Status: beamtest.TxStatusInProgress, CreateTime: 2001})
+
+	second, err := wm.QueryTransactions(&TxQuery{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("QueryTransactions failed unexpected error: %v", err)
+	}
+	if len(second.Transactions) != 2 || second.Transactions[0].Value != 3 || second.Transactions[1].Value != 2 {
+		t.Errorf("second page = %+v", second.Transactions)
+	}
+}
+
+func TestWalletManager_QueryTransactions_MaxBatches(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.MineBlocks(10)
+
+	batchSize, maxBatches := txQueryBatchSize, txQueryMaxBatches
+	txQueryBatchSize, txQueryMaxBatches = 2, 2
+	defer func() { txQueryBatchSize, txQueryMaxBatches = batchSize, maxBatches }()
+
+	//只有最早的交易满足条件
+	for i := 1; i <= 10; i++ {
+		tx := &beamtest.Tx{Value: uint64(i), Height: uint64(i), Receiver: testReceiverB, CreateTime: int64(1000 + i)}
+		if i == 1 {
+			tx.Receiver = testReceiverC
+		}
+		srv.AddTransaction(tx)
+	}
+
+	query := &TxQuery{Address: testReceiverC, Limit: 1}
+	found := make([]*Transaction, 0)
+	for page := 0; ; page++ {
+		if page > 10 {
+			t.Fatalf("too many pages")
+		}
+		calls := srv.Calls("tx_list")
+		result, err := wm.QueryTransactions(query)
+		if err != nil {
+			t.Fatalf("QueryTransactions failed unexpected error: %v", err)
+		}
+		//每页请求钱包的次数不超过上限
+		if n := srv.Calls("tx_list") - calls; n > txQueryMaxBatches {
+			t.Fatalf("page %d tx_list calls = %d, want <= %d", page, n, txQueryMaxBatches)
+		}
+		found = append(found, result.Transactions...)
+		if len(result.NextCursor) == 0 {
+			break
+		}
+		query.Cursor = result.NextCursor
+	}
+
+	if len(found) != 1 || found[0].Value != 1 {
+		t.Errorf("QueryTransactions = %+v", found)
+	}
+}
+
+func TestWalletManager_QueryTransactions_InvalidQuery(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	queries := []*TxQuery{
+		{FromHeight: 10, ToHeight: 5},
+		{Direction: "unknown"},
+		{Limit: MaxTxQueryLimit + 1},
+		{Cursor: "bad"},
+		{Cursor: "0_tx"},
+		{Cursor: "x_tx"},
+	}
+	for _, query := range queries {
+		if _, err := wm.QueryTransactions(query); err == nil {
+			t.Errorf("QueryTransactions(%+v) should fail", query)
+		}
+	}
+
+	result, err := wm.QueryTransactions(nil)
+	if err != nil || len(result.Transactions) != 0 || len(result.NextCursor) > 0 {
+		t.Errorf("QueryTransactions(nil) = %+v, %v", result, err)
+	}
+}
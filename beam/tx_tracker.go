@@ -0,0 +1,307 @@
+package beam
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/timer"
+	"sync"
+	"time"
+)
+
+const (
+	//交易跟踪事件
+	TxEventChanged   = "changed"   //状态变化
+	TxEventCompleted = "completed" //交易完成
+	TxEventFailed    = "failed"    //交易失败
+	TxEventCanceled  = "canceled"  //交易取消
+	TxEventStuck     = "stuck"     //长时间处于Registering
+)
+
+//TxStatusEvent 交易状态变化事件
+type TxStatusEvent struct {
+	Event      string
+	TxID       string
+	PrevStatus int64 //上一个钱包交易状态，首次跟踪为-1
+	Status     int64 //当前钱包交易状态
+	Reason     string
+	Time       int64
+	Tx         *Transaction      //钱包返回的交易
+	Withdrawal *WithdrawalRecord //对应的提现记录，非提现交易为nil
+}
+
+//TxStatusObserver 交易状态观测者
+type TxStatusObserver interface {
+
+	//TxStatusNotify 交易状态变化通知
+	TxStatusNotify(event *TxStatusEvent) error
+}
+
+//trackedTx 跟踪中的交易
+type trackedTx struct {
+	status   int64 //最后一次查询到的状态
+	since    int64 //进入该状态的时间
+	stuck    bool  //已通知卡住
+	notFound int64 //钱包连续查不到交易的次数
+}
+
+//TxTracker 交易生命周期跟踪器，定时查询发送中交易的状态
+type TxTracker struct {
+	wm        *WalletManager
+	mu        sync.RWMutex
+	observers map[TxStatusObserver]bool
+	tracking  map[string]*trackedTx
+	task      *timer.TaskTimer
+	running   bool
+}
+
+//NewTxTracker 创建交易跟踪器
+func NewTxTracker(wm *WalletManager) *TxTracker {
+	tracker := TxTracker{
+		wm:        wm,
+		observers: make(map[TxStatusObserver]bool),
+		tracking:  make(map[string]*trackedTx),
+	}
+	return &tracker
+}
+
+//AddObserver 添加观测者
+func (tracker *TxTracker) AddObserver(obj TxStatusObserver) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if obj == nil {
+		return
+	}
+	tracker.observers[obj] = true
+}
+
+//RemoveObserver 移除观测者
+func (tracker *TxTracker) RemoveObserver(obj TxStatusObserver) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	delete(tracker.observers, obj)
+}
+
+//Track 跟踪一笔不在提现账本中的交易，例如汇总交易
+func (tracker *TxTracker) Track(txid string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if _, exist := tracker.tracking[txid]; !exist {
+		tracker.tracking[txid] = &trackedTx{status: -1, since: time.Now().Unix()}
+	}
+}
+
+//Tracking 跟踪中的交易
+func (tracker *TxTracker) Tracking() []string {
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+	txids := make([]string, 0, len(tracker.tracking))
+	for txid := range tracker.tracking {
+		txids = append(txids, txid)
+	}
+	return txids
+}
+
+//Run 按配置的周期定时查询交易状态
+func (tracker *TxTracker) Run() {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if tracker.running {
+		return
+	}
+
+	tracker.wm.Log.Infof("The timer for tx tracker start now. Execute by every %v seconds.", tracker.wm.Config.txtrackperiod.Seconds())
+
+	tracker.task = timer.NewTask(tracker.wm.Config.txtrackperiod, tracker.Poll)
+	tracker.task.Start()
+	tracker.running = true
+}
+
+//Stop 停止定时查询
+func (tracker *TxTracker) Stop() {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if tracker.task != nil {
+		tracker.task.Stop()
+	}
+	tracker.running = false
+}
+
+//Poll 查询所有发送中交易的状态，记录状态变化并通知观测者
+func (tracker *TxTracker) Poll() {
+
+	if !tracker.wm.lifecycle.enter() {
+		return
+	}
+	defer tracker.wm.lifecycle.leave()
+
+	//提现账本中已发送未完成的交易
+	records, err := tracker.wm.GetWithdrawalsByStatus(WithdrawalStatusSubmitted)
+	if err != nil {
+		tracker.wm.Log.Errorf("tx tracker can not get submitted withdrawals; unexpected error: %v", err)
+	}
+
+	//发送结果未知的提现，按发送前生成的交易单号向钱包核对
+	submitting, err := tracker.wm.GetWithdrawalsByStatus(WithdrawalStatusSubmitting)
+	if err != nil {
+		tracker.wm.Log.Errorf("tx tracker can not get submitting withdrawals; unexpected error: %v", err)
+	}
+
+	for _, r := range append(records, submitting...) {
+		if len(r.TxID) == 0 {
+			//没有生成交易单号就中断的提现不会已发送，超时后标记为失败，允许重试
+			if time.Unix(r.UpdatedAt, 0).Add(tracker.wm.Config.txsendingtimeout).Before(time.Now()) {
+				r.SetStatus(WithdrawalStatusFailed, "transaction was not sent before timeout")
+				if err := tracker.wm.SaveWithdrawal(r); err != nil {
+					tracker.wm.Log.Errorf("tx tracker can not save withdrawal [%s]; unexpected error: %v", r.Key, err)
+				}
+			}
+			continue
+		}
+		status := r.TxStatus
+		if r.Status == WithdrawalStatusSubmitting {
+			//查到交易时总是记录一次状态变化，将提现变更为已发送
+			status = -1
+		}
+		tracker.mu.Lock()
+		if _, exist := tracker.tracking[r.TxID]; !exist {
+			tracker.tracking[r.TxID] = &trackedTx{status: status, since: r.UpdatedAt}
+		}
+		tracker.mu.Unlock()
+	}
+
+	for _, txid := range tracker.Tracking() {
+		tx, err := tracker.wm.walletClient.GetTransaction(tracker.wm.context(), txid)
+		if err != nil {
+			tracker.wm.Log.Errorf("tx tracker can not get tx: %s; unexpected error: %v", txid, err)
+			if IsTxNotFound(err) {
+				tracker.notFound(txid)
+			}
+			continue
+		}
+		tracker.update(tx, tx.StatusString)
+	}
+}
+
+//notFound 记录钱包查不到交易，连续次数超过上限时按失败处理并停止跟踪
+func (tracker *TxTracker) notFound(txid string) {
+	tracker.mu.Lock()
+	tracked, exist := tracker.tracking[txid]
+	if !exist {
+		tracker.mu.Unlock()
+		return
+	}
+	tracked.notFound++
+	lost := tracked.notFound >= tracker.wm.Config.txnotfoundlimit
+	tracker.mu.Unlock()
+
+	if !lost {
+		return
+	}
+
+	failed := &Transaction{TxID: txid, Status: TxStatusFailed}
+	tracker.update(failed, fmt.Sprintf("tx not found in wallet after %d queries", tracker.wm.Config.txnotfoundlimit))
+}
+
+//TxCanceled 交易被取消，例如ClearExpireTx取消超时的交易
+func (tracker *TxTracker) TxCanceled(tx *Transaction, reason string) {
+	canceled := *tx
+	canceled.Status = TxStatusCanceled
+	tracker.Track(tx.TxID)
+	tracker.update(&canceled, reason)
+}
+
+//update 比较交易状态，发生变化时记录并通知
+func (tracker *TxTracker) update(tx *Transaction, reason string) {
+
+	var (
+		now   = time.Now().Unix()
+		event *TxStatusEvent
+	)
+
+	tracker.mu.Lock()
+
+	tracked, exist := tracker.tracking[tx.TxID]
+	if !exist {
+		tracked = &trackedTx{status: -1, since: now}
+		tracker.tracking[tx.TxID] = tracked
+	}
+
+	if tracked.status != tx.Status {
+		event = &TxStatusEvent{
+			Event:      TxEventChanged,
+			TxID:       tx.TxID,
+			PrevStatus: tracked.status,
+			Status:     tx.Status,
+			Reason:     reason,
+			Time:       now,
+			Tx:         tx,
+		}
+		switch tx.Status {
+		case TxStatusCompleted:
+			event.Event = TxEventCompleted
+		case TxStatusFailed:
+			event.Event = TxEventFailed
+		case TxStatusCanceled:
+			event.Event = TxEventCanceled
+		}
+		tracked.status = tx.Status
+		tracked.since = now
+		tracked.stuck = false
+	} else if tx.Status == TxStatusRegistering && !tracked.stuck &&
+		now-tracked.since > int64(tracker.wm.Config.txregisteringtimeout.Seconds()) {
+		event = &TxStatusEvent{
+			Event:      TxEventStuck,
+			TxID:       tx.TxID,
+			PrevStatus: tracked.status,
+			Status:     tx.Status,
+			Reason:     fmt.Sprintf("registering more than %v", tracker.wm.Config.txregisteringtimeout),
+			Time:       now,
+			Tx:         tx,
+		}
+		tracked.stuck = true
+	}
+
+	tracked.notFound = 0
+
+	//终态不再跟踪
+	if tx.Status == TxStatusCompleted || tx.Status == TxStatusFailed || tx.Status == TxStatusCanceled {
+		delete(tracker.tracking, tx.TxID)
+	}
+
+	tracker.mu.Unlock()
+
+	if event == nil {
+		return
+	}
+
+	//记录到提现账本
+	record, _ := tracker.wm.GetWithdrawalByTxID(tx.TxID)
+	if record != nil {
+		if event.Event == TxEventStuck {
+			record.SetStatus(record.Status, event.Reason)
+		} else {
+			record.SetTxStatus(tx.Status, event.Reason)
+		}
+		if err := tracker.wm.SaveWithdrawal(record); err != nil {
+			tracker.wm.Log.Errorf("tx tracker save withdrawal: %s failed; unexpected error: %v", tx.TxID, err)
+		}
+		event.Withdrawal = record
+	}
+
+	tracker.wm.Log.Infof("Tx: %s status %d -> %d [%s]", tx.TxID, event.PrevStatus, event.Status, event.Event)
+
+	tracker.notify(event)
+}
+
+//notify 通知观测者
+func (tracker *TxTracker) notify(event *TxStatusEvent) {
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+	for o := range tracker.observers {
+		err := o.TxStatusNotify(event)
+		if err != nil {
+			tracker.wm.Log.Error("TxStatusNotify unexpected error:", err)
+		}
+	}
+}
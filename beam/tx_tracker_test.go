@@ -0,0 +1,213 @@
+package beam
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blocktree/beam-adapter/beam/beamtest"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+type testTxStatusObserver struct {
+	mu     sync.Mutex
+	events []*TxStatusEvent
+}
+
+func (o *testTxStatusObserver) TxStatusNotify(event *TxStatusEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+	return nil
+}
+
+func (o *testTxStatusObserver) eventNames() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	names := make([]string, 0, len(o.events))
+	for _, e := range o.events {
+		names = append(names, e.Event)
+	}
+	return names
+}
+
+func TestTxTracker_Withdrawal(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+	srv.MineBlocks(2)
+
+	observer := &testTxStatusObserver{}
+	wm.TxTracker.AddObserver(observer)
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: "BEAM"},
+		Sid:  "order-1",
+		To:   map[string]string{testReceiver: "0.1"},
+	}
+	tx, err := wm.TxDecoder.SubmitRawTransaction(nil, rawTx)
+	if err != nil {
+		t.Fatalf("SubmitRawTransaction failed unexpected error: %v", err)
+	}
+
+	wm.TxTracker.Poll()
+	srv.SetTxStatus(tx.TxID, beamtest.TxStatusRegistering)
+	wm.TxTracker.Poll()
+	srv.ConfirmTx(tx.TxID, 3)
+	wm.TxTracker.Poll()
+	wm.TxTracker.Poll()
+
+	names := observer.eventNames()
+	if len(names) != 3 || names[0] != TxEventChanged || names[1] != TxEventChanged || names[2] != TxEventCompleted {
+		t.Fatalf("events = %v", names)
+	}
+	if e := observer.events[2]; e.Withdrawal == nil || e.PrevStatus != TxStatusRegistering {
+		t.Errorf("completed event = %+v", e)
+	}
+
+	record, err := wm.GetWithdrawalByTxID(tx.TxID)
+	if err != nil {
+		t.Fatalf("GetWithdrawalByTxID failed unexpected error: %v", err)
+	}
+	if record.Status != WithdrawalStatusCompleted || record.TxStatus != TxStatusCompleted {
+		t.Errorf("withdrawal record = %+v", record)
+	}
+	if len(wm.TxTracker.Tracking()) != 0 {
+		t.Errorf("completed tx should not be tracked")
+	}
+}
+
+func TestTxTracker_Stuck(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	wm.Config.txregisteringtimeout = -time.Second
+
+	observer := &testTxStatusObserver{}
+	wm.TxTracker.AddObserver(observer)
+
+	tx := srv.AddTransaction(&beamtest.Tx{Value: 100, Status: beamtest.TxStatusRegistering})
+	wm.TxTracker.Track(tx.TxID)
+
+	wm.TxTracker.Poll()
+	wm.TxTracker.Poll()
+	wm.TxTracker.Poll()
+
+	names := observer.eventNames()
+	if len(names) != 2 || names[0] != TxEventChanged || names[1] != TxEventStuck {
+		t.Errorf("events = %v", names)
+	}
+}
+
+func TestTxTracker_ClearExpireTx(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+
+	observer := &testTxStatusObserver{}
+	wm.TxTracker.AddObserver(observer)
+
+	tx := srv.AddTransaction(&beamtest.Tx{
+		Value:      100,
+		Status:     beamtest.TxStatusInProgress,
+		CreateTime: time.Now().Add(-wm.Config.txsendingtimeout - time.Minute).Unix(),
+	})
+
+	wm.ClearExpireTx()
+	wm.TxTracker.Poll()
+
+	names := observer.eventNames()
+	if len(names) != 1 || names[0] != TxEventCanceled || observer.events[0].TxID != tx.TxID {
+		t.Errorf("events = %v", names)
+	}
+}
+
+func TestTxTracker_NotFound(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+	wm.Config.txnotfoundlimit = 2
+
+	observer := &testTxStatusObserver{}
+	wm.TxTracker.AddObserver(observer)
+
+	wm.TxTracker.Track("missing-tx")
+	wm.TxTracker.Poll()
+	if len(wm.TxTracker.Tracking()) != 1 {
+		t.Fatalf("tx should be tracked before reaching the not found limit")
+	}
+
+	wm.TxTracker.Poll()
+	if len(wm.TxTracker.Tracking()) != 0 {
+		t.Errorf("tx not found should not be tracked after reaching the limit")
+	}
+	names := observer.eventNames()
+	if len(names) != 1 || names[0] != TxEventFailed || observer.events[0].TxID != "missing-tx" {
+		t.Errorf("events = %v", names)
+	}
+}
+
+func TestTxTracker_Submitting(t *testing.T) {
+	wm, srv := testNewMockWalletManager(t)
+	srv.SetBalance(beamtest.WalletBalance{Available: 100000000})
+	wm.Config.txnotfoundlimit = 1
+
+	submit := func(sid string) *WithdrawalRecord {
+		rawTx := &openwallet.RawTransaction{
+			Coin: openwallet.Coin{Symbol: "BEAM"},
+			Sid:  sid,
+			To:   map[string]string{testReceiver: "0.1"},
+		}
+		wm.TxDecoder.SubmitRawTransaction(nil, rawTx)
+		record, err := wm.GetWithdrawal(sid, testReceiver)
+		if err != nil {
+			t.Fatalf("GetWithdrawal failed unexpected error: %v", err)
+		}
+		return record
+	}
+
+	//请求已到达钱包但响应丢失
+	wm.walletClient.Timeout = 50 * time.Millisecond
+	srv.Delay("tx_send", 5*time.Second, 1)
+	arrived := submit("order-1")
+	for i := 0; i < 100 && len(srv.SentTransactions()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	wm.walletClient.Timeout = 0
+
+	//请求未到达钱包
+	srv.FailHTTP("tx_send", http.StatusBadGateway, 1)
+	lost := submit("order-2")
+
+	if arrived.Status != WithdrawalStatusSubmitting || lost.Status != WithdrawalStatusSubmitting {
+		t.Fatalf("withdrawal status = %s, %s, want submitting", arrived.Status, lost.Status)
+	}
+
+	wm.TxTracker.Poll()
+
+	if record, _ := wm.GetWithdrawal("order-1", testReceiver); record.Status != WithdrawalStatusSubmitted || record.TxID != arrived.TxID {
+		t.Errorf("arrived withdrawal = %+v, want submitted", record)
+	}
+	if record, _ := wm.GetWithdrawal("order-2", testReceiver); !record.Retryable() {
+		t.Errorf("lost withdrawal = %+v, want retryable", record)
+	}
+}
+
+func TestTxTracker_SubmittingWithoutTxID(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	//记录为发送中后，生成交易单号前中断
+	record, claimed, err := wm.ClaimWithdrawal("order-1", testReceiver, "0.1", "0.00000001")
+	if err != nil || !claimed {
+		t.Fatalf("ClaimWithdrawal = %v, %v", claimed, err)
+	}
+
+	wm.TxTracker.Poll()
+	if record, _ := wm.GetWithdrawal("order-1", testReceiver); record.Status != WithdrawalStatusSubmitting {
+		t.Errorf("withdrawal = %+v, want submitting before timeout", record)
+	}
+
+	record.UpdatedAt = time.Now().Add(-wm.Config.txsendingtimeout - time.Minute).Unix()
+	if err := wm.SaveWithdrawal(record); err != nil {
+		t.Fatalf("SaveWithdrawal failed unexpected error: %v", err)
+	}
+
+	wm.TxTracker.Poll()
+	if record, _ := wm.GetWithdrawal("order-1", testReceiver); !record.Retryable() {
+		t.Errorf("withdrawal = %+v, want retryable after timeout", record)
+	}
+}
@@ -0,0 +1,172 @@
+package beam
+
+import (
+	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+//SaveWithdrawal 保存提现记录
+func (wm *WalletManager) SaveWithdrawal(record *WithdrawalRecord) error {
+
+	if record == nil {
+		return fmt.Errorf("the withdrawal record to save is nil")
+	}
+
+	db, err := wm.withdrawalDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Save(record)
+}
+
+//ClaimWithdrawal 在同一个写事务中检查幂等键并记录发送中的提现，并发的重复请求只有一个可以发送。
+//没有记录或记录可以重试时，记录为发送中并返回true；已存在且不可重试时返回原记录和false
+func (wm *WalletManager) ClaimWithdrawal(key, address, amount, fees string) (*WithdrawalRecord, bool, error) {
+
+	db, err := wm.withdrawalDB()
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var record *WithdrawalRecord
+	if len(key) > 0 {
+		var exist WithdrawalRecord
+		err = tx.One("ID", withdrawalID(key, address), &exist)
+		if err != nil && err != storm.ErrNotFound {
+			return nil, false, err
+		}
+		if err == nil {
+			if !exist.Retryable() {
+				return &exist, false, nil
+			}
+			record = &exist
+		}
+	}
+
+	if record == nil {
+		record = NewWithdrawalRecord(key, address, amount, fees)
+	} else {
+		record.Amount = amount
+		record.Fees = fees
+		record.TxID = ""
+		record.TxStatus = -1
+		record.SetStatus(WithdrawalStatusSubmitting, "")
+	}
+
+	err = tx.Save(record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return record, true, nil
+}
+
+//GetWithdrawal 通过幂等键和接收地址获取提现记录
+func (wm *WalletManager) GetWithdrawal(key, address string) (*WithdrawalRecord, error) {
+
+	var (
+		record WithdrawalRecord
+	)
+
+	db, err := wm.withdrawalDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.One("ID", withdrawalID(key, address), &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+//GetWithdrawalsByKey 获取幂等键下的所有提现记录
+func (wm *WalletManager) GetWithdrawalsByKey(key string) ([]*WithdrawalRecord, error) {
+
+	db, err := wm.withdrawalDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*WithdrawalRecord
+	err = db.Find("Key", key, &list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//GetWithdrawalByTxID 通过txid获取提现记录
+func (wm *WalletManager) GetWithdrawalByTxID(txid string) (*WithdrawalRecord, error) {
+
+	var (
+		record WithdrawalRecord
+	)
+
+	db, err := wm.withdrawalDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.One("TxID", txid, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+//GetWithdrawalsByStatus 获取指定状态的提现记录
+func (wm *WalletManager) GetWithdrawalsByStatus(status ...string) ([]*WithdrawalRecord, error) {
+
+	db, err := wm.withdrawalDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*WithdrawalRecord
+	err = db.Select(q.In("Status", status)).OrderBy("CreatedAt").Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//UpdateWithdrawalStatus 更新txid对应提现记录的状态
+func (wm *WalletManager) UpdateWithdrawalStatus(txid, status, reason string) error {
+
+	db, err := wm.withdrawalDB()
+	if err != nil {
+		return err
+	}
+
+	var record WithdrawalRecord
+	err = db.One("TxID", txid, &record)
+	if err != nil {
+		return err
+	}
+
+	if record.Status == status {
+		return nil
+	}
+
+	record.SetStatus(status, reason)
+
+	return db.Save(&record)
+}
@@ -0,0 +1,43 @@
+package beam
+
+import (
+	"testing"
+)
+
+func TestWalletManager_WithdrawalLedger(t *testing.T) {
+	wm, _ := testNewMockWalletManager(t)
+
+	a := NewWithdrawalRecord("order-1", "receiver-a", "0.1", "0.00000001")
+	a.TxID = "tx-a"
+	a.SetStatus(WithdrawalStatusSubmitted, "")
+	b := NewWithdrawalRecord("order-1", "receiver-b", "0.2", "0.00000001")
+	c := NewWithdrawalRecord("", "receiver-c", "0.3", "0.00000001")
+
+	for _, r := range []*WithdrawalRecord{a, b, c} {
+		if err := wm.SaveWithdrawal(r); err != nil {
+			t.Fatalf("SaveWithdrawal failed unexpected error: %v", err)
+		}
+	}
+
+	list, err := wm.GetWithdrawalsByKey("order-1")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("GetWithdrawalsByKey = %v, %v", list, err)
+	}
+
+	submitting, err := wm.GetWithdrawalsByStatus(WithdrawalStatusSubmitting)
+	if err != nil || len(submitting) != 2 {
+		t.Errorf("GetWithdrawalsByStatus = %v, %v", submitting, err)
+	}
+
+	if err = wm.UpdateWithdrawalStatus("tx-a", WithdrawalStatusCompleted, ""); err != nil {
+		t.Fatalf("UpdateWithdrawalStatus failed unexpected error: %v", err)
+	}
+
+	record, err := wm.GetWithdrawalByTxID("tx-a")
+	if err != nil {
+		t.Fatalf("GetWithdrawalByTxID failed unexpected error: %v", err)
+	}
+	if record.Status != WithdrawalStatusCompleted || len(record.History) != 3 || record.Retryable() {
+		t.Errorf("withdrawal record = %+v", record)
+	}
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/astaxie/beego/config"
+	"github.com/blocktree/beam-adapter/beam"
+	"gopkg.in/urfave/cli.v1"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// 审计日志命令
+	CmdAuditLog = cli.Command{
+		Name:     "auditlog",
+		Usage:    "verify or export the audit log of the wallet server",
+		Category: "BEAM-SERVER COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "verify",
+				Usage:  "verify the hash chain of the audit log",
+				Action: auditLogVerify,
+			},
+			{
+				Name:   "export",
+				Usage:  "export audit log entries in a time range as JSON lines",
+				Action: auditLogExport,
+				Flags: []cli.Flag{
+					FromFlag,
+					ToFlag,
+					FileFlag,
+				},
+			},
+		},
+	}
+)
+
+//auditTimeLayouts 导出时间范围支持的格式，使用本地时区
+var auditTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+//getAuditWalletManager 只加载审计日志配置，不启动服务
+func getAuditWalletManager(c *cli.Context) (*beam.WalletManager, error) {
+
+	conf := c.GlobalString("conf")
+	cfg, err := config.NewConfig("ini", conf)
+	if err != nil {
+		return nil, err
+	}
+
+	wm := beam.NewWalletManager()
+	wm.LoadAuditLogConfig(cfg)
+
+	return wm, nil
+}
+
+//parseAuditTime 解析导出时间，为空时返回零值。endOfDay为true时，只有日期的结束时间为当天最后一秒
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	for _, layout := range auditTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			if endOfDay && layout == "2006-01-02" {
+				t = t.AddDate(0, 0, 1).Add(-time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", value)
+}
+
+//auditLogVerify 校验审计日志的哈希链
+func auditLogVerify(c *cli.Context) error {
+
+	wm, err := getAuditWalletManager(c)
+	if err != nil {
+		return err
+	}
+
+	count, err := wm.VerifyAuditLog()
+	if err != nil {
+		return fmt.Errorf("audit log is broken after %d valid entries: %v", count, err)
+	}
+
+	fmt.Printf("audit log is valid, %d entries\n", count)
+	return nil
+}
+
+//auditLogExport 导出时间范围内的审计日志，未指定文件时输出到标准输出
+func auditLogExport(c *cli.Context) error {
+
+	wm, err := getAuditWalletManager(c)
+	if err != nil {
+		return err
+	}
+
+	from, err := parseAuditTime(c.String("from"), false)
+	if err != nil {
+		return err
+	}
+
+	to, err := parseAuditTime(c.String("to"), true)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if path := c.String("file"); len(path) > 0 {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := wm.ExportAuditLog(from, to, w)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d audit log entries\n", n)
+	return nil
+}
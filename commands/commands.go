@@ -1,16 +1,21 @@
 package commands
 
 import (
+	"context"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/beam-adapter/beam"
 	"github.com/blocktree/openwallet/log"
 	"gopkg.in/urfave/cli.v1"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 var (
 	// 通信节点命令
 	Commands = []cli.Command{
 		CmdVersion,
+		CmdAuditLog,
 		{
 			//运行钱包服务
 			Name:      "walletserver",
@@ -39,15 +44,38 @@ func getWalleManager(c *cli.Context) *beam.WalletManager {
 	return wm
 }
 
-//walletserver 钱包服务
+//walletserver 钱包服务，收到SIGINT/SIGTERM后停止
 func walletserver(c *cli.Context) error {
 
-	if wm := getWalleManager(c); wm != nil {
-		err := wm.StartSummaryWallet()
-		if err != nil {
-			log.Error("unexpected error: ", err)
-			return err
+	wm := getWalleManager(c)
+	if wm == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	go func() {
+		select {
+		case s := <-sig:
+			log.Info("receive signal:", s)
+			cancel()
+		case <-wm.Done():
 		}
+	}()
+
+	err := wm.Start(ctx)
+	if err != nil {
+		log.Error("unexpected error: ", err)
+		wm.Stop()
+		return err
 	}
+
+	<-wm.Done()
+
 	return nil
 }
@@ -48,4 +48,14 @@ var (
 		Name: "conf, c",
 		Usage: "config file path",
 	}
+
+	FromFlag = cli.StringFlag{
+		Name: "from",
+		Usage: "start time, e.g. 2006-01-02 or 2006-01-02 15:04:05",
+	}
+
+	ToFlag = cli.StringFlag{
+		Name: "to",
+		Usage: "end time, e.g. 2006-01-02 or 2006-01-02 15:04:05",
+	}
 )
@@ -10,8 +10,10 @@ require (
 	github.com/blocktree/openwallet v1.5.2
 	github.com/imroc/req v0.2.3
 	github.com/kr/pretty v0.1.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.0
 	github.com/shopspring/decimal v0.0.0-20180709203117-cd690d0c9e24
 	github.com/tidwall/gjson v1.2.1
+	go.etcd.io/bbolt v1.3.2
 	golang.org/x/crypto v0.0.0-20190513172903-22d7a77e9e5f // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/urfave/cli.v1 v1.20.0